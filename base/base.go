@@ -21,6 +21,12 @@ type Stream interface { // todo, make it a bit more streamable, so receive wante
 	GetRxTxBytes() (int64, int64)
 }
 
+// optional interface of the apdu streams, sends already written data as a separate message without waiting for the answer,
+// used for streaming of more apdus in a row (general block transfer windows)
+type Flusher interface {
+	Flush() error
+}
+
 func LogHex(s string, b []byte) string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("%s (%d):", s, len(b)))
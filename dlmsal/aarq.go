@@ -41,35 +41,6 @@ type initiateResponse struct {
 	VAAddress                  int16
 }
 
-type confirmedServiceErrorTag byte
-
-const (
-	TagErrInitiateError confirmedServiceErrorTag = 1
-	TagErrRead          confirmedServiceErrorTag = 5
-	TagErrWrite         confirmedServiceErrorTag = 6
-)
-
-type serviceErrorTag byte
-
-const (
-	TagErrApplicationReference serviceErrorTag = 0
-	TagErrHardwareResource     serviceErrorTag = 1
-	TagErrVdeStateError        serviceErrorTag = 2
-	TagErrService              serviceErrorTag = 3
-	TagErrDefinition           serviceErrorTag = 4
-	TagErrAccess               serviceErrorTag = 5
-	TagErrInitiate             serviceErrorTag = 6
-	TagErrLoadDataSet          serviceErrorTag = 7
-	TagErrTask                 serviceErrorTag = 9
-	TagErrOtherError           serviceErrorTag = 10
-)
-
-type confirmedServiceError struct {
-	ConfirmedServiceError confirmedServiceErrorTag
-	ServiceError          serviceErrorTag
-	Value                 byte
-}
-
 type ApplicationContext byte
 
 // Application context definitions
@@ -148,7 +119,7 @@ type AAResponse struct {
 	SourceDiagnostic       SourceDiagnostic
 	SystemTitle            []byte
 	initiateResponse       *initiateResponse
-	confirmedServiceError  *confirmedServiceError
+	confirmedServiceError  *ConfirmedServiceError
 }
 
 func putappctxname(dst *bytes.Buffer, settings *DlmsSettings) {
@@ -158,30 +129,29 @@ func putappctxname(dst *bytes.Buffer, settings *DlmsSettings) {
 	dst.WriteByte(byte(settings.applicationContext))
 }
 
-func putmechname(dst *bytes.Buffer, settings *DlmsSettings) {
-	if settings.authentication == AuthenticationNone {
+func putmechname(dst *bytes.Buffer, mech Authentication) {
+	if mech == AuthenticationNone {
 		return
 	}
 	dst.WriteByte(BERTypeContext | PduTypeMechanismName)
 	dst.Write([]byte{0x07, 0x60, 0x85, 0x74, 0x05, 0x08, 0x02})
-	dst.WriteByte(byte(settings.authentication))
+	dst.WriteByte(byte(mech))
 }
 
-func putsecvalues(dst *bytes.Buffer, settings *DlmsSettings) {
-	if settings.authentication == AuthenticationNone {
+func putsecvalues(dst *bytes.Buffer, value []byte) {
+	if value == nil {
 		return
 	}
-	encodetag2(dst, BERTypeContext|BERTypeConstructed|PduTypeCallingAuthenticationValue, 0x80, settings.password)
+	encodetag2(dst, BERTypeContext|BERTypeConstructed|PduTypeCallingAuthenticationValue, 0x80, value)
 }
 
-func putsystitle(dst *bytes.Buffer, settings *DlmsSettings) {
-	switch settings.authentication {
-	case AuthenticationHighGmac:
+func putsystitle(dst *bytes.Buffer, settings *DlmsSettings, required bool) {
+	if settings.gcm != nil || required {
 		encodetag2(dst, BERTypeContext|BERTypeConstructed|PduTypeCallingAPTitle, 0x04, settings.systemtitle)
 	}
 }
 
-func (d *dlmsal) createxdlms(dst *bytes.Buffer) {
+func (d *dlmsal) createxdlms(dst *bytes.Buffer) error {
 	s := d.settings
 	var xdlms []byte
 	var subxdlms []byte
@@ -209,28 +179,43 @@ func (d *dlmsal) createxdlms(dst *bytes.Buffer) {
 	subxdlms[10] = byte(s.MaxPduRecvSize >> 8) // no limit in maximum received apdu length
 	subxdlms[11] = byte(s.MaxPduRecvSize)
 
-	switch s.authentication {
-	case AuthenticationHighGmac: // encrypt this
-		xdlms = d.encryptpacket(byte(TagGloInitiateRequest), xdlms, false)
+	if s.gcm != nil { // ciphered context, encrypt this
+		plain := xdlms
+		var err error
+		xdlms, err = d.encryptpacket(byte(TagGloInitiateRequest), xdlms, false)
+		clear(plain) // can contain dedicated key
+		if err != nil {
+			return err
+		}
 	}
 	encodetag2(dst, BERTypeContext|BERTypeConstructed|PduTypeUserInformation, 0x04, xdlms)
+	return nil
 }
 
 func (d *dlmsal) encodeaarq() (out []byte, outnosec []byte, err error) {
 	var buf bytes.Buffer
 	var content bytes.Buffer
 	s := d.settings
+	a := d.authenticator()
+	mech := a.Mechanism()
+	value, err := a.CallingValue(d.authcontext())
+	if err != nil {
+		return
+	}
 
 	putappctxname(&content, s)
-	putsystitle(&content, s)
-	if s.authentication != AuthenticationNone {
+	putsystitle(&content, s, a.SystemTitleRequired())
+	if mech != AuthenticationNone {
 		encodetag(&content, BERTypeContext|PduTypeSenderAcseRequirements, []byte{0x07, 0x80})
 	}
-	putmechname(&content, s)
+	putmechname(&content, mech)
 	st := content.Len()
-	putsecvalues(&content, s)
+	putsecvalues(&content, value)
 	en := content.Len()
-	d.createxdlms(&content)
+	err = d.createxdlms(&content)
+	if err != nil {
+		return
+	}
 
 	encodetag(&buf, byte(TagAARQ), content.Bytes())
 	out = buf.Bytes()
@@ -324,7 +309,7 @@ func parseSenderAcseRequirements(tag *aaretag, tmp *tmpbuffer) (stoc []byte, err
 	return
 }
 
-func (al *dlmsal) parseUserInformation(tag *aaretag) (ir *initiateResponse, cse *confirmedServiceError, err error) {
+func (al *dlmsal) parseUserInformation(tag *aaretag) (ir *initiateResponse, cse *ConfirmedServiceError, err error) {
 	if len(tag.data) < 6 {
 		err = fmt.Errorf("invalid BE tag length")
 		return
@@ -339,7 +324,7 @@ func (al *dlmsal) parseUserInformation(tag *aaretag) (ir *initiateResponse, cse
 	return al.parseUserInformationtag(d)
 }
 
-func (al *dlmsal) parseUserInformationtag(d []byte) (ir *initiateResponse, cse *confirmedServiceError, err error) {
+func (al *dlmsal) parseUserInformationtag(d []byte) (ir *initiateResponse, cse *ConfirmedServiceError, err error) {
 	if d[0] == byte(TagInitiateResponse) {
 		iir, err := decodeInitiateResponse(d[1:])
 		return &iir, nil, err
@@ -348,10 +333,7 @@ func (al *dlmsal) parseUserInformationtag(d []byte) (ir *initiateResponse, cse *
 		cse, err := decodeConfirmedServiceError(d[1:])
 		return nil, &cse, err
 	}
-	if d[0] == byte(TagGloConfirmedServiceError) { // artifical service error for now, not decoding inside of it
-		return nil, nil, fmt.Errorf("TagGloConfirmedServiceError returned")
-	}
-	if d[0] == byte(TagGloInitiateResponse) {
+	if d[0] == byte(TagGloInitiateResponse) || d[0] == byte(TagGloConfirmedServiceError) {
 		s := al.settings
 		if s.gcm == nil {
 			return nil, nil, fmt.Errorf("GCM not initialized")
@@ -409,15 +391,3 @@ func decodeInitiateResponse(src []byte) (out initiateResponse, err error) {
 	out.VAAddress = int16(binary.BigEndian.Uint16(src[10:12]))
 	return
 }
-
-func decodeConfirmedServiceError(src []byte) (out confirmedServiceError, err error) {
-	if len(src) < 3 {
-		err = fmt.Errorf("invalid service error length")
-		return
-	}
-
-	out.ConfirmedServiceError = confirmedServiceErrorTag(src[0])
-	out.ServiceError = serviceErrorTag(src[1])
-	out.Value = src[2]
-	return
-}
@@ -0,0 +1,124 @@
+package dlmsal
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// state of the association given to the authenticator, slices are shared with the client, so they must not be modified
+type AuthenticationContext struct {
+	SystemTitle       []byte // own system title
+	ServerSystemTitle []byte // system title received in aare, nil before it
+	CtoS              []byte // own challenge
+	StoC              []byte // challenge received in aare, nil before it
+	SourceDiagnostic  SourceDiagnostic
+}
+
+// authentication mechanism of the association, built-in mechanisms are used unless the custom one is set by SetAuthenticator
+type Authenticator interface {
+	// last arc of the mechanism name 2.16.756.5.8.2, AuthenticationNone means no mechanism name and acse requirements in aarq
+	Mechanism() Authentication
+	// calling authentication value of the aarq (password or CtoS), nil means none, it is never logged
+	CallingValue(ac *AuthenticationContext) ([]byte, error)
+	// system title is sent in aarq even without ciphered context
+	SystemTitleRequired() bool
+	// called after the aare is accepted, so mechanism specific content (StoC, system title) can be checked
+	CheckAARE(ac *AuthenticationContext) error
+	// pass 3, f(StoC) sent by reply_to_HLS_authentication
+	Pass3(ac *AuthenticationContext) ([]byte, error)
+	// pass 4, check of f(CtoS) returned by the server
+	Pass4(ac *AuthenticationContext, resp []byte) error
+}
+
+// custom authenticator replaces the built-in mechanisms, nil means built-in ones again
+func (d *DlmsSettings) SetAuthenticator(a Authenticator) {
+	d.authenticator = a
+}
+
+func (d *dlmsal) authenticator() Authenticator {
+	if d.settings.authenticator != nil {
+		return d.settings.authenticator
+	}
+	return &builtinauthenticator{d: d}
+}
+
+func (d *dlmsal) authcontext() *AuthenticationContext {
+	s := d.settings
+	return &AuthenticationContext{
+		SystemTitle:       s.systemtitle,
+		ServerSystemTitle: d.aareres.SystemTitle,
+		CtoS:              s.CtoS,
+		StoC:              s.StoC,
+		SourceDiagnostic:  d.aareres.SourceDiagnostic,
+	}
+}
+
+// mechanisms given by the settings constructors, low, hash based hls, gmac and ecdsa
+type builtinauthenticator struct {
+	d *dlmsal
+}
+
+func (b *builtinauthenticator) Mechanism() Authentication {
+	return b.d.settings.authentication
+}
+
+func (b *builtinauthenticator) CallingValue(ac *AuthenticationContext) ([]byte, error) {
+	s := b.d.settings
+	if s.authentication == AuthenticationNone {
+		return nil, nil
+	}
+	if s.password == nil { // empty value is still sent
+		return []byte{}, nil
+	}
+	return s.password, nil
+}
+
+func (b *builtinauthenticator) SystemTitleRequired() bool {
+	switch b.d.settings.authentication {
+	case AuthenticationHighSha256, AuthenticationHighEcdsa:
+		return true
+	}
+	return false
+}
+
+func (b *builtinauthenticator) CheckAARE(ac *AuthenticationContext) error {
+	switch b.d.settings.authentication {
+	case AuthenticationNone, AuthenticationLow:
+		return nil
+	}
+	if ac.SourceDiagnostic == SourceDiagnosticAuthenticationRequired && len(ac.StoC) == 0 {
+		return fmt.Errorf("no StoC received for hls authentication")
+	}
+	return nil
+}
+
+func (b *builtinauthenticator) Pass3(ac *AuthenticationContext) ([]byte, error) {
+	s := b.d.settings
+	switch {
+	case s.authentication == AuthenticationHighGmac:
+		return b.d.gmacctos()
+	case ishashhls(s.authentication):
+		return hlsdigest(s.authentication, s.hlssecret, ac.SystemTitle, ac.ServerSystemTitle, ac.StoC, ac.CtoS)
+	case s.authentication == AuthenticationHighEcdsa:
+		return ecdsasign(s.signkey, ac.SystemTitle, ac.ServerSystemTitle, ac.StoC, ac.CtoS)
+	}
+	return nil, fmt.Errorf("unsupported authentication mechanism: %v", s.authentication)
+}
+
+func (b *builtinauthenticator) Pass4(ac *AuthenticationContext, resp []byte) error {
+	s := b.d.settings
+	switch s.authentication {
+	case AuthenticationHighGmac:
+		return b.d.checkgmacstoc(resp)
+	case AuthenticationHighEcdsa:
+		return ecdsaverify(s.peerkey, resp, ac.ServerSystemTitle, ac.SystemTitle, ac.CtoS, ac.StoC)
+	}
+	r, err := hlsdigest(s.authentication, s.hlssecret, ac.ServerSystemTitle, ac.SystemTitle, ac.CtoS, ac.StoC)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(resp, r) {
+		return nil
+	}
+	return fmt.Errorf("returned hash mismatch")
+}
@@ -0,0 +1,114 @@
+package dlmsal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// custom authenticator doing md5 hls on its own, calls and arguments are recorded, errors of the steps are returned as set
+type stubauthenticator struct {
+	secret []byte
+	ctos   []byte
+	stoc   []byte // StoC seen by pass 3
+	resp   []byte // response seen by pass 4
+	pass3  int
+	pass4  int
+	aare   error
+	err3   error
+	err4   error
+}
+
+func (a *stubauthenticator) Mechanism() Authentication { return AuthenticationHighMD5 }
+func (a *stubauthenticator) SystemTitleRequired() bool { return false }
+
+func (a *stubauthenticator) CallingValue(ac *AuthenticationContext) ([]byte, error) {
+	return a.ctos, nil
+}
+
+func (a *stubauthenticator) CheckAARE(ac *AuthenticationContext) error {
+	return a.aare
+}
+
+func (a *stubauthenticator) Pass3(ac *AuthenticationContext) ([]byte, error) {
+	a.pass3++
+	a.stoc = bytes.Clone(ac.StoC)
+	if a.err3 != nil {
+		return nil, a.err3
+	}
+	return hlsdigest(AuthenticationHighMD5, a.secret, nil, nil, ac.StoC, a.ctos)
+}
+
+func (a *stubauthenticator) Pass4(ac *AuthenticationContext, resp []byte) error {
+	a.pass4++
+	a.resp = bytes.Clone(resp)
+	return a.err4
+}
+
+func TestCustomAuthenticator(t *testing.T) {
+	secret := []byte("hlssecret")
+	stoc := []byte("serverchallenge1")
+	errstub := errors.New("stub failure")
+	tests := []struct {
+		name      string
+		stub      stubauthenticator
+		setter    bool // SetAuthenticator instead of the builder
+		checkresp bool
+		pass4     int
+		err       error
+	}{
+		{"success", stubauthenticator{}, false, true, 1, nil},
+		{"set on settings", stubauthenticator{}, true, true, 1, nil},
+		{"response not checked", stubauthenticator{}, false, false, 0, nil},
+		{"pass 3 failure", stubauthenticator{err3: errstub}, false, true, 0, errstub},
+		{"pass 4 failure", stubauthenticator{err4: errstub}, false, true, 1, errstub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := testsettings(t, NewSettingsBuilderLN().HlsAuthentication(AuthenticationHighMD5, secret, stoc))
+			ss.MaxPduRecvSize = 1024
+			client, _, stop := startserver(t, ss, newtesthandler())
+			defer stop()
+			a := tt.stub
+			a.secret = secret
+			a.ctos = []byte("clientchallenge1")
+			var cs *DlmsSettings
+			if tt.setter {
+				cs = testsettings(t, NewSettingsBuilderLN())
+				cs.SetAuthenticator(&a)
+			} else {
+				cs = testsettings(t, NewSettingsBuilderLN().CustomAuthentication(&a))
+			}
+			c := New(client, cs)
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			err := c.LNAuthentication(tt.checkresp)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if a.pass3 != 1 || a.pass4 != tt.pass4 {
+				t.Errorf("pass 3 called %d times, pass 4 %d times", a.pass3, a.pass4)
+			}
+			if !bytes.Equal(a.stoc, stoc) {
+				t.Errorf("unexpected StoC %x", a.stoc)
+			}
+			if tt.pass4 == 0 {
+				return
+			}
+			exp, _ := hlsdigest(AuthenticationHighMD5, secret, nil, nil, a.ctos, stoc)
+			if !bytes.Equal(a.resp, exp) {
+				t.Errorf("unexpected f(CtoS) %x", a.resp)
+			}
+		})
+	}
+
+	// refused aare check fails the open
+	ss := testsettings(t, NewSettingsBuilderLN().HlsAuthentication(AuthenticationHighMD5, secret, stoc))
+	client, _, stop := startserver(t, ss, newtesthandler())
+	defer stop()
+	a := stubauthenticator{ctos: []byte("clientchallenge1"), aare: errstub}
+	if err := New(client, testsettings(t, NewSettingsBuilderLN().CustomAuthentication(&a))).Open(); !errors.Is(err, errstub) {
+		t.Errorf("expected %v, got %v", errstub, err)
+	}
+}
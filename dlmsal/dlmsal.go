@@ -2,6 +2,8 @@ package dlmsal
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
@@ -41,6 +43,31 @@ const (
 	SecurityEncryption     DlmsSecurity = 0x20 // Encryption security is used.
 )
 
+type SecuritySuite byte
+
+const (
+	SecuritySuite0 SecuritySuite = 0 // AES-GCM-128
+	SecuritySuite1 SecuritySuite = 1 // ECDH-ECDSA-AES-GCM-128-SHA-256
+	SecuritySuite2 SecuritySuite = 2 // ECDH-ECDSA-AES-GCM-256-SHA-384
+)
+
+type CipheredApdu byte
+
+const (
+	CipheredApduServiceSpecific CipheredApdu = 0 // glo-xxx or ded-xxx apdus
+	CipheredApduGeneralGloDed   CipheredApdu = 1 // general-glo-ciphering or general-ded-ciphering, depending on the dedicated key
+	CipheredApduGeneral         CipheredApdu = 2 // general-ciphering with the global unicast key or the agreed one, see KeyAgreement
+)
+
+// key-parameters of agreed-key of general-ciphering
+type KeyAgreementScheme byte
+
+const (
+	KeyAgreementNone               KeyAgreementScheme = 0 // identified global unicast key
+	KeyAgreementOnePass            KeyAgreementScheme = 1 // One-Pass Diffie-Hellman C(1e, 1s), ephemeral key of the originator is sent in the key-info
+	KeyAgreementStaticUnifiedModel KeyAgreementScheme = 2 // Static Unified Model C(0e, 2s)
+)
+
 type DlmsSNRequestItem struct {
 	Address          int16
 	HasAccess        bool
@@ -68,12 +95,21 @@ type DlmsClient interface {
 	SetLogger(logger *zap.SugaredLogger)
 	Get(items []DlmsLNRequestItem) ([]DlmsData, error)
 	GetStream(item DlmsLNRequestItem, inmem bool) (DlmsDataStream, error)
+	GetListStream(items []DlmsLNRequestItem) (DlmsListStream, error)
 	Read(items []DlmsSNRequestItem) ([]DlmsData, error)
 	ReadStream(item DlmsSNRequestItem, inmem bool) (DlmsDataStream, error) // only for big single item queries
 	Write(items []DlmsSNRequestItem) ([]DlmsResultTag, error)
+	UnconfirmedWrite(items []DlmsSNRequestItem) error                             // no response, fits into a single pdu
+	InvokeSN(basename uint16, offset uint16, params *DlmsData) (*DlmsData, error) // offset is in bytes, see SNMethodOffset
 	Action(item DlmsLNRequestItem) (*DlmsData, error)
+	ActionList(items []DlmsLNRequestItem) ([]ActionResult, error)
 	Set(items []DlmsLNRequestItem) ([]DlmsResultTag, error)
 	LNAuthentication(checkresp bool) error
+	SNAuthentication(checkresp bool) error
+	TransferKeys(instance byte, kek []byte, keys []KeyData) error
+	AgreeKeys(instance byte, keys []KeyId) ([]KeyData, error)
+	SetEventHandler(handler func(e *EventNotification))
+	SetInformationReportHandler(handler func(r *InformationReport))
 }
 
 type tmpbuffer [128]byte
@@ -91,6 +127,11 @@ type dlmsal struct {
 	tmpbuffer   tmpbuffer
 	pdu         bytes.Buffer // reused for sending requests
 	cryptbuffer []byte       // reusable crypt buffer
+	gbt         gbtstate
+
+	// unsolicited notifications received inside the association
+	eventhandler  func(e *EventNotification)
+	reporthandler func(r *InformationReport)
 }
 
 type DlmsSettings struct {
@@ -104,6 +145,16 @@ type DlmsSettings struct {
 	StoC              []byte
 	CtoS              []byte
 	SourceDiagnostic  SourceDiagnostic
+	GbtWindowSize     byte // own receive window (1-63), requests are sent by general block transfer if it is non zero and negotiated, windows are sent only over base.Flusher transports (e.g. wrapper, hdlc), otherwise window is 1
+	SecuritySuite     SecuritySuite
+	CipheredApdu      CipheredApdu
+	KeyAgreement      KeyAgreementScheme     // key of sent general-ciphering is agreed for each apdu (server answers by its own scheme too), see SetKeyAgreementKeys
+	GeneralDateTime   bool                   // date-time of general-ciphering and general-signing is filled by the current time
+	OtherInformation  []byte                 // other-information of general-ciphering and general-signing
+	SignApdus         bool                   // requests are sent in general-signing, see SetSigningKeys
+	FrameCounterHook  func() (uint32, error) // called by Open before the association, result is the minimal invocation counter, see ReadFrameCounter
+	ReplayProtection  ReplayProtection       // check of received invocation counters, see ReceivedFrameCounters
+	AutoDedicatedKey  bool                   // random dedicated key is generated by Open and dropped by Close or Disconnect
 
 	// private part
 	invokebyte         byte
@@ -113,22 +164,100 @@ type DlmsSettings struct {
 	gcm                gcm.Gcm
 	systemtitle        []byte
 	framecounter       uint32
+	fcstore            FrameCounterStore
+	fcreserve          uint32
+	fclimit            uint64            // end of the reserved range
+	rxframecounters    map[string]uint32 // last accepted received invocation counter per system title
+	transactionid      uint64
 	usededicatedkey    bool
 	dedgcm             gcm.Gcm
 	dedicatedkey       []byte
+	ekcopy             []byte
 	akcopy             []byte
+	keyprovider        KeyProvider
+	peersystemtitle    []byte // system title of the meter for the key provider
+	hlssecret          []byte
+	signkey            *ecdsa.PrivateKey // own key for ecdsa authentication and signing
+	peerkey            *ecdsa.PublicKey  // key of the other side for ecdsa authentication and signature verification
+	agreekey           *ecdsa.PrivateKey // own static key agreement key
+	agreepeerkey       *ecdsa.PublicKey  // static key agreement key of the other side
+	authenticator      Authenticator     // custom mechanism, nil means built-in ones
 }
 
+// dedicated key used for ded-ciphering of the association, it is not sent in the initiate request (only the generated one
+// by AutoDedicatedKey is), nil means global key only
 func (d *DlmsSettings) SetDedicatedKey(key []byte) (err error) {
 	if key == nil {
 		d.dedgcm = nil
+		d.dedicatedkey = nil
+		d.usededicatedkey = false
 	} else {
-		d.dedgcm, err = gcm.NewGCM(key, d.akcopy)
+		if d.keyprovider != nil {
+			d.dedgcm, err = d.keyprovider.Gcm(d.peersystemtitle, key)
+		} else {
+			d.dedgcm, err = gcm.NewGCM(key, d.akcopy)
+		}
 		d.dedicatedkey = newcopy(key) // regardless error
 	}
 	return
 }
 
+// random dedicated key for a single association, length is given by the security suite
+func (d *DlmsSettings) generatededicatedkey() error {
+	if d.gcm == nil || d.Security&SecurityEncryption == 0 {
+		return fmt.Errorf("dedicated key requires ciphering with encryption")
+	}
+	key := make([]byte, 16)
+	if d.SecuritySuite == SecuritySuite2 {
+		key = make([]byte, 32)
+	}
+	defer clear(key)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("unable to generate dedicated key: %w", err)
+	}
+	if err := d.SetDedicatedKey(key); err != nil {
+		return err
+	}
+	d.usededicatedkey = true // sent in the initiate request
+	return nil
+}
+
+// key is zeroized, expanded key inside the dropped aes cipher cant be reached
+func (d *DlmsSettings) cleardedicatedkey() {
+	clear(d.dedicatedkey)
+	d.dedicatedkey = nil
+	d.dedgcm = nil
+	d.usededicatedkey = false
+}
+
+// suite 2 requires 256 bit keys, suites 0 and 1 128 bit ones
+func (d *DlmsSettings) SetSecuritySuite(suite SecuritySuite) error {
+	kl := 16
+	switch suite {
+	case SecuritySuite0, SecuritySuite1:
+	case SecuritySuite2:
+		kl = 32
+	default:
+		return fmt.Errorf("unsupported security suite: %d", suite)
+	}
+	if d.ekcopy != nil && len(d.ekcopy) != kl {
+		return fmt.Errorf("security suite %d requires %d bytes long keys", suite, kl)
+	}
+	if d.akcopy != nil && len(d.akcopy) != kl {
+		return fmt.Errorf("security suite %d requires %d bytes long keys", suite, kl)
+	}
+	if d.dedicatedkey != nil && len(d.dedicatedkey) != kl {
+		return fmt.Errorf("security suite %d requires %d bytes long keys", suite, kl)
+	}
+	d.SecuritySuite = suite
+	return nil
+}
+
+// security control byte of ciphered apdus
+func (d *DlmsSettings) sc() byte {
+	return byte(d.Security) | byte(d.SecuritySuite)
+}
+
 func NewSettingsWithLowAuthenticationSN(password string) (*DlmsSettings, error) {
 	if len(password) == 0 {
 		return nil, fmt.Errorf("password is empty")
@@ -138,7 +267,7 @@ func NewSettingsWithLowAuthenticationSN(password string) (*DlmsSettings, error)
 		applicationContext: ApplicationContextSNNoCiphering,
 		password:           []byte(password),
 		ConformanceBlock: ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
-			ConformanceBlockRead | ConformanceBlockWrite | ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences,
+			ConformanceBlockRead | ConformanceBlockWrite | ConformanceBlockUnconfirmedWrite | ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences,
 	}, nil
 }
 
@@ -170,7 +299,7 @@ func NewSettingsNoAuthenticationLN() (*DlmsSettings, error) {
 	}, nil
 }
 
-func NewSettingsWithGmacLN(systemtitle []byte, ek []byte, ak []byte, ctoshash []byte, fc uint32) (*DlmsSettings, error) {
+func newgmacsettings(systemtitle []byte, ek []byte, ak []byte, ctoshash []byte, fc uint32) (*DlmsSettings, error) {
 	if len(systemtitle) != 8 {
 		return nil, fmt.Errorf("systemtitle has to be 8 bytes long")
 	}
@@ -182,20 +311,130 @@ func NewSettingsWithGmacLN(systemtitle []byte, ek []byte, ak []byte, ctoshash []
 		return nil, err
 	}
 	ret := DlmsSettings{
-		authentication:     AuthenticationHighGmac,
-		applicationContext: ApplicationContextLNCiphering,
+		authentication: AuthenticationHighGmac,
+		systemtitle:    newcopy(systemtitle),
+		gcm:            g,
+		ekcopy:         newcopy(ek),
+		akcopy:         newcopy(ak), // this is sad...
+		password:       newcopy(ctoshash),
+		framecounter:   fc,
+		Security:       SecurityEncryption | SecurityAuthentication,
+	}
+	ret.CtoS = ret.password // just reference
+	return &ret, nil
+}
+
+func NewSettingsWithGmacLN(systemtitle []byte, ek []byte, ak []byte, ctoshash []byte, fc uint32) (*DlmsSettings, error) {
+	ret, err := newgmacsettings(systemtitle, ek, ak, ctoshash, fc)
+	if err != nil {
+		return nil, err
+	}
+	ret.applicationContext = ApplicationContextLNCiphering
+	ret.HighPriority = true
+	ret.ConfirmedRequests = true
+	ret.ConformanceBlock = ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
+		ConformanceBlockBlockTransferWithAction | ConformanceBlockAction | ConformanceBlockGet | ConformanceBlockSet |
+		ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences | ConformanceBlockAttribute0SupportedWithGet |
+		ConformanceBlockGeneralProtection
+	return ret, nil
+}
+
+// gmac with ciphered SN context, reply_to_HLS_authentication is invoked by SNAuthentication
+func NewSettingsWithGmacSN(systemtitle []byte, ek []byte, ak []byte, ctoshash []byte, fc uint32) (*DlmsSettings, error) {
+	ret, err := newgmacsettings(systemtitle, ek, ak, ctoshash, fc)
+	if err != nil {
+		return nil, err
+	}
+	ret.applicationContext = ApplicationContextSNCiphering
+	ret.ConformanceBlock = ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
+		ConformanceBlockRead | ConformanceBlockWrite | ConformanceBlockUnconfirmedWrite | ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences |
+		ConformanceBlockParametrizedAccess | ConformanceBlockGeneralProtection
+	return ret, nil
+}
+
+func newhlssettings(mechanism Authentication, secret []byte, challenge []byte, systemtitle []byte) (*DlmsSettings, error) {
+	if !ishashhls(mechanism) {
+		return nil, fmt.Errorf("unsupported authentication mechanism: %v", mechanism)
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret is empty")
+	}
+	if len(challenge) < 8 || len(challenge) > 64 {
+		return nil, fmt.Errorf("challenge has to be 8 to 64 bytes long")
+	}
+	if mechanism == AuthenticationHighSha256 && len(systemtitle) != 8 {
+		return nil, fmt.Errorf("systemtitle has to be 8 bytes long")
+	}
+	ret := DlmsSettings{
+		authentication: mechanism,
+		hlssecret:      newcopy(secret),
+		password:       newcopy(challenge),
+	}
+	if systemtitle != nil {
+		ret.systemtitle = newcopy(systemtitle)
+	}
+	ret.CtoS = ret.password // just reference
+	return &ret, nil
+}
+
+// hls with MD5, SHA-1 or SHA-256 mechanism, challenge is own challenge (CtoS), systemtitle is required only by SHA-256
+func NewSettingsWithHlsLN(mechanism Authentication, secret []byte, challenge []byte, systemtitle []byte) (*DlmsSettings, error) {
+	ret, err := newhlssettings(mechanism, secret, challenge, systemtitle)
+	if err != nil {
+		return nil, err
+	}
+	ret.applicationContext = ApplicationContextLNNoCiphering
+	ret.HighPriority = true
+	ret.ConfirmedRequests = true
+	ret.ConformanceBlock = ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
+		ConformanceBlockBlockTransferWithAction | ConformanceBlockAction | ConformanceBlockGet | ConformanceBlockSet |
+		ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences | ConformanceBlockAttribute0SupportedWithGet
+	return ret, nil
+}
+
+// hls with MD5, SHA-1 or SHA-256 mechanism, challenge is own challenge (CtoS), systemtitle is required only by SHA-256
+func NewSettingsWithHlsSN(mechanism Authentication, secret []byte, challenge []byte, systemtitle []byte) (*DlmsSettings, error) {
+	ret, err := newhlssettings(mechanism, secret, challenge, systemtitle)
+	if err != nil {
+		return nil, err
+	}
+	ret.applicationContext = ApplicationContextSNNoCiphering
+	ret.ConformanceBlock = ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
+		ConformanceBlockRead | ConformanceBlockWrite | ConformanceBlockUnconfirmedWrite | ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences |
+		ConformanceBlockParametrizedAccess
+	return ret, nil
+}
+
+// hls with ECDSA mechanism, key is own signing key, serverkey is the public key of the server, both P-256 or P-384,
+// challenge is own challenge (CtoS)
+func NewSettingsWithEcdsaLN(systemtitle []byte, challenge []byte, key *ecdsa.PrivateKey, serverkey *ecdsa.PublicKey) (*DlmsSettings, error) {
+	if len(systemtitle) != 8 {
+		return nil, fmt.Errorf("systemtitle has to be 8 bytes long")
+	}
+	if len(challenge) < 32 || len(challenge) > 64 {
+		return nil, fmt.Errorf("challenge has to be 32 to 64 bytes long")
+	}
+	if key == nil || serverkey == nil {
+		return nil, fmt.Errorf("both keys have to be set")
+	}
+	if _, _, err := ecdsaparams(key.Curve); err != nil {
+		return nil, err
+	}
+	if _, _, err := ecdsaparams(serverkey.Curve); err != nil {
+		return nil, err
+	}
+	ret := DlmsSettings{
+		authentication:     AuthenticationHighEcdsa,
+		applicationContext: ApplicationContextLNNoCiphering,
 		HighPriority:       true,
 		ConfirmedRequests:  true,
 		ConformanceBlock: ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
 			ConformanceBlockBlockTransferWithAction | ConformanceBlockAction | ConformanceBlockGet | ConformanceBlockSet |
-			ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences | ConformanceBlockAttribute0SupportedWithGet |
-			ConformanceBlockGeneralProtection,
-		systemtitle:  newcopy(systemtitle),
-		gcm:          g,
-		akcopy:       newcopy(ak), // this is sad...
-		password:     newcopy(ctoshash),
-		framecounter: fc,
-		Security:     SecurityEncryption | SecurityAuthentication,
+			ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences | ConformanceBlockAttribute0SupportedWithGet,
+		systemtitle: newcopy(systemtitle),
+		password:    newcopy(challenge),
+		signkey:     key,
+		peerkey:     serverkey,
 	}
 	ret.CtoS = ret.password // just reference
 	return &ret, nil
@@ -239,6 +478,7 @@ func (d *dlmsal) Close() error {
 	}
 	_, err = d.smallreadout() // yes, this is bullshit
 	d.isopen = false
+	d.dropsessionkeys()
 	if err != nil { // just ignore data itself as simulator returns some weird shit (based on e650 maybe)
 		return err
 	}
@@ -248,9 +488,18 @@ func (d *dlmsal) Close() error {
 
 func (d *dlmsal) Disconnect() error {
 	d.isopen = false
+	d.dropsessionkeys()
 	return d.transport.Disconnect()
 }
 
+// generated dedicated key and keys resolved by the key provider live only during the association
+func (d *dlmsal) dropsessionkeys() {
+	if d.settings.AutoDedicatedKey {
+		d.settings.cleardedicatedkey()
+	}
+	d.settings.dropkeys()
+}
+
 func (d *dlmsal) smallreadout() ([]byte, error) {
 	// safely use already existing buffer, it could fail if aare is bigger than it, but it can be solved later
 	total := 0
@@ -277,7 +526,7 @@ func (d *dlmsal) smallreadout() ([]byte, error) {
 }
 
 func (d *dlmsal) logstate(st bool) bool {
-	switch d.settings.authentication {
+	switch d.authenticator().Mechanism() {
 	case AuthenticationLow:
 		if st {
 			d.transport.SetLogger(d.logger)
@@ -294,6 +543,30 @@ func (d *dlmsal) Open() error { // login and shits
 	if d.isopen {
 		return nil
 	}
+	if d.settings.FrameCounterHook != nil {
+		fc, err := d.settings.FrameCounterHook()
+		if err != nil {
+			return fmt.Errorf("unable to get invocation counter: %w", err)
+		}
+		if fc > d.settings.framecounter {
+			d.settings.SetFrameCounter(fc)
+		}
+	}
+	defer func() {
+		if !d.isopen { // failed association
+			d.dropsessionkeys()
+		}
+	}()
+	if d.settings.keyprovider != nil {
+		if err := d.settings.resolvekeys(); err != nil {
+			return err
+		}
+	}
+	if d.settings.AutoDedicatedKey {
+		if err := d.settings.generatededicatedkey(); err != nil {
+			return err
+		}
+	}
 	if err := d.transport.Open(); err != nil {
 		return err
 	}
@@ -355,7 +628,7 @@ func (d *dlmsal) Open() error { // login and shits
 	}
 
 	if d.aareres.confirmedServiceError != nil {
-		return fmt.Errorf("confirmed service error: %v", d.aareres.confirmedServiceError.ConfirmedServiceError)
+		return d.aareres.confirmedServiceError
 	}
 	if d.aareres.ApplicationContextName != d.settings.applicationContext {
 		return fmt.Errorf("application contextes differ: %v != %v", d.aareres.ApplicationContextName, d.settings.applicationContext)
@@ -374,7 +647,11 @@ func (d *dlmsal) Open() error { // login and shits
 	if d.aareres.initiateResponse == nil {
 		return fmt.Errorf("no initiate response, error probably")
 	}
+	if err = d.authenticator().CheckAARE(d.authcontext()); err != nil {
+		return err
+	}
 	d.maxPduSendSize = int(d.aareres.initiateResponse.ServerMaxReceivePduSize)
+	d.gbt = gbtstate{}
 	d.logf("Max PDU size: %v, Vaa: %v", d.maxPduSendSize, d.aareres.initiateResponse.VAAddress)
 
 	d.settings.VAAddress = d.aareres.initiateResponse.VAAddress // returning from interface, a bit hacky yes
@@ -1,15 +1,25 @@
 package dlmsal
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
 )
 
 // tag is common byte in this case, could be also 9 for octetstring and so on, it encodes also length
-func (d *dlmsal) encryptpacket(tag byte, apdu []byte, ded bool) []byte {
+func (d *dlmsal) encryptpacket(tag byte, apdu []byte, ded bool) ([]byte, error) {
 	s := d.settings
+	fc, err := s.nextframecounter()
+	if err != nil {
+		return nil, err
+	}
 	// lets panic in case of nil gcm -> program fault shouldnt happen at all
-	wl, _ := s.gcm.GetEncryptLength(byte(s.Security), apdu)
+	sc := s.sc()
+	wl, _ := s.gcm.GetEncryptLength(sc, apdu)
 	if cap(d.cryptbuffer) < wl+11 {
 		d.cryptbuffer = make([]byte, wl+11)
 	} else {
@@ -18,33 +28,46 @@ func (d *dlmsal) encryptpacket(tag byte, apdu []byte, ded bool) []byte {
 	d.cryptbuffer[0] = tag
 	off := encodelength2(d.cryptbuffer[1:], uint(wl+5))
 	off++
-	d.cryptbuffer[off] = byte(s.Security)
+	d.cryptbuffer[off] = sc
 	off++
-	d.cryptbuffer[off] = byte(s.framecounter >> 24) // yeah yeah, binary.BigEndian blabla
+	d.cryptbuffer[off] = byte(fc >> 24) // yeah yeah, binary.BigEndian blabla
 	off++
-	d.cryptbuffer[off] = byte(s.framecounter >> 16)
+	d.cryptbuffer[off] = byte(fc >> 16)
 	off++
-	d.cryptbuffer[off] = byte(s.framecounter >> 8)
+	d.cryptbuffer[off] = byte(fc >> 8)
 	off++
-	d.cryptbuffer[off] = byte(s.framecounter)
+	d.cryptbuffer[off] = byte(fc)
 	off++
 
 	// in this state, encrypt cant remake input reusable buffer
 	if ded {
-		_, _ = s.dedgcm.Encrypt(d.cryptbuffer[off:], byte(s.Security), s.framecounter, s.systemtitle, apdu) // this is weird and needs to be tested well
+		_, _ = s.dedgcm.Encrypt(d.cryptbuffer[off:], sc, fc, s.systemtitle, apdu) // this is weird and needs to be tested well
 	} else {
-		_, _ = s.gcm.Encrypt(d.cryptbuffer[off:], byte(s.Security), s.framecounter, s.systemtitle, apdu)
+		_, _ = s.gcm.Encrypt(d.cryptbuffer[off:], sc, fc, s.systemtitle, apdu)
 	}
-	s.framecounter++
-	return d.cryptbuffer[:off+wl]
+	return d.cryptbuffer[:off+wl], nil
 }
 
-func (d *dlmsal) decryptpacket(apdu []byte, ded bool) (ret []byte, err error) { // not checking expected fc, just receive everything
+// security of the received apdu has to be at least the own policy, so the other side cant downgrade it
+func (d *DlmsSettings) checksecurity(sc byte) error {
+	if sc&byte(d.Security) != byte(d.Security) {
+		return fmt.Errorf("security %02x of the received apdu doesnt meet the security policy %02x", sc&0x30, byte(d.Security))
+	}
+	return nil
+}
+
+func (d *dlmsal) decryptpacket(apdu []byte, ded bool) (ret []byte, err error) {
 	if len(apdu) < 5 {
 		return nil, fmt.Errorf("invalid apdu length")
 	}
 	s := d.settings
+	if err = s.checksecurity(apdu[0]); err != nil {
+		return nil, err
+	}
 	fc := binary.BigEndian.Uint32(apdu[1:])
+	if err = d.checkreplay(d.aareres.SystemTitle, fc); err != nil {
+		return nil, err
+	}
 	if ded {
 		if s.dedgcm == nil {
 			return nil, fmt.Errorf("no dedicated gcm set for ciphering")
@@ -59,5 +82,255 @@ func (d *dlmsal) decryptpacket(apdu []byte, ded bool) (ret []byte, err error) {
 	if err != nil {
 		return nil, err
 	}
+	s.acceptframecounter(d.aareres.SystemTitle, fc)
 	return d.cryptbuffer, nil
 }
+
+// bytes reserved for ciphering and signing in a single pdu, general apdus carry more fields than the service specific ones
+func (d *dlmsal) cipheroverhead() int {
+	s := d.settings
+	ret := gcm.GCM_TAG_LENGTH
+	switch s.CipheredApdu {
+	case CipheredApduGeneralGloDed:
+		ret += 9 // system title
+	case CipheredApduGeneral:
+		ret += 46 + len(s.OtherInformation) // transaction-id, system titles, date-time, key-info and lengths
+		if s.KeyAgreement != KeyAgreementNone {
+			ret += 98 // agreed-key with P-384 ephemeral key instead of identified-key
+		}
+	}
+	if s.SignApdus {
+		ret += 154 + len(s.OtherInformation) // the same fields, content length and P-384 signature
+	}
+	return ret
+}
+
+// general-glo-ciphering, general-ded-ciphering or general-ciphering apdu, recipient is the system title of the other side
+func (d *dlmsal) encryptgeneral(apdu []byte, ded bool) ([]byte, error) {
+	s := d.settings
+	g := s.gcm
+	if ded {
+		g = s.dedgcm
+	}
+	if g == nil {
+		return nil, fmt.Errorf("no gcm set for ciphering")
+	}
+	sc := s.sc()
+	var out bytes.Buffer
+	var aad []byte
+	var err error
+	switch {
+	case s.CipheredApdu == CipheredApduGeneral:
+		if len(d.aareres.SystemTitle) != 8 {
+			return nil, fmt.Errorf("system title of the other side is required for general ciphering")
+		}
+		out.WriteByte(byte(TagGeneralCiphering))
+		var tid [8]byte
+		binary.BigEndian.PutUint64(tid[:], s.transactionid)
+		s.transactionid++
+		var dt []byte
+		if s.GeneralDateTime {
+			var b bytes.Buffer
+			t := NewDlmsDateTimeFromTime(time.Now())
+			t.EncodeToDlms(&b)
+			dt = b.Bytes()[1:]
+		}
+		// transaction-id, originator, recipient, date-time and other-information, all of them are authenticated
+		for _, f := range [][]byte{tid[:], s.systemtitle, d.aareres.SystemTitle, dt, s.OtherInformation} {
+			encodelength(&out, uint(len(f)))
+			out.Write(f)
+			aad = append(aad, f...)
+		}
+		if s.KeyAgreement == KeyAgreementNone {
+			out.Write([]byte{1, 0, 0}) // key-info, identified-key, global-unicast-encryption-key
+			break
+		}
+		var ephemeral []byte
+		g, ephemeral, err = s.sendagreedgcm(d.aareres.SystemTitle, tid[:])
+		if err != nil {
+			return nil, err
+		}
+		if z, ok := g.(zeroizer); ok {
+			defer z.Zeroize()
+		}
+		out.Write([]byte{1, 2, 1, byte(s.KeyAgreement)}) // key-info, agreed-key, key-parameters
+		encodelength(&out, uint(len(ephemeral)))         // key-ciphered-data
+		out.Write(ephemeral)
+	case ded:
+		out.WriteByte(byte(TagGeneralDedCiphering))
+		encodelength(&out, uint(len(s.systemtitle)))
+		out.Write(s.systemtitle)
+	default:
+		out.WriteByte(byte(TagGeneralGloCiphering))
+		encodelength(&out, uint(len(s.systemtitle)))
+		out.Write(s.systemtitle)
+	}
+
+	wl, err := g.GetEncryptLength(sc, apdu)
+	if err != nil {
+		return nil, err
+	}
+	fc, err := s.nextframecounter()
+	if err != nil {
+		return nil, err
+	}
+	encodelength(&out, uint(wl+5))
+	out.WriteByte(sc)
+	out.WriteByte(byte(fc >> 24))
+	out.WriteByte(byte(fc >> 16))
+	out.WriteByte(byte(fc >> 8))
+	out.WriteByte(byte(fc))
+	d.cryptbuffer, err = g.EncryptWithAad(d.cryptbuffer, sc, fc, s.systemtitle, aad, apdu)
+	if err != nil {
+		return nil, err
+	}
+	out.Write(d.cryptbuffer)
+	return out.Bytes(), nil
+}
+
+// received general ciphered apdu
+type generalciphered struct {
+	ded           bool
+	systitle      []byte // originator
+	transactionid []byte
+	aad           []byte             // fields of general-ciphering
+	agreement     KeyAgreementScheme // agreed-key of general-ciphering
+	keydata       []byte             // key-ciphered-data of agreed-key
+	content       []byte             // SC, frame counter and ciphered apdu
+}
+
+// decodes general-glo-ciphering, general-ded-ciphering or general-ciphering, tag is already read
+func decodegeneralciphering(tag CosemTag, src *bytes.Buffer, tmp *tmpbuffer) (out generalciphered, err error) {
+	switch tag {
+	case TagGeneralGloCiphering, TagGeneralDedCiphering:
+		out.ded = tag == TagGeneralDedCiphering
+		out.systitle, err = readoctetstring(src, tmp)
+		if err != nil {
+			return
+		}
+	case TagGeneralCiphering:
+		// transaction-id, originator, recipient, date-time and other-information, all of them are authenticated
+		for i := 0; i < 5; i++ {
+			var f []byte
+			f, err = readoctetstring(src, tmp)
+			if err != nil {
+				return
+			}
+			switch i {
+			case 0:
+				out.transactionid = f
+			case 1:
+				out.systitle = f
+			}
+			out.aad = append(out.aad, f...)
+		}
+		err = decodekeyinfo(src, tmp, &out)
+		if err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("unexpected general ciphering tag: %02x", byte(tag))
+		return
+	}
+	out.content, err = readoctetstring(src, tmp)
+	if err == nil && len(out.content) < 5 {
+		err = fmt.Errorf("invalid ciphered content length")
+	}
+	return
+}
+
+// identified global unicast key or agreed key are supported, wrapped key isnt, no key info means the key known
+// by the context, so also the global one
+func decodekeyinfo(src *bytes.Buffer, tmp *tmpbuffer, out *generalciphered) error {
+	_, err := io.ReadFull(src, tmp[:1])
+	if err != nil {
+		return err
+	}
+	if tmp[0] == 0 {
+		return nil
+	}
+	_, err = io.ReadFull(src, tmp[:1])
+	if err != nil {
+		return err
+	}
+	switch tmp[0] {
+	case 0: // identified-key
+		_, err = io.ReadFull(src, tmp[:1])
+		if err != nil {
+			return err
+		}
+		if tmp[0] != 0 { // global-unicast-encryption-key
+			return fmt.Errorf("unsupported key id: %d", tmp[0])
+		}
+	case 2: // agreed-key
+		params, err := readoctetstring(src, tmp)
+		if err != nil {
+			return err
+		}
+		if len(params) != 1 || (KeyAgreementScheme(params[0]) != KeyAgreementOnePass && KeyAgreementScheme(params[0]) != KeyAgreementStaticUnifiedModel) {
+			return fmt.Errorf("unsupported key parameters: %x", params)
+		}
+		out.agreement = KeyAgreementScheme(params[0])
+		out.keydata, err = readoctetstring(src, tmp)
+		return err
+	default:
+		return fmt.Errorf("unsupported key info: %d", tmp[0])
+	}
+	return nil
+}
+
+func readoctetstring(src *bytes.Buffer, tmp *tmpbuffer) ([]byte, error) {
+	l, _, err := decodelength(src, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if l > uint(src.Len()) {
+		return nil, fmt.Errorf("octet string longer than the apdu")
+	}
+	return src.Next(int(l)), nil
+}
+
+// decrypts general ciphered apdu received as the answer, the whole apdu is read into memory
+func (d *dlmsal) recvgeneralpdu(src io.Reader, rtag CosemTag) (tag CosemTag, str io.Reader, err error) {
+	tag = rtag
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return
+	}
+	gc, err := decodegeneralciphering(rtag, bytes.NewBuffer(data), &d.tmpbuffer)
+	if err != nil {
+		return
+	}
+	s := d.settings
+	g := s.gcm
+	switch {
+	case gc.ded:
+		g = s.dedgcm
+	case gc.agreement != KeyAgreementNone:
+		if g, err = s.recvagreedgcm(&gc); err != nil {
+			return
+		}
+		if z, ok := g.(zeroizer); ok {
+			defer z.Zeroize()
+		}
+	}
+	if g == nil {
+		return tag, nil, fmt.Errorf("no ciphering set for %v", rtag)
+	}
+	if err = s.checksecurity(gc.content[0]); err != nil {
+		return
+	}
+	fc := binary.BigEndian.Uint32(gc.content[1:])
+	if err = d.checkreplay(gc.systitle, fc); err != nil {
+		return
+	}
+	plain, err := g.DecryptWithAad(nil, gc.content[0], fc, gc.systitle, gc.aad, gc.content[5:]) // not reused, stream can outlive next request
+	if err != nil {
+		return
+	}
+	s.acceptframecounter(gc.systitle, fc)
+	if len(plain) == 0 {
+		return tag, nil, fmt.Errorf("empty ciphered apdu")
+	}
+	return CosemTag(plain[0]), bytes.NewReader(plain[1:]), nil
+}
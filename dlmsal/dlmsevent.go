@@ -0,0 +1,149 @@
+package dlmsal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// unsolicited event-notification sent by the server inside the association (LN)
+type EventNotification struct {
+	Time      *DlmsDateTime // nil if not present
+	ClassId   uint16
+	Obis      DlmsObis
+	Attribute int8
+	Value     DlmsData
+}
+
+// unsolicited information-report sent by the server inside the association (SN)
+type InformationReport struct {
+	Time      *DlmsDateTime // nil if not present
+	Variables []int16       // variable names, values are in the same order
+	Values    []DlmsData
+}
+
+// handler is called while waiting for the response of the request, nil handler means the notifications are dropped
+func (d *dlmsal) SetEventHandler(handler func(e *EventNotification)) {
+	d.eventhandler = handler
+}
+
+// handler is called while waiting for the response of the request, nil handler means the reports are dropped
+func (d *dlmsal) SetInformationReportHandler(handler func(r *InformationReport)) {
+	d.reporthandler = handler
+}
+
+func isunsolicited(tag CosemTag) bool {
+	return tag == TagEventNotificationRequest || tag == TagInformationReportRequest
+}
+
+// decodes unsolicited apdu and passes it to the handler, the rest of the apdu is skipped
+func (d *dlmsal) unsolicited(tag CosemTag, src io.Reader) error {
+	switch tag {
+	case TagEventNotificationRequest:
+		e, err := decodeEventNotification(src, &d.tmpbuffer)
+		if err != nil {
+			return fmt.Errorf("unable to decode event notification: %w", err)
+		}
+		if d.eventhandler != nil {
+			d.eventhandler(e)
+		} else {
+			d.logf("event notification of %s attribute %d dropped", e.Obis.String(), e.Attribute)
+		}
+	case TagInformationReportRequest:
+		r, err := decodeInformationReport(src, &d.tmpbuffer)
+		if err != nil {
+			return fmt.Errorf("unable to decode information report: %w", err)
+		}
+		if d.reporthandler != nil {
+			d.reporthandler(r)
+		} else {
+			d.logf("information report of %d variables dropped", len(r.Variables))
+		}
+	}
+	_, err := io.Copy(io.Discard, src)
+	return err
+}
+
+// time is optional octet string, anything else than date-time is ignored
+func decodeoptionaltime(src io.Reader, tmp *tmpbuffer) (*DlmsDateTime, error) {
+	_, err := io.ReadFull(src, tmp[:1])
+	if err != nil {
+		return nil, err
+	}
+	if tmp[0] == 0 {
+		return nil, nil
+	}
+	l, _, err := decodelength(src, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if l != 12 {
+		_, err = io.CopyN(io.Discard, src, int64(l))
+		return nil, err
+	}
+	_, err = io.ReadFull(src, tmp[:12])
+	if err != nil {
+		return nil, err
+	}
+	dt, err := NewDlmsDateTimeFromSlice(tmp[:12])
+	if err != nil {
+		return nil, err
+	}
+	return &dt, nil
+}
+
+func decodeEventNotification(src io.Reader, tmp *tmpbuffer) (e *EventNotification, err error) {
+	e = &EventNotification{}
+	e.Time, err = decodeoptionaltime(src, tmp)
+	if err != nil {
+		return
+	}
+	_, err = io.ReadFull(src, tmp[:9])
+	if err != nil {
+		return
+	}
+	e.ClassId = binary.BigEndian.Uint16(tmp[:])
+	e.Obis, _ = NewDlmsObisFromSlice(tmp[2:8])
+	e.Attribute = int8(tmp[8])
+	e.Value, _, err = decodeDataTag(src, tmp)
+	return
+}
+
+// only variable-name access is supported
+func decodeInformationReport(src io.Reader, tmp *tmpbuffer) (r *InformationReport, err error) {
+	r = &InformationReport{}
+	r.Time, err = decodeoptionaltime(src, tmp)
+	if err != nil {
+		return
+	}
+	l, _, err := decodelength(src, tmp)
+	if err != nil {
+		return
+	}
+	r.Variables = make([]int16, 0, min(l, 64)) // received length isnt trusted, slice grows with received variables
+	for i := uint(0); i < l; i++ {
+		_, err = io.ReadFull(src, tmp[:3])
+		if err != nil {
+			return
+		}
+		if tmp[0] != 2 {
+			return nil, fmt.Errorf("unsupported variable access specification: %d", tmp[0])
+		}
+		r.Variables = append(r.Variables, int16(binary.BigEndian.Uint16(tmp[1:])))
+	}
+	l, _, err = decodelength(src, tmp)
+	if err != nil {
+		return
+	}
+	if int(l) != len(r.Variables) {
+		return nil, fmt.Errorf("different amount of data received")
+	}
+	r.Values = make([]DlmsData, l) // bounded by the received variables
+	for i := range r.Values {
+		r.Values[i], _, err = decodeDataTag(src, tmp)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
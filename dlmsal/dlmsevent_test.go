@@ -0,0 +1,40 @@
+package dlmsal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeInformationReport(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"two variables", []byte{0, 2, 2, 0x01, 0x00, 2, 0x01, 0x08, 2, byte(TagUnsigned), 5, byte(TagLongUnsigned), 0, 7}, true},
+		{"huge variable count", []byte{0, 0x84, 0xff, 0xff, 0xff, 0xff, 2, 0x01, 0x00}, false},
+		{"different amount of values", []byte{0, 1, 2, 0x01, 0x00, 2, byte(TagUnsigned), 5, byte(TagUnsigned), 6}, false},
+		{"unsupported access", []byte{0, 1, 1, 0x01, 0x00, 1, byte(TagUnsigned), 5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tmp tmpbuffer
+			r, err := decodeInformationReport(bytes.NewBuffer(tt.data), &tmp)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("report decoded: %+v", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r.Variables) != 2 || r.Variables[0] != 0x100 || r.Variables[1] != 0x108 {
+				t.Errorf("unexpected variables %v", r.Variables)
+			}
+			if len(r.Values) != 2 || r.Values[0].Value != uint8(5) || r.Values[1].Value != uint16(7) {
+				t.Errorf("unexpected values %v", r.Values)
+			}
+		})
+	}
+}
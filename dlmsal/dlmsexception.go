@@ -1,25 +1,221 @@
 package dlmsal
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 )
 
-func decodeException(src io.Reader, tmp *tmpbuffer) (e DlmsData, err error) {
-	var n int
-	n, err = io.ReadFull(src, tmp[:2])
-	switch n {
-	case 0:
-		e = NewDlmsDataError(TagResultOtherReason)
-	case 1, 2:
-		e = NewDlmsDataError(TagResultOtherReason) // not decoding state-error or service-error
-	default:
-		panic("programatic error, unexpected read bytes count")
+type stateErrorTag byte
+
+const (
+	TagStateErrorNone              stateErrorTag = 0 // not received
+	TagStateErrorServiceNotAllowed stateErrorTag = 1
+	TagStateErrorServiceUnknown    stateErrorTag = 2
+)
+
+type exceptionServiceErrorTag byte
+
+const (
+	TagExceptionServiceErrorNone       exceptionServiceErrorTag = 0 // not received
+	TagExceptionOperationNotPossible   exceptionServiceErrorTag = 1
+	TagExceptionServiceNotSupported    exceptionServiceErrorTag = 2
+	TagExceptionOtherReason            exceptionServiceErrorTag = 3
+	TagExceptionPduTooLong             exceptionServiceErrorTag = 4
+	TagExceptionDecipheringError       exceptionServiceErrorTag = 5
+	TagExceptionInvocationCounterError exceptionServiceErrorTag = 6
+)
+
+// exception-response of the server, the whole request failed
+type ExceptionError struct {
+	StateError        stateErrorTag
+	ServiceError      exceptionServiceErrorTag
+	InvocationCounter uint32 // expected invocation counter in case of invocation counter error
+}
+
+func (e *ExceptionError) Error() string {
+	if e.ServiceError == TagExceptionInvocationCounterError {
+		return fmt.Sprintf("exception response: %s, %s, expected invocation counter %d", e.StateError, e.ServiceError, e.InvocationCounter)
 	}
-	if err != nil {
-		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-			err = nil
+	return fmt.Sprintf("exception response: %s, %s", e.StateError, e.ServiceError)
+}
+
+// exception was reported as data access error with other reason before, so it is still matched that way
+func (e *ExceptionError) Unwrap() error {
+	return NewDlmsError(TagResultOtherReason)
+}
+
+func (s stateErrorTag) String() string {
+	switch s {
+	case TagStateErrorNone:
+		return "no state-error"
+	case TagStateErrorServiceNotAllowed:
+		return "service-not-allowed"
+	case TagStateErrorServiceUnknown:
+		return "service-unknown"
+	}
+	return fmt.Sprintf("unknown state-error %d", byte(s))
+}
+
+func (s exceptionServiceErrorTag) String() string {
+	switch s {
+	case TagExceptionServiceErrorNone:
+		return "no service-error"
+	case TagExceptionOperationNotPossible:
+		return "operation-not-possible"
+	case TagExceptionServiceNotSupported:
+		return "service-not-supported"
+	case TagExceptionOtherReason:
+		return "other-reason"
+	case TagExceptionPduTooLong:
+		return "pdu-too-long"
+	case TagExceptionDecipheringError:
+		return "deciphering-error"
+	case TagExceptionInvocationCounterError:
+		return "invocation-counter-error"
+	}
+	return fmt.Sprintf("unknown service-error %d", byte(s))
+}
+
+// returns *ExceptionError, some units send shorter exception, so missing parts are tolerated
+func decodeException(src io.Reader, tmp *tmpbuffer) error {
+	e := &ExceptionError{StateError: TagStateErrorNone, ServiceError: TagExceptionServiceErrorNone}
+	n, err := io.ReadFull(src, tmp[:2])
+	if n > 0 {
+		e.StateError = stateErrorTag(tmp[0])
+	}
+	if n > 1 {
+		e.ServiceError = exceptionServiceErrorTag(tmp[1])
+	}
+	if err == nil && e.ServiceError == TagExceptionInvocationCounterError {
+		_, err = io.ReadFull(src, tmp[:4])
+		if err == nil {
+			e.InvocationCounter = binary.BigEndian.Uint32(tmp[:])
 		}
 	}
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return e
+}
+
+type confirmedServiceErrorTag byte
+
+const (
+	TagErrInitiateError        confirmedServiceErrorTag = 1
+	TagErrGetStatus            confirmedServiceErrorTag = 2
+	TagErrGetNameList          confirmedServiceErrorTag = 3
+	TagErrGetVariableAttribute confirmedServiceErrorTag = 4
+	TagErrRead                 confirmedServiceErrorTag = 5
+	TagErrWrite                confirmedServiceErrorTag = 6
+	TagErrGetDataSetAttribute  confirmedServiceErrorTag = 7
+	TagErrGetTIAttribute       confirmedServiceErrorTag = 8
+	TagErrChangeScope          confirmedServiceErrorTag = 9
+	TagErrStart                confirmedServiceErrorTag = 10
+	TagErrStop                 confirmedServiceErrorTag = 11
+	TagErrResume               confirmedServiceErrorTag = 12
+	TagErrMakeUsable           confirmedServiceErrorTag = 13
+	TagErrInitiateLoad         confirmedServiceErrorTag = 14
+	TagErrLoadSegment          confirmedServiceErrorTag = 15
+	TagErrTerminateLoad        confirmedServiceErrorTag = 16
+	TagErrInitiateUpLoad       confirmedServiceErrorTag = 17
+	TagErrUpLoadSegment        confirmedServiceErrorTag = 18
+	TagErrTerminateUpLoad      confirmedServiceErrorTag = 19
+)
+
+type serviceErrorTag byte
+
+const (
+	TagErrApplicationReference serviceErrorTag = 0
+	TagErrHardwareResource     serviceErrorTag = 1
+	TagErrVdeStateError        serviceErrorTag = 2
+	TagErrService              serviceErrorTag = 3
+	TagErrDefinition           serviceErrorTag = 4
+	TagErrAccess               serviceErrorTag = 5
+	TagErrInitiate             serviceErrorTag = 6
+	TagErrLoadDataSet          serviceErrorTag = 7
+	TagErrChangeScopeError     serviceErrorTag = 8
+	TagErrTask                 serviceErrorTag = 9
+	TagErrOtherError           serviceErrorTag = 10
+)
+
+// confirmed-service-error of the server, e.g. refused initiate request or failed SN read/write,
+// Value is the detail of the service error, its meaning depends on ServiceError
+type ConfirmedServiceError struct {
+	Service      confirmedServiceErrorTag
+	ServiceError serviceErrorTag
+	Value        byte
+}
+
+func (e *ConfirmedServiceError) Error() string {
+	return fmt.Sprintf("confirmed service error: %s, %s", e.Service, e.detail())
+}
+
+var confirmedServiceErrorNames = [...]string{"", "initiate-error", "get-status", "get-name-list", "get-variable-attribute", "read", "write",
+	"get-data-set-attribute", "get-ti-attribute", "change-scope", "start", "stop", "resume", "make-usable", "initiate-load",
+	"load-segment", "terminate-load", "initiate-upload", "upload-segment", "terminate-upload"}
+
+func (s confirmedServiceErrorTag) String() string {
+	if s > 0 && int(s) < len(confirmedServiceErrorNames) {
+		return confirmedServiceErrorNames[s]
+	}
+	return fmt.Sprintf("unknown service %d", byte(s))
+}
+
+var serviceErrorNames = [...]string{"application-reference", "hardware-resource", "vde-state-error", "service", "definition", "access",
+	"initiate", "load-data-set", "change-scope", "task", "other"}
+
+func (s serviceErrorTag) String() string {
+	if int(s) < len(serviceErrorNames) {
+		return serviceErrorNames[s]
+	}
+	return fmt.Sprintf("unknown service-error %d", byte(s))
+}
+
+// detail enums of the service errors, only the standardized ones, the first is always other
+var serviceErrorDetails = map[serviceErrorTag][]string{
+	TagErrApplicationReference: {"other", "time-elapsed", "application-unreachable", "application-reference-invalid", "application-context-unsupported", "provider-communication-error", "deciphering-error"},
+	TagErrHardwareResource:     {"other", "memory-unavailable", "processor-resource-unavailable", "mass-storage-unavailable", "other-resource-unavailable"},
+	TagErrVdeStateError:        {"other", "no-dlms-context", "loading-data-set", "status-nochange", "status-inoperable"},
+	TagErrService:              {"other", "pdu-size", "service-unsupported"},
+	TagErrDefinition:           {"other", "object-undefined", "object-class-inconsistent", "object-attribute-inconsistent"},
+	TagErrAccess:               {"other", "scope-of-access-violated", "object-access-violated", "hardware-fault", "object-unavailable"},
+	TagErrInitiate:             {"other", "dlms-version-too-low", "incompatible-conformance", "pdu-size-too-short", "refused-by-the-vde-handler"},
+	TagErrLoadDataSet:          {"other", "primitive-out-of-sequence", "not-loadable", "dataset-size-too-large", "not-awaited-segment", "interpretation-failure", "storage-failure", "data-set-not-ready"},
+	TagErrTask:                 {"other", "no-remote-control", "ti-stopped", "ti-running", "ti-unusable"},
+}
+
+func (e *ConfirmedServiceError) detail() string {
+	if d, ok := serviceErrorDetails[e.ServiceError]; ok && int(e.Value) < len(d) {
+		return fmt.Sprintf("%s: %s", e.ServiceError, d[e.Value])
+	}
+	return fmt.Sprintf("%s: %d", e.ServiceError, e.Value)
+}
+
+func decodeConfirmedServiceError(src []byte) (out ConfirmedServiceError, err error) {
+	if len(src) < 3 {
+		err = fmt.Errorf("invalid service error length")
+		return
+	}
+
+	out.Service = confirmedServiceErrorTag(src[0])
+	out.ServiceError = serviceErrorTag(src[1])
+	out.Value = src[2]
 	return
 }
+
+// confirmed service error as the answer, tag is already read, returns *ConfirmedServiceError
+func decodeConfirmedServiceErrorPdu(src io.Reader) error {
+	var b [3]byte
+	_, err := io.ReadFull(src, b[:])
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, src)
+	if err != nil {
+		return err
+	}
+	cse, _ := decodeConfirmedServiceError(b[:])
+	return &cse
+}
@@ -0,0 +1,156 @@
+package dlmsal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDecodeException(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		exp  ExceptionError
+	}{
+		{"full", []byte{1, 2}, ExceptionError{StateError: TagStateErrorServiceNotAllowed, ServiceError: TagExceptionServiceNotSupported}},
+		{"invocation counter", []byte{1, 6, 0, 0, 1, 0}, ExceptionError{StateError: TagStateErrorServiceNotAllowed, ServiceError: TagExceptionInvocationCounterError, InvocationCounter: 256}},
+		{"missing invocation counter", []byte{1, 6}, ExceptionError{StateError: TagStateErrorServiceNotAllowed, ServiceError: TagExceptionInvocationCounterError}},
+		{"state error only", []byte{2}, ExceptionError{StateError: TagStateErrorServiceUnknown}},
+		{"empty", []byte{}, ExceptionError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tmp tmpbuffer
+			err := decodeException(bytes.NewBuffer(tt.data), &tmp)
+			var e *ExceptionError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected exception error, got %v", err)
+			}
+			if *e != tt.exp {
+				t.Errorf("expected %+v, got %+v", tt.exp, *e)
+			}
+			var de *DlmsError
+			if !errors.As(err, &de) || de.Result != TagResultOtherReason {
+				t.Errorf("exception doesnt unwrap to data access error other reason")
+			}
+		})
+	}
+}
+
+func TestDecodeConfirmedServiceError(t *testing.T) {
+	err := decodeConfirmedServiceErrorPdu(bytes.NewBuffer([]byte{5, 5, 2, 0xff}))
+	var e *ConfirmedServiceError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected confirmed service error, got %v", err)
+	}
+	if e.Service != TagErrRead || e.ServiceError != TagErrAccess || e.Value != 2 {
+		t.Errorf("unexpected %+v", *e)
+	}
+	if err.Error() != "confirmed service error: read, access: object-access-violated" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if _, err = decodeConfirmedServiceError([]byte{5, 5}); err == nil {
+		t.Errorf("short service error decoded")
+	}
+}
+
+// responses of the given tag are replaced by the apdu
+func replaceresponse(tag CosemTag, apdu []byte) func([]byte) []byte {
+	return func(m []byte) []byte {
+		if len(m) > 0 && CosemTag(m[0]) == tag {
+			return apdu
+		}
+		return m
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	obis := DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}
+	exception := []byte{byte(TagExceptionResponse), 1, 6, 0, 0, 0, 9}
+	serviceerror := []byte{byte(TagConfirmedServiceError), 5, 5, 2}
+	tests := []struct {
+		name      string
+		sn        bool
+		tag       CosemTag
+		apdu      []byte
+		call      func(c DlmsClient) error
+		exception bool
+	}{
+		{"get", false, TagGetResponse, exception, func(c DlmsClient) error {
+			_, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}})
+			return err
+		}, true},
+		{"get with list", false, TagGetResponse, exception, func(c DlmsClient) error {
+			r, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}, {ClassId: 1, Obis: obis, Attribute: 1}})
+			if r != nil { // whole list fails, no per item results
+				return fmt.Errorf("results returned: %v", r)
+			}
+			return err
+		}, true},
+		{"get list stream", false, TagGetResponse, exception, func(c DlmsClient) error {
+			s, err := c.GetListStream([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}, {ClassId: 1, Obis: obis, Attribute: 1}})
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			_, err = s.Next()
+			return err
+		}, true},
+		{"set", false, TagSetResponse, exception, func(c DlmsClient) error {
+			_, err := c.Set([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2, SetData: &DlmsData{Tag: TagUnsigned, Value: uint8(1)}}})
+			return err
+		}, true},
+		{"action", false, TagActionResponse, exception, func(c DlmsClient) error {
+			_, err := c.Action(DlmsLNRequestItem{ClassId: 1, Obis: obis, Attribute: 1})
+			return err
+		}, true},
+		{"action list", false, TagActionResponse, exception, func(c DlmsClient) error {
+			r, err := c.ActionList([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 1}, {ClassId: 1, Obis: obis, Attribute: 2}})
+			if r != nil { // whole list fails, no per item results
+				return fmt.Errorf("results returned: %v", r)
+			}
+			return err
+		}, true},
+		{"read", true, TagReadResponse, serviceerror, func(c DlmsClient) error {
+			_, err := c.Read([]DlmsSNRequestItem{{Address: 0x100}})
+			return err
+		}, false},
+		{"write", true, TagWriteResponse, serviceerror, func(c DlmsClient) error {
+			_, err := c.Write([]DlmsSNRequestItem{{Address: 0x100, WriteData: &DlmsData{Tag: TagUnsigned, Value: uint8(1)}}})
+			return err
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSettingsBuilderLN()
+			if tt.sn {
+				b = NewSettingsBuilderSN()
+			}
+			h := newtesthandler()
+			h.ln[obis] = DlmsData{Tag: TagUnsigned, Value: uint8(0)}
+			client, server := newtestpipe()
+			server.onsend = replaceresponse(tt.tag, tt.apdu)
+			ss := testsettings(t, b)
+			ss.MaxPduRecvSize = 1024
+			_, stop := startserveron(t, client, server, ss, h)
+			defer stop()
+			c := New(client, testsettings(t, b))
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			err := tt.call(c)
+			if tt.exception {
+				var e *ExceptionError
+				if !errors.As(err, &e) || e.ServiceError != TagExceptionInvocationCounterError || e.InvocationCounter != 9 {
+					t.Errorf("expected exception error, got %v", err)
+				}
+			} else {
+				var e *ConfirmedServiceError
+				if !errors.As(err, &e) || e.ServiceError != TagErrAccess {
+					t.Errorf("expected confirmed service error, got %v", err)
+				}
+			}
+		})
+	}
+}
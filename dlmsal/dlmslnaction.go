@@ -2,6 +2,7 @@ package dlmsal
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -9,7 +10,7 @@ import (
 	"github.com/cybroslabs/libdlms-go/base"
 )
 
-type dlmsalaction struct { // this will implement io.Reader for LN Action operation, not supporting block data sending, only receiving
+type dlmsalaction struct { // this will implement io.Reader for LN Action operation, parameters are sent in pblocks if they dont fit
 	master *dlmsal
 	state  int
 	// 0 before first response
@@ -20,6 +21,16 @@ type dlmsalaction struct { // this will implement io.Reader for LN Action operat
 	lastblock bool
 	remaining uint
 	transport io.Reader
+
+	// parameters not sent yet in case of pblock sending
+	params    []byte
+	blocksent uint32
+}
+
+// result of a single action in the list, Data is the optional return data, it can be also TagError in case of data access error
+type ActionResult struct {
+	Result DlmsResultTag
+	Data   *DlmsData
 }
 
 func encodelnactionitem(dst *bytes.Buffer, item *DlmsLNRequestItem) error {
@@ -52,17 +63,60 @@ func (ln *dlmsalaction) action(item DlmsLNRequestItem) (data *DlmsData, err erro
 		return
 	}
 
-	// send itself, that could be fun, do that in one step for now
-	tag, str, err := master.sendpdu()
+	var tag CosemTag
+	if item.SetData != nil && !master.usegbt() && local.Len() > master.maxPduSendSize-6-master.cipheroverhead() { // the same reserve as in case of set
+		var params bytes.Buffer
+		_ = encodeData(&params, item.SetData) // it was already encoded once, so no error here
+		ln.params = params.Bytes()
+		ln.blocksent = 0
+		local.Reset()
+		local.WriteByte(byte(TagActionRequest))
+		local.WriteByte(byte(TagActionRequestWithFirstPBlock))
+		local.WriteByte(master.invokeid | master.settings.invokebyte)
+		encodelncosemattr(local, &item)
+		tag, err = ln.sendpblock()
+	} else {
+		var str io.Reader
+		tag, str, err = master.sendpdu()
+		ln.transport = str
+	}
 	if err != nil {
 		return data, err
 	}
-	ln.transport = str
 
 	// start streaming response
 	return ln.actiondata(tag)
 }
 
+// sends the next block of parameters, request header is already in the pdu buffer
+func (ln *dlmsalaction) sendpblock() (tag CosemTag, err error) {
+	master := ln.master
+	local := &master.pdu
+	ts := master.maxPduSendSize - 16 - master.cipheroverhead() - local.Len()
+	if ts <= 0 {
+		return tag, fmt.Errorf("too small max pdu size for block transfer")
+	}
+	last := len(ln.params) <= ts
+	if last {
+		ts = len(ln.params)
+		local.WriteByte(1)
+	} else {
+		local.WriteByte(0)
+	}
+	ln.blocksent++
+	local.WriteByte(byte(ln.blocksent >> 24))
+	local.WriteByte(byte(ln.blocksent >> 16))
+	local.WriteByte(byte(ln.blocksent >> 8))
+	local.WriteByte(byte(ln.blocksent))
+	encodelength(local, uint(ts))
+	local.Write(ln.params[:ts])
+	ln.params = ln.params[ts:]
+
+	tag, str, err := master.sendpdu()
+	ln.transport = str
+	return
+}
+
 func (ln *dlmsalaction) actiondata(tag CosemTag) (data *DlmsData, err error) {
 	master := ln.master
 	switch ln.state {
@@ -71,8 +125,7 @@ func (ln *dlmsalaction) actiondata(tag CosemTag) (data *DlmsData, err error) {
 		case TagActionResponse:
 		case TagExceptionResponse: // no lower layer readout
 			ln.state = 100
-			d, err := decodeException(ln.transport, &master.tmpbuffer)
-			return &d, err // dont decode exception pdu
+			return nil, decodeException(ln.transport, &master.tmpbuffer)
 		default:
 			return data, fmt.Errorf("unexpected tag: %02x", tag)
 		}
@@ -128,6 +181,27 @@ func (ln *dlmsalaction) actiondata(tag CosemTag) (data *DlmsData, err error) {
 			ln.state = 1
 			d, _, err := decodeDataTag(ln, &master.tmpbuffer)
 			return &d, err
+		case TagActionResponseNextPBlock: // server wants more parameters
+			_, err = io.ReadFull(ln.transport, master.tmpbuffer[:4])
+			if err != nil {
+				return data, err
+			}
+			if ln.blocksent == 0 || len(ln.params) == 0 {
+				return data, fmt.Errorf("unexpected next pblock response, all parameters are sent")
+			}
+			if binary.BigEndian.Uint32(master.tmpbuffer[:]) != ln.blocksent {
+				return data, fmt.Errorf("unexpected block number")
+			}
+			local := &master.pdu
+			local.Reset()
+			local.WriteByte(byte(TagActionRequest))
+			local.WriteByte(byte(TagActionRequestWithPBlock))
+			local.WriteByte(master.invokeid | master.settings.invokebyte)
+			tag, err = ln.sendpblock()
+			if err != nil {
+				return data, err
+			}
+			return ln.actiondata(tag)
 		}
 		return data, fmt.Errorf("unexpected response tag: %02x", master.tmpbuffer[0])
 	case 100:
@@ -220,8 +294,156 @@ func (ln *dlmsalaction) Read(p []byte) (n int, err error) { // this will go to d
 	return 0, fmt.Errorf("program error, unexpected state: %v", ln.state)
 }
 
-// action part, only single action is supported, not list of actions, at least not yet, fuck support everything is a bit pointless
-func (d *dlmsal) Action(item DlmsLNRequestItem) (data *DlmsData, err error) { // todo blocking support in case of really big action
+func (ln *dlmsalaction) actionlist(items []DlmsLNRequestItem) (ret []ActionResult, err error) {
+	master := ln.master
+	local := &master.pdu
+	local.Reset()
+	local.WriteByte(byte(TagActionRequest))
+	local.WriteByte(byte(TagActionRequestWithList))
+	master.invokeid = (master.invokeid + 1) & 7
+	local.WriteByte(master.invokeid | master.settings.invokebyte)
+	encodelength(local, uint(len(items)))
+	for i := range items {
+		if items[i].HasAccess {
+			return nil, fmt.Errorf("action item cant have access")
+		}
+		encodelncosemattr(local, &items[i])
+	}
+	var params bytes.Buffer // parameters are not optional in the list, so null data instead
+	encodelength(&params, uint(len(items)))
+	for i := range items {
+		if items[i].SetData == nil {
+			params.WriteByte(byte(TagNull))
+			continue
+		}
+		err = encodeData(&params, items[i].SetData)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode data: %w", err)
+		}
+	}
+
+	var tag CosemTag
+	if !master.usegbt() && local.Len()+params.Len() > master.maxPduSendSize-6-master.cipheroverhead() {
+		local.Bytes()[1] = byte(TagActionRequestWithListAndFirstPBlock) // the rest of the header is the same
+		ln.params = params.Bytes()
+		ln.blocksent = 0
+		tag, err = ln.sendpblock()
+	} else {
+		local.Write(params.Bytes())
+		var str io.Reader
+		tag, str, err = master.sendpdu()
+		ln.transport = str
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ln.actionlistdata(tag, len(items))
+}
+
+func (ln *dlmsalaction) actionlistdata(tag CosemTag, count int) (ret []ActionResult, err error) {
+	master := ln.master
+	ret = make([]ActionResult, count)
+	for {
+		switch tag {
+		case TagActionResponse:
+		case TagExceptionResponse: // no lower layer readout
+			ln.state = 100
+			return nil, decodeException(ln.transport, &master.tmpbuffer)
+		default:
+			return nil, fmt.Errorf("unexpected tag: %02x", tag)
+		}
+		_, err = io.ReadFull(ln.transport, master.tmpbuffer[:2])
+		if err != nil {
+			return nil, err
+		}
+		if master.tmpbuffer[1]&7 != master.invokeid {
+			return nil, fmt.Errorf("unexpected invoke id")
+		}
+
+		switch actionResponseTag(master.tmpbuffer[0]) {
+		case TagActionResponseWithList:
+			ln.state = 100
+			return ret, decodeactionresults(ln.transport, ret, &master.tmpbuffer)
+		case TagActionResponseWithPBlock:
+			ln.state = 1
+			return ret, decodeactionresults(ln, ret, &master.tmpbuffer)
+		case TagActionResponseNormal: // whole list failed, e.g. wrong block number
+			ln.state = 100
+			_, err = io.ReadFull(ln.transport, master.tmpbuffer[:1])
+			if err != nil {
+				return nil, err
+			}
+			for i := range ret {
+				ret[i].Result = DlmsResultTag(master.tmpbuffer[0])
+			}
+			return ret, nil
+		case TagActionResponseNextPBlock:
+			_, err = io.ReadFull(ln.transport, master.tmpbuffer[:4])
+			if err != nil {
+				return nil, err
+			}
+			if ln.blocksent == 0 || len(ln.params) == 0 {
+				return nil, fmt.Errorf("unexpected next pblock response, all parameters are sent")
+			}
+			if binary.BigEndian.Uint32(master.tmpbuffer[:]) != ln.blocksent {
+				return nil, fmt.Errorf("unexpected block number")
+			}
+			local := &master.pdu
+			local.Reset()
+			local.WriteByte(byte(TagActionRequest))
+			local.WriteByte(byte(TagActionRequestWithPBlock))
+			local.WriteByte(master.invokeid | master.settings.invokebyte)
+			tag, err = ln.sendpblock()
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected response tag: %02x", master.tmpbuffer[0])
+		}
+	}
+}
+
+func decodeactionresults(src io.Reader, ret []ActionResult, tmp *tmpbuffer) error {
+	l, _, err := decodelength(src, tmp)
+	if err != nil {
+		return err
+	}
+	if l != uint(len(ret)) {
+		return fmt.Errorf("different amount of results, expected %v, got %v", len(ret), l)
+	}
+	for i := range ret {
+		_, err = io.ReadFull(src, tmp[:2])
+		if err != nil {
+			return err
+		}
+		ret[i].Result = DlmsResultTag(tmp[0])
+		if tmp[1] == 0 { // no return parameters
+			continue
+		}
+		_, err = io.ReadFull(src, tmp[:1])
+		if err != nil {
+			return err
+		}
+		if tmp[0] != 0 {
+			_, err = io.ReadFull(src, tmp[:1])
+			if err != nil {
+				return err
+			}
+			d := NewDlmsDataError(DlmsResultTag(tmp[0]))
+			ret[i].Data = &d
+			continue
+		}
+		d, _, err := decodeDataTag(src, tmp)
+		if err != nil {
+			return err
+		}
+		ret[i].Data = &d
+	}
+	return nil
+}
+
+// action part, single action
+func (d *dlmsal) Action(item DlmsLNRequestItem) (data *DlmsData, err error) {
 	if !d.isopen {
 		return nil, base.ErrNotOpened
 	}
@@ -229,3 +451,17 @@ func (d *dlmsal) Action(item DlmsLNRequestItem) (data *DlmsData, err error) { //
 	ln := &dlmsalaction{master: d, state: 0, blockexp: 0}
 	return ln.action(item)
 }
+
+// list of actions in one request, parameters are sent in pblocks if they dont fit, results are in the same order as items,
+// exception-response fails the whole call with *ExceptionError, there are no per item results in that case
+func (d *dlmsal) ActionList(items []DlmsLNRequestItem) ([]ActionResult, error) {
+	if !d.isopen {
+		return nil, base.ErrNotOpened
+	}
+	if len(items) == 0 {
+		return nil, base.ErrNothingToRead
+	}
+
+	ln := &dlmsalaction{master: d, state: 0, blockexp: 0}
+	return ln.actionlist(items)
+}
@@ -0,0 +1,212 @@
+package dlmsal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// ln client and server with small pdus, onrequest and onresponse can change messages of the client and the server
+func startlnblocks(t *testing.T, h DlmsServerHandler, onrequest func([]byte) []byte, onresponse func([]byte) []byte) (DlmsClient, func()) {
+	t.Helper()
+	client, server := newtestpipe()
+	client.onsend = onrequest
+	server.onsend = onresponse
+	ss := testsettings(t, NewSettingsBuilderLN())
+	ss.MaxPduRecvSize = 128
+	_, stop := startserveron(t, client, server, ss, h)
+	cs := testsettings(t, NewSettingsBuilderLN())
+	cs.MaxPduRecvSize = 128
+	c := New(client, cs)
+	if err := c.Open(); err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	return c, stop
+}
+
+// counts messages starting with prefix and checks that none of them is longer than the negotiated pdu
+func countmessages(t *testing.T, prefix []byte, cnt *int) func([]byte) []byte {
+	return func(m []byte) []byte {
+		if len(m) > 128 {
+			t.Errorf("message of %d bytes sent", len(m))
+		}
+		if bytes.HasPrefix(m, prefix) {
+			*cnt++
+		}
+		return m
+	}
+}
+
+func TestActionPBlocks(t *testing.T) {
+	var first, next, blocks int
+	onfirst := countmessages(t, []byte{byte(TagActionRequest), byte(TagActionRequestWithFirstPBlock)}, &first)
+	onnext := countmessages(t, []byte{byte(TagActionRequest), byte(TagActionRequestWithPBlock)}, &next)
+	onrequest := func(m []byte) []byte { return onnext(onfirst(m)) }
+	c, stop := startlnblocks(t, newtesthandler(), onrequest, countmessages(t, []byte{byte(TagActionResponse), byte(TagActionResponseWithPBlock)}, &blocks))
+	defer stop()
+
+	// parameters are echoed back, so both request and response are split
+	param := DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{0x5a}, 1000)}
+	d, err := c.Action(DlmsLNRequestItem{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 255}, Attribute: 1, SetData: &param})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Tag != TagOctetString || !bytes.Equal(d.Value.([]byte), param.Value.([]byte)) {
+		t.Fatalf("unexpected response %v", d)
+	}
+	if first != 1 || next < 7 || blocks < 7 {
+		t.Errorf("unexpected amount of blocks, first %d, next %d, response %d", first, next, blocks)
+	}
+
+	// short one still goes as a normal request afterwards
+	first, next = 0, 0
+	param = DlmsData{Tag: TagUnsigned, Value: uint8(3)}
+	d, err = c.Action(DlmsLNRequestItem{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 255}, Attribute: 1, SetData: &param})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Value != uint8(3) || first != 0 || next != 0 {
+		t.Errorf("unexpected response %v", d)
+	}
+}
+
+func TestActionPBlockErrors(t *testing.T) {
+	param := DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{0x5a}, 1000)}
+	item := DlmsLNRequestItem{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 255}, Attribute: 1, SetData: &param}
+	nextpblock := []byte{byte(TagActionResponse), byte(TagActionResponseNextPBlock)}
+	responseblock := []byte{byte(TagActionResponse), byte(TagActionResponseWithPBlock)}
+	requestblock := []byte{byte(TagActionRequest), byte(TagActionRequestWithPBlock)}
+	tests := []struct {
+		name       string
+		onrequest  func([]byte) []byte
+		onresponse func([]byte) []byte
+		refused    bool // server refuses the block, otherwise client does
+	}{
+		{"next pblock number", nil, changeresponse(nextpblock, 2, func(m []byte) []byte { m[6]++; return m }), false},
+		{"response pblock number", nil, changeresponse(responseblock, 2, func(m []byte) []byte { m[7]++; return m }), false},
+		{"request pblock number", changeresponse(requestblock, 2, func(m []byte) []byte { m[7] += 2; return m }), nil, true},
+		{"request pblock repeated", changeresponse(requestblock, 2, func(m []byte) []byte { m[7]--; return m }), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, stop := startlnblocks(t, newtesthandler(), tt.onrequest, tt.onresponse)
+			defer stop()
+			d, err := c.Action(item)
+			if tt.refused {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d == nil || d.Tag != TagError || resultfromdata(d) != TagResultDataBlockNumberInvalid {
+					t.Errorf("expected invalid block number result, got %v", d)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "unexpected block number") {
+				t.Errorf("expected block number mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+// action handler failing methods of objects listed in fail, method 2 returns no data, others echo parameters
+type actionlisthandler struct {
+	*testhandler
+	fail map[DlmsObis]DlmsResultTag
+}
+
+func (h *actionlisthandler) Action(item *DlmsLNRequestItem) (*DlmsData, DlmsResultTag) {
+	if r, ok := h.fail[item.Obis]; ok {
+		return nil, r
+	}
+	if item.Attribute == 2 {
+		return nil, TagResultSuccess
+	}
+	return item.SetData, TagResultSuccess
+}
+
+func newactionlisthandler() *actionlisthandler {
+	return &actionlisthandler{testhandler: newtesthandler(), fail: map[DlmsObis]DlmsResultTag{{A: 0, B: 0, C: 96, D: 3, E: 10, F: 2}: TagResultObjectUndefined}}
+}
+
+func actionlistitems(paramlen int) []DlmsLNRequestItem {
+	return []DlmsLNRequestItem{
+		{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 1}, Attribute: 1, SetData: &DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{1}, paramlen)}},
+		{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 2}, Attribute: 1, SetData: &DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{2}, paramlen)}},
+		{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 3}, Attribute: 2},
+		{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 4}, Attribute: 1},
+		{ClassId: 70, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 3, E: 10, F: 5}, Attribute: 1, SetData: &DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{5}, paramlen)}},
+	}
+}
+
+func TestActionList(t *testing.T) {
+	tests := []struct {
+		name     string
+		paramlen int
+		first    int // amount of list requests with the first pblock
+		blocks   bool
+	}{
+		{"normal", 10, 0, false},
+		{"pblocks", 100, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var first, blocks int
+			c, stop := startlnblocks(t, newactionlisthandler(),
+				countmessages(t, []byte{byte(TagActionRequest), byte(TagActionRequestWithListAndFirstPBlock)}, &first),
+				countmessages(t, []byte{byte(TagActionResponse), byte(TagActionResponseWithPBlock)}, &blocks))
+			defer stop()
+			items := actionlistitems(tt.paramlen)
+			r, err := c.ActionList(items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r) != len(items) {
+				t.Fatalf("unexpected amount of results %d", len(r))
+			}
+			for _, i := range []int{0, 4} {
+				if r[i].Result != TagResultSuccess || r[i].Data == nil || !bytes.Equal(r[i].Data.Value.([]byte), items[i].SetData.Value.([]byte)) {
+					t.Errorf("unexpected result %d: %v", i, r[i])
+				}
+			}
+			if r[1].Result != TagResultObjectUndefined || r[1].Data != nil {
+				t.Errorf("unexpected failed result %v", r[1])
+			}
+			if r[2].Result != TagResultSuccess || r[2].Data != nil {
+				t.Errorf("unexpected result without data %v", r[2])
+			}
+			if r[3].Result != TagResultSuccess || r[3].Data == nil || r[3].Data.Tag != TagNull { // missing parameter is sent as null
+				t.Errorf("unexpected result of null parameter %v", r[3])
+			}
+			if first != tt.first || (blocks > 0) != tt.blocks {
+				t.Errorf("unexpected amount of blocks, first %d, response %d", first, blocks)
+			}
+		})
+	}
+}
+
+func TestActionListErrors(t *testing.T) {
+	list := []byte{byte(TagActionResponse), byte(TagActionResponseWithList)}
+	requestblock := []byte{byte(TagActionRequest), byte(TagActionRequestWithPBlock)}
+	t.Run("different amount of results", func(t *testing.T) {
+		c, stop := startlnblocks(t, newactionlisthandler(), nil, changeresponse(list, 1, func(m []byte) []byte { m[3]--; return m }))
+		defer stop()
+		_, err := c.ActionList(actionlistitems(10))
+		if err == nil || !strings.Contains(err.Error(), "different amount of results") {
+			t.Errorf("expected amount mismatch, got %v", err)
+		}
+	})
+	t.Run("request pblock number", func(t *testing.T) { // whole list is refused
+		c, stop := startlnblocks(t, newactionlisthandler(), changeresponse(requestblock, 1, func(m []byte) []byte { m[7]++; return m }), nil)
+		defer stop()
+		r, err := c.ActionList(actionlistitems(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range r {
+			if r[i].Result != TagResultDataBlockNumberInvalid {
+				t.Errorf("unexpected result %d: %v", i, r[i])
+			}
+		}
+	})
+}
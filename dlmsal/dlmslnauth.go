@@ -5,10 +5,42 @@ import (
 	"encoding/binary"
 	"fmt"
 
+	"github.com/cybroslabs/libdlms-go/base"
 	"github.com/cybroslabs/libdlms-go/gcm"
 )
 
 func (d *dlmsal) LNAuthentication(checkresp bool) error {
+	return d.hlsauthentication(checkresp, func(data *DlmsData) (*DlmsData, error) {
+		req := DlmsLNRequestItem{
+			ClassId:   15,
+			Obis:      DlmsObis{A: 0, B: 0, C: 40, D: 0, E: 0, F: 255},
+			Attribute: 1,
+			HasAccess: false,
+			SetData:   data}
+		return d.Action(req)
+	})
+}
+
+// reply_to_HLS_authentication of the current association SN, invoked by read with parametrized access, so it has to be negotiated
+func (d *dlmsal) SNAuthentication(checkresp bool) error {
+	if !d.isopen {
+		return base.ErrNotOpened
+	}
+	// negotiated conformance is known only from the initiate response, without it the access cant be assumed
+	if d.aareres.initiateResponse == nil || d.aareres.initiateResponse.NegotiatedConformance&ConformanceBlockParametrizedAccess == 0 {
+		return fmt.Errorf("parametrized access is not negotiated, so reply_to_HLS_authentication cant be invoked")
+	}
+	offset, err := SNMethodOffset(12, 8) // reply_to_HLS_authentication
+	if err != nil {
+		return err
+	}
+	return d.hlsauthentication(checkresp, func(data *DlmsData) (*DlmsData, error) {
+		return d.InvokeSN(snCurrentAssociation, offset, data)
+	})
+}
+
+// hls pass 3 and 4, invoke calls reply_to_HLS_authentication with f(StoC) and returns f(CtoS) of the server
+func (d *dlmsal) hlsauthentication(checkresp bool, invoke func(data *DlmsData) (*DlmsData, error)) error {
 	s := d.settings
 
 	if d.aareres.AssociationResult != AssociationResultAccepted { // sadly this zero is also default value
@@ -23,43 +55,26 @@ func (d *dlmsal) LNAuthentication(checkresp bool) error {
 		return fmt.Errorf("invalid aare response: %v", s.SourceDiagnostic)
 	}
 
-	// do standard action, dunno if it has to be dedicated or global encrypted ctos packet
-	if s.gcm == nil {
-		return fmt.Errorf("no gcm set for ciphering")
-	}
-	// create ctos hash
-	e, err := s.gcm.Encrypt(d.cryptbuffer, byte(SecurityAuthentication), s.framecounter, s.systemtitle, s.StoC)
+	a := d.authenticator()
+	ac := d.authcontext()
+	hashresp, err := a.Pass3(ac)
 	if err != nil {
 		return err
 	}
-	if len(e) < gcm.GCM_TAG_LENGTH {
-		return fmt.Errorf("encrypted data too short")
-	}
-
-	hashresp := make([]byte, 5+gcm.GCM_TAG_LENGTH)
-	hashresp[0] = byte(SecurityAuthentication)
-	hashresp[1] = byte(s.framecounter >> 24)
-	hashresp[2] = byte(s.framecounter >> 16)
-	hashresp[3] = byte(s.framecounter >> 8)
-	hashresp[4] = byte(s.framecounter)
-	copy(hashresp[5:], e[len(e)-gcm.GCM_TAG_LENGTH:])
 
-	data := DlmsData{Tag: TagOctetString, Value: hashresp}
-	req := DlmsLNRequestItem{
-		ClassId:   15,
-		Obis:      DlmsObis{A: 0, B: 0, C: 40, D: 0, E: 0, F: 255},
-		Attribute: 1,
-		HasAccess: false,
-		SetData:   &data}
-
-	s.framecounter++
-	adata, err := d.Action(req)
+	adata, err := invoke(&DlmsData{Tag: TagOctetString, Value: hashresp})
 	if err != nil {
 		return err
 	}
 	if adata == nil {
 		return fmt.Errorf("no data received from authentication action")
 	}
+	if adata.Tag == TagError { // refused by the server, probably wrong secret
+		if e, ok := adata.Value.(error); ok {
+			return fmt.Errorf("authentication refused: %w", e)
+		}
+		return fmt.Errorf("authentication refused")
+	}
 	if !checkresp { // so optimistic
 		return nil
 	}
@@ -69,7 +84,40 @@ func (d *dlmsal) LNAuthentication(checkresp bool) error {
 	if err != nil {
 		return err
 	}
-	// ok, check response against my own hash
+	return a.Pass4(ac, aresp)
+}
+
+func (d *dlmsal) gmacctos() ([]byte, error) {
+	s := d.settings
+	// do standard action, dunno if it has to be dedicated or global encrypted ctos packet
+	if s.gcm == nil {
+		return nil, fmt.Errorf("no gcm set for ciphering")
+	}
+	fc, err := s.nextframecounter()
+	if err != nil {
+		return nil, err
+	}
+	// create ctos hash
+	e, err := s.gcm.Encrypt(d.cryptbuffer, byte(SecurityAuthentication), fc, s.systemtitle, s.StoC)
+	if err != nil {
+		return nil, err
+	}
+	if len(e) < gcm.GCM_TAG_LENGTH {
+		return nil, fmt.Errorf("encrypted data too short")
+	}
+
+	hashresp := make([]byte, 5+gcm.GCM_TAG_LENGTH)
+	hashresp[0] = byte(SecurityAuthentication)
+	hashresp[1] = byte(fc >> 24)
+	hashresp[2] = byte(fc >> 16)
+	hashresp[3] = byte(fc >> 8)
+	hashresp[4] = byte(fc)
+	copy(hashresp[5:], e[len(e)-gcm.GCM_TAG_LENGTH:])
+	return hashresp, nil
+}
+
+func (d *dlmsal) checkgmacstoc(aresp []byte) error {
+	s := d.settings
 	if len(aresp) != 5+gcm.GCM_TAG_LENGTH || aresp[0] != byte(SecurityAuthentication) {
 		return fmt.Errorf("invalid stoc hash response")
 	}
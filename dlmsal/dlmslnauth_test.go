@@ -0,0 +1,69 @@
+package dlmsal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cybroslabs/libdlms-go/base"
+)
+
+func TestSNAuthentication(t *testing.T) {
+	secret := []byte("hlssecret")
+	tests := []struct {
+		name         string
+		parametrized bool
+	}{
+		{"parametrized access", true},
+		{"without parametrized access", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := testsettings(t, NewSettingsBuilderSN().HlsAuthentication(AuthenticationHighMD5, secret, []byte("serverchallenge1")))
+			if !tt.parametrized {
+				ss.ConformanceBlock &^= ConformanceBlockParametrizedAccess
+			}
+			client, _, stop := startserver(t, ss, newtesthandler())
+			defer stop()
+			c := New(client, testsettings(t, NewSettingsBuilderSN().HlsAuthentication(AuthenticationHighMD5, secret, []byte("clientchallenge1"))))
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			err := c.SNAuthentication(true)
+			if !tt.parametrized {
+				if err == nil || !strings.Contains(err.Error(), "parametrized access") {
+					t.Errorf("expected refusal without parametrized access, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := c.Read([]DlmsSNRequestItem{{Address: 0x100}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r[0].Value != uint16(0x100) {
+				t.Errorf("unexpected value %v", r[0])
+			}
+		})
+	}
+}
+
+func TestSNAuthenticationWithoutInitiateResponse(t *testing.T) {
+	secret := []byte("hlssecret")
+	ss := testsettings(t, NewSettingsBuilderSN().HlsAuthentication(AuthenticationHighMD5, secret, []byte("serverchallenge1")))
+	client, _, stop := startserver(t, ss, newtesthandler())
+	defer stop()
+	c := New(client, testsettings(t, NewSettingsBuilderSN().HlsAuthentication(AuthenticationHighMD5, secret, []byte("clientchallenge1"))))
+	if err := c.SNAuthentication(true); !errors.Is(err, base.ErrNotOpened) {
+		t.Errorf("authentication before open: %v", err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	c.(*dlmsal).aareres.initiateResponse = nil // negotiated conformance unknown
+	if err := c.SNAuthentication(true); err == nil || !strings.Contains(err.Error(), "parametrized access") {
+		t.Errorf("expected refusal without initiate response, got %v", err)
+	}
+}
@@ -51,10 +51,8 @@ func encodelngetitem(dst *bytes.Buffer, item *DlmsLNRequestItem) error {
 	return nil
 }
 
-func (ln *dlmsalget) get(items []DlmsLNRequestItem) ([]DlmsData, error) {
-	if len(items) == 0 {
-		return nil, base.ErrNothingToRead
-	}
+// encodes and sends single get request, normal one in case of single item
+func (ln *dlmsalget) sendget(items []DlmsLNRequestItem) (CosemTag, error) {
 	master := ln.master
 	local := &master.pdu
 	local.Reset()
@@ -74,16 +72,27 @@ func (ln *dlmsalget) get(items []DlmsLNRequestItem) ([]DlmsData, error) {
 	for _, i := range items {
 		err := encodelngetitem(local, &i)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 	}
 
 	// send itself, that could be fun, do that in one step for now
 	tag, str, err := master.sendpdu()
 	if err != nil {
-		return nil, err
+		return tag, err
 	}
 	ln.transport = str
+	return tag, nil
+}
+
+func (ln *dlmsalget) get(items []DlmsLNRequestItem) ([]DlmsData, error) {
+	if len(items) == 0 {
+		return nil, base.ErrNothingToRead
+	}
+	tag, err := ln.sendget(items)
+	if err != nil {
+		return nil, err
+	}
 
 	// start streaming response
 	ln.data = make([]DlmsData, len(items))
@@ -101,25 +110,10 @@ func (ln *dlmsalget) get(items []DlmsLNRequestItem) ([]DlmsData, error) {
 }
 
 func (ln *dlmsalget) getstream(item DlmsLNRequestItem, inmem bool) (DlmsDataStream, error) {
-	master := ln.master
-	local := &master.pdu
-	local.Reset()
-	local.WriteByte(byte(TagGetRequest))
-	local.WriteByte(byte(TagGetRequestNormal))
-	master.invokeid = (master.invokeid + 1) & 7
-	local.WriteByte(master.invokeid | master.settings.invokebyte)
-
-	err := encodelngetitem(local, &item)
-	if err != nil {
-		return nil, err
-	}
-
-	// send itself, that could be fun, do that in one step for now
-	tag, str, err := master.sendpdu()
+	tag, err := ln.sendget([]DlmsLNRequestItem{item})
 	if err != nil {
 		return nil, err
 	}
-	ln.transport = str
 	return ln.getstreamdata(tag, inmem)
 }
 
@@ -128,12 +122,7 @@ func (ln *dlmsalget) getstreamdata(tag CosemTag, inmem bool) (s DlmsDataStream,
 	switch tag {
 	case TagGetResponse:
 	case TagExceptionResponse: // no lower layer readout
-		d, err := decodeException(ln.transport, &master.tmpbuffer)
-		if err != nil {
-			return nil, err
-		}
-		ex := d.Value.(*DlmsError)
-		return nil, ex // dont decode exception pdu, maybe todo, should be 2 bytes
+		return nil, decodeException(ln.transport, &master.tmpbuffer)
 	default:
 		return nil, fmt.Errorf("unexpected tag: %02x", tag)
 	}
@@ -187,12 +176,8 @@ func (ln *dlmsalget) getnextdata(tag CosemTag, i int) (cont bool, err error) {
 		switch tag {
 		case TagGetResponse:
 		case TagExceptionResponse: // no lower layer readout
-			d, err := decodeException(ln.transport, &master.tmpbuffer)
-			for i := 0; i < len(ln.data); i++ {
-				ln.data[i] = d
-			}
 			ln.state = 100
-			return true, err
+			return false, decodeException(ln.transport, &master.tmpbuffer)
 		default:
 			return false, fmt.Errorf("unexpected tag: %02x", tag)
 		}
@@ -398,13 +383,67 @@ func (ln *dlmsalget) Read(p []byte) (n int, err error) { // this will go to data
 	return 0, fmt.Errorf("program error, unexpected state: %v", ln.state)
 }
 
+// splits items into requests fitting into the negotiated pdu size, every item is requested separately
+// if multiple references are not negotiated, results are merged in the original order,
+// exception-response fails the whole call with *ExceptionError, there are no per item results in that case
 func (d *dlmsal) Get(items []DlmsLNRequestItem) ([]DlmsData, error) {
 	if !d.isopen {
 		return nil, base.ErrNotOpened
 	}
 
-	ln := &dlmsalget{master: d, state: 0, blockexp: 0}
-	return ln.get(items)
+	chunks, err := d.getchunks(items)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 1 {
+		ln := &dlmsalget{master: d, state: 0, blockexp: 0}
+		return ln.get(items)
+	}
+	ret := make([]DlmsData, 0, len(items))
+	for _, c := range chunks {
+		ln := &dlmsalget{master: d, state: 0, blockexp: 0}
+		data, err := ln.get(c)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, data...)
+	}
+	return ret, nil
+}
+
+func (d *dlmsal) getchunks(items []DlmsLNRequestItem) (ret [][]DlmsLNRequestItem, err error) {
+	if len(items) <= 1 {
+		return [][]DlmsLNRequestItem{items}, nil
+	}
+	if d.aareres.initiateResponse != nil && d.aareres.initiateResponse.NegotiatedConformance&ConformanceBlockMultipleReferences == 0 {
+		ret = make([][]DlmsLNRequestItem, len(items))
+		for i := range items {
+			ret[i] = items[i : i+1]
+		}
+		return
+	}
+	if d.usegbt() || d.maxPduSendSize == 0 {
+		return [][]DlmsLNRequestItem{items}, nil
+	}
+
+	limit := d.maxPduSendSize - 16 - d.cipheroverhead() // header, list length and ciphering overhead
+	var buf bytes.Buffer
+	start := 0
+	size := 0
+	for i := range items {
+		buf.Reset()
+		err = encodelngetitem(&buf, &items[i])
+		if err != nil {
+			return nil, err
+		}
+		if i > start && size+buf.Len() > limit {
+			ret = append(ret, items[start:i])
+			start = i
+			size = 0
+		}
+		size += buf.Len()
+	}
+	return append(ret, items[start:]), nil
 }
 
 func (d *dlmsal) GetStream(item DlmsLNRequestItem, inmem bool) (DlmsDataStream, error) {
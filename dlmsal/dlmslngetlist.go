@@ -0,0 +1,167 @@
+package dlmsal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cybroslabs/libdlms-go/base"
+)
+
+// stream of get with list results, item streams are returned one by one in the order of the items
+type DlmsListStream interface {
+	Next() (DlmsDataStream, error) // io.EOF after the last item, data access error of the item is returned as *DlmsError and the list continues
+	Close() error                  // reads out the rest of the current response, remaining requests are not sent
+}
+
+type getliststream struct {
+	master    *dlmsal
+	chunks    [][]DlmsLNRequestItem
+	src       io.Reader // current response content
+	left      int       // items left in the current response
+	hasresult bool      // data are preceded by the result byte, not in case of single item in blocks
+	current   DlmsDataStream
+}
+
+// sends the next request and reads response header till the first item
+func (s *getliststream) start() error {
+	master := s.master
+	items := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	ln := &dlmsalget{master: master, state: 0, blockexp: 0}
+	tag, err := ln.sendget(items)
+	if err != nil {
+		return err
+	}
+	switch tag {
+	case TagGetResponse:
+	case TagExceptionResponse: // no lower layer readout
+		return decodeException(ln.transport, &master.tmpbuffer)
+	default:
+		return fmt.Errorf("unexpected tag: %02x", tag)
+	}
+	_, err = io.ReadFull(ln.transport, master.tmpbuffer[:2])
+	if err != nil {
+		return err
+	}
+	if master.tmpbuffer[1]&7 != master.invokeid {
+		return fmt.Errorf("unexpected invoke id")
+	}
+
+	s.left = len(items)
+	s.hasresult = true
+	switch getResponseTag(master.tmpbuffer[0]) {
+	case TagGetResponseNormal:
+		if len(items) > 1 {
+			return fmt.Errorf("expecting list response")
+		}
+		s.src = ln.transport
+		return nil
+	case TagGetResponseWithList:
+		if len(items) == 1 {
+			return fmt.Errorf("expecting normal response")
+		}
+		s.src = ln.transport
+	case TagGetResponseWithDataBlock:
+		ln.state = 1
+		s.src = ln
+		if len(items) == 1 {
+			s.hasresult = false
+			return nil
+		}
+	default:
+		return fmt.Errorf("unexpected response tag: %02x", master.tmpbuffer[0])
+	}
+	l, _, err := decodelength(s.src, &master.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	if l != uint(len(items)) {
+		return fmt.Errorf("different amount of data received")
+	}
+	return nil
+}
+
+// skips unread elements of the current item
+func (s *getliststream) skip() error {
+	if s.current == nil {
+		return nil
+	}
+	c := s.current
+	s.current = nil
+	for {
+		_, err := c.NextElement()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *getliststream) Next() (DlmsDataStream, error) {
+	master := s.master
+	err := s.skip()
+	if err != nil {
+		return nil, err
+	}
+	for s.left == 0 {
+		if len(s.chunks) == 0 {
+			return nil, io.EOF
+		}
+		err = s.start()
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.left--
+
+	if s.hasresult {
+		_, err = io.ReadFull(s.src, master.tmpbuffer[:1])
+		if err != nil {
+			return nil, err
+		}
+		if master.tmpbuffer[0] != 0 {
+			_, err = io.ReadFull(s.src, master.tmpbuffer[:1])
+			if err != nil {
+				if errors.Is(err, io.ErrUnexpectedEOF) {
+					return nil, NewDlmsError(TagResultOtherReason) // this kind of data cant be decoded, so that is why
+				}
+				return nil, err
+			}
+			return nil, NewDlmsError(DlmsResultTag(master.tmpbuffer[0]))
+		}
+	}
+	s.current, err = newDataStream(s.src, false, master.logger)
+	return s.current, err
+}
+
+func (s *getliststream) Close() error {
+	s.current = nil
+	s.chunks = nil
+	s.left = 0
+	if s.src == nil {
+		return nil
+	}
+	src := s.src
+	s.src = nil
+	_, err := io.Copy(io.Discard, src)
+	return err
+}
+
+// streaming variant of Get, items are split into more requests the same way, data are not held in memory
+func (d *dlmsal) GetListStream(items []DlmsLNRequestItem) (DlmsListStream, error) {
+	if !d.isopen {
+		return nil, base.ErrNotOpened
+	}
+	if len(items) == 0 {
+		return nil, base.ErrNothingToRead
+	}
+
+	chunks, err := d.getchunks(items)
+	if err != nil {
+		return nil, err
+	}
+	return &getliststream{master: d, chunks: chunks}, nil
+}
@@ -0,0 +1,157 @@
+package dlmsal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func getlistitems(n int) []DlmsLNRequestItem {
+	items := make([]DlmsLNRequestItem, n)
+	for i := range items {
+		items[i] = DlmsLNRequestItem{ClassId: 1, Obis: DlmsObis{A: 0, B: 0, C: 96, D: 1, E: byte(i), F: 255}, Attribute: 2}
+	}
+	return items
+}
+
+func TestGetChunks(t *testing.T) {
+	items := getlistitems(30)
+	tests := []struct {
+		name   string
+		cipher CipheredApdu
+		chunks int
+	}{
+		{"service specific", CipheredApduServiceSpecific, 3},
+		{"general glo", CipheredApduGeneralGloDed, 4},
+		{"general", CipheredApduGeneral, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &dlmsal{settings: &DlmsSettings{CipheredApdu: tt.cipher}, maxPduSendSize: 128}
+			chunks, err := d.getchunks(items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunks) != tt.chunks {
+				t.Errorf("expected %d chunks, got %d", tt.chunks, len(chunks))
+			}
+			limit := 128 - 16 - d.cipheroverhead()
+			var all []DlmsLNRequestItem
+			for i, c := range chunks {
+				var b bytes.Buffer
+				for j := range c {
+					if err := encodelngetitem(&b, &c[j]); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if b.Len() > limit {
+					t.Errorf("chunk %d has %d bytes, limit is %d", i, b.Len(), limit)
+				}
+				all = append(all, c...)
+			}
+			if len(all) != len(items) {
+				t.Fatalf("%d items in chunks", len(all))
+			}
+			for i := range all {
+				if all[i].Obis != items[i].Obis {
+					t.Errorf("item %d out of order", i)
+				}
+			}
+		})
+	}
+
+	// without multiple references every item is requested alone
+	d := &dlmsal{settings: &DlmsSettings{}, maxPduSendSize: 128, aareres: AAResponse{initiateResponse: &initiateResponse{NegotiatedConformance: ConformanceBlockGet}}}
+	chunks, err := d.getchunks(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != len(items) {
+		t.Fatalf("expected single item chunks, got %d", len(chunks))
+	}
+	for i := range chunks {
+		if len(chunks[i]) != 1 || chunks[i][0].Obis != items[i].Obis {
+			t.Errorf("unexpected chunk %d: %v", i, chunks[i])
+		}
+	}
+}
+
+func TestGetListStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		general     bool   // general-ciphering with the biggest overhead
+		conformance uint32 // removed from the client proposal
+		requests    int
+		prefix      []byte
+	}{
+		{"plain", false, 0, 3, []byte{byte(TagGetRequest), byte(TagGetRequestWithList)}},
+		{"general ciphering", true, 0, 6, nil},
+		{"no multiple references", false, ConformanceBlockMultipleReferences, 30, []byte{byte(TagGetRequest), byte(TagGetRequestNormal)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := getlistitems(30)
+			h := newtesthandler()
+			for i := range items {
+				if i != 7 { // missing one ends with data access error
+					h.ln[items[i].Obis] = DlmsData{Tag: TagLongUnsigned, Value: uint16(i)}
+				}
+			}
+			var requests int
+			client, server := newtestpipe()
+			client.onsend = countmessages(t, tt.prefix, &requests)
+			ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+			cs := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+			if !tt.general {
+				ss = testsettings(t, NewSettingsBuilderLN())
+				cs = testsettings(t, NewSettingsBuilderLN())
+			} else {
+				ss.CipheredApdu = CipheredApduGeneral
+				cs.CipheredApdu = CipheredApduGeneral
+			}
+			ss.MaxPduRecvSize = 128
+			cs.MaxPduRecvSize = 128
+			cs.ConformanceBlock &^= tt.conformance
+			_, stop := startserveron(t, client, server, ss, h)
+			defer stop()
+			c := New(client, cs)
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			requests = 0
+
+			s, err := c.GetListStream(items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			for i := range items {
+				str, err := s.Next()
+				if i == 7 {
+					var e *DlmsError
+					if !errors.As(err, &e) || e.Result != TagResultObjectUndefined {
+						t.Errorf("expected data access error, got %v", err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("item %d: %v", i, err)
+				}
+				d, err := str.NextElement()
+				if err != nil {
+					t.Fatalf("item %d: %v", i, err)
+				}
+				if d.Data.Value != uint16(i) {
+					t.Errorf("item %d out of order: %v", i, d.Data.Value)
+				}
+			}
+			if _, err = s.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("expected end of list, got %v", err)
+			}
+			if requests != tt.requests {
+				t.Errorf("expected %d requests, got %d", tt.requests, requests)
+			}
+		})
+	}
+}
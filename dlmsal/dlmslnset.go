@@ -7,7 +7,6 @@ import (
 	"io"
 
 	"github.com/cybroslabs/libdlms-go/base"
-	"github.com/cybroslabs/libdlms-go/gcm"
 )
 
 func encodelnsetitem(dst *bytes.Buffer, item *DlmsLNRequestItem) error {
@@ -29,9 +28,9 @@ func (al *dlmsal) setsingle(item DlmsLNRequestItem) ([]DlmsResultTag, error) {
 	local := &al.pdu
 	local.Reset()
 	local.WriteByte(byte(TagSetRequest))
+	local.WriteByte(byte(TagSetRequestNormal))
 	al.invokeid = (al.invokeid + 1) & 7
 	local.WriteByte(al.invokeid | al.settings.invokebyte)
-	local.WriteByte(byte(TagSetRequestNormal))
 	err := encodelnsetitem(local, &item)
 	if err != nil {
 		return nil, err
@@ -45,14 +44,14 @@ func (al *dlmsal) setsingle(item DlmsLNRequestItem) ([]DlmsResultTag, error) {
 
 	ret := make([]DlmsResultTag, 1)
 
-	if local.Len()+sdata.Len() > al.maxPduSendSize-6-gcm.GCM_TAG_LENGTH { // block transfer, count on 6 bytes for tag and worst length and tag, ok, possible byte wasting here
+	if !al.usegbt() && local.Len()+sdata.Len() > al.maxPduSendSize-6-al.cipheroverhead() { // block transfer, count on 6 bytes for tag and worst length and tag, ok, possible byte wasting here
 		local.Reset() // possible large memory allocated here, but only for one job
 		local.WriteByte(byte(TagSetRequest))
-		local.WriteByte(al.invokeid | al.settings.invokebyte)
 		local.WriteByte(byte(TagSetRequestWithFirstDataBlock))
+		local.WriteByte(al.invokeid | al.settings.invokebyte)
 		_ = encodelnsetitem(local, &item)
 
-		if al.maxPduSendSize < 16+gcm.GCM_TAG_LENGTH+local.Len() {
+		if al.maxPduSendSize < 16+al.cipheroverhead()+local.Len() {
 			return nil, fmt.Errorf("too small max pdu size for block transfer")
 		}
 		data := sdata.Bytes()
@@ -60,8 +59,8 @@ func (al *dlmsal) setsingle(item DlmsLNRequestItem) ([]DlmsResultTag, error) {
 		last := false
 		for !last {
 			var ts int
-			if len(data) > al.maxPduSendSize-16-gcm.GCM_TAG_LENGTH-local.Len() { // 11 bytes for my length and possible gcm length
-				ts = al.maxPduSendSize - 16 - gcm.GCM_TAG_LENGTH - local.Len()
+			if len(data) > al.maxPduSendSize-16-al.cipheroverhead()-local.Len() { // 11 bytes for my length and possible gcm length
+				ts = al.maxPduSendSize - 16 - al.cipheroverhead() - local.Len()
 				last = false
 			} else {
 				ts = len(data)
@@ -88,12 +87,7 @@ func (al *dlmsal) setsingle(item DlmsLNRequestItem) ([]DlmsResultTag, error) {
 			switch tag {
 			case TagSetResponse:
 			case TagExceptionResponse:
-				d, err := decodeException(str, &al.tmpbuffer)
-				if err != nil {
-					return nil, err
-				}
-				ret[0] = (d.Value.(*DlmsError)).Result
-				return ret, nil
+				return nil, decodeException(str, &al.tmpbuffer)
 			default:
 				return nil, fmt.Errorf("unexpected tag: %02x", tag)
 			}
@@ -116,8 +110,8 @@ func (al *dlmsal) setsingle(item DlmsLNRequestItem) ([]DlmsResultTag, error) {
 				// ask for another block
 				local.Reset()
 				local.WriteByte(byte(TagSetRequest))
-				local.WriteByte(al.invokeid | al.settings.invokebyte)
 				local.WriteByte(byte(TagSetRequestWithDataBlock))
+				local.WriteByte(al.invokeid | al.settings.invokebyte)
 				blno++
 			case TagSetResponseLastDataBlock:
 				if !last {
@@ -144,12 +138,7 @@ func (al *dlmsal) setsingle(item DlmsLNRequestItem) ([]DlmsResultTag, error) {
 		switch tag {
 		case TagSetResponse:
 		case TagExceptionResponse:
-			d, err := decodeException(str, &al.tmpbuffer)
-			if err != nil {
-				return nil, err
-			}
-			ret[0] = (d.Value.(*DlmsError)).Result
-			return ret, nil
+			return nil, decodeException(str, &al.tmpbuffer)
 		default:
 			return nil, fmt.Errorf("unexpected tag: %02x", tag)
 		}
@@ -187,9 +176,9 @@ func (al *dlmsal) Set(items []DlmsLNRequestItem) (ret []DlmsResultTag, err error
 	local := &al.pdu
 	local.Reset()
 	local.WriteByte(byte(TagSetRequest))
+	local.WriteByte(byte(TagSetRequestWithList))
 	al.invokeid = (al.invokeid + 1) & 7
 	local.WriteByte(al.invokeid | al.settings.invokebyte)
-	local.WriteByte(byte(TagSetRequestWithList))
 	encodelength(local, uint(len(items)))
 	for _, i := range items {
 		err = encodelnsetitem(local, &i)
@@ -209,17 +198,17 @@ func (al *dlmsal) Set(items []DlmsLNRequestItem) (ret []DlmsResultTag, err error
 
 	ret = make([]DlmsResultTag, len(items))
 
-	if local.Len()+sdata.Len() > al.maxPduSendSize-6-gcm.GCM_TAG_LENGTH { // block transfer, count on 6 bytes for tag and worst length and tag, ok, possible byte wasting here
+	if !al.usegbt() && local.Len()+sdata.Len() > al.maxPduSendSize-6-al.cipheroverhead() { // block transfer, count on 6 bytes for tag and worst length and tag, ok, possible byte wasting here
 		local.Reset()
 		local.WriteByte(byte(TagSetRequest))
-		local.WriteByte(al.invokeid | al.settings.invokebyte)
 		local.WriteByte(byte(TagSetRequestWithListAndFirstDataBlock)) // yes yes i can force content to this
+		local.WriteByte(al.invokeid | al.settings.invokebyte)
 		encodelength(local, uint(len(items)))
 		for _, i := range items {
 			_ = encodelnsetitem(local, &i)
 		}
 
-		if al.maxPduSendSize < 16+gcm.GCM_TAG_LENGTH+local.Len() {
+		if al.maxPduSendSize < 16+al.cipheroverhead()+local.Len() {
 			return nil, fmt.Errorf("too small max pdu size for block transfer")
 		}
 		data := sdata.Bytes()
@@ -227,8 +216,8 @@ func (al *dlmsal) Set(items []DlmsLNRequestItem) (ret []DlmsResultTag, err error
 		last := false
 		for !last {
 			var ts int
-			if len(data) > al.maxPduSendSize-16-gcm.GCM_TAG_LENGTH-local.Len() { // 11 bytes for my length and possible gcm length
-				ts = al.maxPduSendSize - 16 - gcm.GCM_TAG_LENGTH - local.Len()
+			if len(data) > al.maxPduSendSize-16-al.cipheroverhead()-local.Len() { // 11 bytes for my length and possible gcm length
+				ts = al.maxPduSendSize - 16 - al.cipheroverhead() - local.Len()
 				last = false
 			} else {
 				ts = len(data)
@@ -255,14 +244,7 @@ func (al *dlmsal) Set(items []DlmsLNRequestItem) (ret []DlmsResultTag, err error
 			switch tag {
 			case TagSetResponse:
 			case TagExceptionResponse:
-				d, err := decodeException(str, &al.tmpbuffer)
-				if err != nil {
-					return nil, err
-				}
-				for i := 0; i < len(items); i++ {
-					ret[i] = (d.Value.(*DlmsError)).Result
-				}
-				return ret, nil
+				return nil, decodeException(str, &al.tmpbuffer)
 			default:
 				return nil, fmt.Errorf("unexpected tag: %02x", tag)
 			}
@@ -289,8 +271,8 @@ func (al *dlmsal) Set(items []DlmsLNRequestItem) (ret []DlmsResultTag, err error
 				// ask for another block
 				local.Reset()
 				local.WriteByte(byte(TagSetRequest))
-				local.WriteByte(al.invokeid | al.settings.invokebyte)
 				local.WriteByte(byte(TagSetRequestWithDataBlock))
+				local.WriteByte(al.invokeid | al.settings.invokebyte)
 				blno++
 			case TagSetResponseLastDataBlockWithList:
 				if !last {
@@ -313,12 +295,21 @@ func (al *dlmsal) Set(items []DlmsLNRequestItem) (ret []DlmsResultTag, err error
 				if err != nil {
 					return nil, err
 				}
-				if blno != binary.BigEndian.Uint32(al.tmpbuffer[len(items):]) {
+				if blno != binary.BigEndian.Uint32(res[len(items):]) {
 					return nil, fmt.Errorf("unexpected block number")
 				}
 				for i := 0; i < len(items); i++ {
 					ret[i] = DlmsResultTag(res[i])
 				}
+			case TagSetResponseNormal: // transfer aborted by the server, e.g. unexpected block number
+				_, err = io.ReadFull(str, al.tmpbuffer[:1])
+				if err != nil {
+					return nil, err
+				}
+				for i := 0; i < len(items); i++ {
+					ret[i] = DlmsResultTag(al.tmpbuffer[0])
+				}
+				return ret, nil
 			default:
 				return nil, fmt.Errorf("unexpected tag: %02x", al.tmpbuffer[0])
 			}
@@ -332,14 +323,7 @@ func (al *dlmsal) Set(items []DlmsLNRequestItem) (ret []DlmsResultTag, err error
 		switch tag {
 		case TagSetResponse:
 		case TagExceptionResponse:
-			d, err := decodeException(str, &al.tmpbuffer)
-			if err != nil {
-				return nil, err
-			}
-			for i := 0; i < len(items); i++ {
-				ret[i] = (d.Value.(*DlmsError)).Result
-			}
-			return ret, nil
+			return nil, decodeException(str, &al.tmpbuffer)
 		default:
 			return nil, fmt.Errorf("unexpected tag: %02x", tag)
 		}
@@ -0,0 +1,141 @@
+package dlmsal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetWithListByBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		items int
+		size  int
+		pdu   int
+	}{
+		{"few long items", 3, 200, 128},
+		{"results longer than temporary buffer", 130, 20, 2048}, // descriptors have to fit into the first block
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newtesthandler()
+			items := make([]DlmsLNRequestItem, tt.items)
+			values := make([][]byte, tt.items)
+			for i := range items {
+				obis := DlmsObis{A: 0, B: 0, C: 13, D: byte(i >> 8), E: byte(i), F: 255}
+				if i != tt.items-1 { // the last one doesnt exist
+					h.ln[obis] = DlmsData{Tag: TagOctetString, Value: []byte{}}
+				}
+				values[i] = bytes.Repeat([]byte{byte(i + 1)}, tt.size)
+				items[i] = DlmsLNRequestItem{ClassId: 1, Obis: obis, Attribute: 2, SetData: &DlmsData{Tag: TagOctetString, Value: values[i]}}
+			}
+			ss, err := NewSettingsNoAuthenticationLN()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ss.MaxPduRecvSize = tt.pdu
+			client, server := newtestpipe()
+			blocks := 0
+			client.onsend = func(m []byte) []byte {
+				if len(m) > 1 && CosemTag(m[0]) == TagSetRequest && setRequestTag(m[1]) == TagSetRequestWithDataBlock {
+					blocks++
+				}
+				return m
+			}
+			_, stop := startserveron(t, client, server, ss, h)
+			defer stop()
+
+			cs, err := NewSettingsNoAuthenticationLN()
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := New(client, cs)
+			if err = c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			rs, err := c.Set(items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rs) != tt.items {
+				t.Fatalf("expected %d results, got %d", tt.items, len(rs))
+			}
+			for i := range rs {
+				exp := TagResultSuccess
+				if i == tt.items-1 {
+					exp = TagResultObjectUndefined
+				}
+				if rs[i] != exp {
+					t.Errorf("item %d: expected %v, got %v", i, exp, rs[i])
+				}
+			}
+			if blocks < 2 {
+				t.Errorf("expected transfer by blocks, got %d next blocks", blocks)
+			}
+			h.mu.Lock()
+			for i := 0; i < tt.items-1; i++ {
+				if b, ok := h.ln[items[i].Obis].Value.([]byte); !ok || !bytes.Equal(b, values[i]) {
+					t.Errorf("value of item %d wasnt stored", i)
+				}
+			}
+			h.mu.Unlock()
+			if err = c.Close(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Set-Request choice precedes invoke-id-and-priority of every choice
+func TestSetRequestEncoding(t *testing.T) {
+	obis := DlmsObis{A: 0, B: 0, C: 13, D: 0, E: 0, F: 255}
+	long := &DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{1}, 300)}
+	short := &DlmsData{Tag: TagOctetString, Value: []byte{1}}
+	tests := []struct {
+		name    string
+		items   []DlmsLNRequestItem
+		choices []setRequestTag
+	}{
+		{"normal", []DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2, SetData: short}}, []setRequestTag{TagSetRequestNormal}},
+		{"with list", []DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2, SetData: short}, {ClassId: 1, Obis: obis, Attribute: 2, SetData: short}},
+			[]setRequestTag{TagSetRequestWithList}},
+		{"by blocks", []DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2, SetData: long}},
+			[]setRequestTag{TagSetRequestWithFirstDataBlock, TagSetRequestWithDataBlock, TagSetRequestWithDataBlock}},
+		{"with list by blocks", []DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2, SetData: long}, {ClassId: 1, Obis: obis, Attribute: 2, SetData: short}},
+			[]setRequestTag{TagSetRequestWithListAndFirstDataBlock, TagSetRequestWithDataBlock, TagSetRequestWithDataBlock}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newtesthandler()
+			h.ln[obis] = DlmsData{Tag: TagOctetString, Value: []byte{}}
+			ss := testsettings(t, NewSettingsBuilderLN())
+			ss.MaxPduRecvSize = 128
+			client, server := newtestpipe()
+			var requests [][]byte
+			client.onsend = func(m []byte) []byte {
+				if CosemTag(m[0]) == TagSetRequest {
+					requests = append(requests, m)
+				}
+				return m
+			}
+			_, stop := startserveron(t, client, server, ss, h)
+			defer stop()
+			cs := testsettings(t, NewSettingsBuilderLN())
+			c := New(client, cs)
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Set(tt.items); err != nil {
+				t.Fatal(err)
+			}
+			if len(requests) < len(tt.choices) {
+				t.Fatalf("expected at least %d requests, got %d", len(tt.choices), len(requests))
+			}
+			for i, m := range requests {
+				exp := tt.choices[min(i, len(tt.choices)-1)]
+				if setRequestTag(m[1]) != exp || m[2] != cs.invokebyte|1 {
+					t.Errorf("request %d starts with %x, expected choice %d and invoke id %02x", i, m[:3], exp, cs.invokebyte|1)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1010 @@
+package dlmsal
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"sync"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"github.com/cybroslabs/libdlms-go/gcm"
+	"go.uber.org/zap"
+)
+
+const (
+	maxserverpdu = 1 << 20 // hard limit for received apdu, not to be flooded by garbage
+
+	serverStateIdle        = 0 // no association
+	serverStatePendingAuth = 1 // association accepted, waiting for hls pass 3
+	serverStateAssociated  = 2
+
+	cipheringNone      = 0
+	cipheringGlobal    = 1
+	cipheringDedicated = 2
+)
+
+// object handler for server side, errors are returned as data access results, so DlmsData with TagError in case of get/read
+type DlmsServerHandler interface {
+	Get(item *DlmsLNRequestItem) DlmsData
+	Set(item *DlmsLNRequestItem) DlmsResultTag
+	Action(item *DlmsLNRequestItem) (*DlmsData, DlmsResultTag) // item.SetData are action parameters, can be nil
+	Read(item *DlmsSNRequestItem) DlmsData
+	Write(item *DlmsSNRequestItem) DlmsResultTag
+}
+
+type DlmsServer interface {
+	Serve() error // serve requests till the peer disconnects, so till EOF from transport
+	Disconnect() error
+	SetLogger(logger *zap.SugaredLogger)
+}
+
+type initiateRequest struct {
+	DedicatedKey             []byte
+	ResponseAllowed          bool
+	ProposedQualityOfService byte
+	ProposedDlmsVersion      byte
+	ProposedConformance      uint32
+	ClientMaxReceivePduSize  uint16
+}
+
+type dlmsserver struct {
+	al          dlmsal       // reusing buffers, transport and ciphering of the client side, aareres.SystemTitle is client systitle here
+	settings    DlmsSettings // private copy, association state is kept here
+	initerr     error        // keys of the copy couldnt be created, returned by Serve
+	handler     DlmsServerHandler
+	state       int
+	conformance uint32 // negotiated one
+	ctos        []byte
+	ciphering   int  // how was the last request ciphered, response is ciphered the same way
+	gbt         bool // last request came by general block transfer, response is sent the same way
+	invoke      byte // invoke id and priority of the current request
+
+	// outgoing blocks (get response with data block, action response with pblock)
+	blocktag  CosemTag
+	blockdata []byte
+	blockno   uint32
+
+	// incoming blocks (set with data block, action with pblock)
+	intag     CosemTag
+	inlist    bool
+	initems   []DlmsLNRequestItem
+	indata    bytes.Buffer
+	inblockno uint32
+}
+
+// in-memory frame counter stores shared by servers of the same settings without FrameCounterStore
+var serverframecounters sync.Map
+
+// server uses the same settings as client, password is expected password in case of low authentication or own challenge (StoC) in case of hls,
+// systemtitle and gcm are server ones. Settings can be shared by more connections, every server gets its own copy of keys, ciphering
+// and received counters, invocation counters are taken from the FrameCounterStore of the settings, so they are never reused under
+// the same key, servers of settings without the store share in-memory one kept for the settings, the settings itself are not changed
+func NewServer(transport base.Stream, settings *DlmsSettings, handler DlmsServerHandler) DlmsServer {
+	ret := &dlmsserver{
+		handler: handler,
+		state:   serverStateIdle,
+	}
+	ret.initerr = ret.settings.copyfrom(settings)
+	ret.al.transport = transport
+	ret.al.settings = &ret.settings
+	return ret
+}
+
+// deep copy of the shared settings for a single association
+func (d *DlmsSettings) copyfrom(src *DlmsSettings) error {
+	*d = *src
+	if src.fcstore == nil && (src.gcm != nil || src.keyprovider != nil) {
+		store, _ := serverframecounters.LoadOrStore(src, NewMemoryFrameCounterStore(src.framecounter))
+		d.SetFrameCounterStore(store.(FrameCounterStore), src.fcreserve)
+	}
+
+	d.StoC = bytes.Clone(src.StoC)
+	d.CtoS = bytes.Clone(src.CtoS)
+	d.OtherInformation = bytes.Clone(src.OtherInformation)
+	d.password = bytes.Clone(src.password)
+	d.systemtitle = bytes.Clone(src.systemtitle)
+	d.peersystemtitle = bytes.Clone(src.peersystemtitle)
+	d.hlssecret = bytes.Clone(src.hlssecret)
+	d.ekcopy = bytes.Clone(src.ekcopy)
+	d.akcopy = bytes.Clone(src.akcopy)
+	d.dedicatedkey = bytes.Clone(src.dedicatedkey) // zeroized by release, so it cant be shared with the caller
+	d.rxframecounters = maps.Clone(src.rxframecounters)
+	d.fclimit = 0 // own range is reserved from the shared store
+
+	// gcm keeps working buffers, so it cant be used by more goroutines
+	d.gcm = nil
+	d.dedgcm = nil
+	var err error
+	switch {
+	case d.keyprovider != nil:
+		return d.resolvekeys()
+	case d.ekcopy != nil:
+		d.gcm, err = gcm.NewGCM(d.ekcopy, d.akcopy)
+		if err != nil {
+			return err
+		}
+	case src.gcm != nil:
+		return fmt.Errorf("ciphering without keys cant be copied")
+	}
+	if src.dedicatedkey != nil {
+		return d.SetDedicatedKey(src.dedicatedkey) // own copy of the key
+	}
+	return nil
+}
+
+func (s *dlmsserver) SetLogger(logger *zap.SugaredLogger) {
+	s.al.SetLogger(logger)
+}
+
+func (s *dlmsserver) Disconnect() error {
+	s.release()
+	return s.al.transport.Disconnect()
+}
+
+func (s *dlmsserver) release() {
+	s.state = serverStateIdle
+	s.ctos = nil
+	s.blockdata = nil
+	s.initems = nil
+	s.al.isopen = false
+	s.al.aareres.SystemTitle = nil
+	s.settings.cleardedicatedkey()
+}
+
+func (s *dlmsserver) Serve() error {
+	if s.initerr != nil {
+		return s.initerr
+	}
+	if err := s.al.transport.Open(); err != nil {
+		return err
+	}
+	for {
+		tag, data, err := s.recvpdu()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		err = s.dispatch(tag, data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// read whole request, decrypt it in case of ciphering, returns tag and the rest of the apdu
+func (s *dlmsserver) recvpdu() (tag CosemTag, data []byte, err error) {
+	al := &s.al
+	_, err = io.ReadFull(al.transport, al.tmpbuffer[:1])
+	if err != nil {
+		return
+	}
+	tag = CosemTag(al.tmpbuffer[0])
+	var str io.Reader = al.transport
+	s.gbt = tag == TagGeneralBlockTransfer
+	if s.gbt { // answer is sent the same way
+		str, err = al.newgbtreader()
+		if err != nil {
+			return
+		}
+		_, err = io.ReadFull(str, al.tmpbuffer[:1])
+		if err != nil {
+			return
+		}
+		tag = CosemTag(al.tmpbuffer[0])
+	}
+	s.settings.SignApdus = tag == TagGeneralSigning // answer is signed the same way
+	if s.settings.SignApdus {
+		var content []byte
+		content, err = al.verifysignedpdu(str)
+		if err != nil {
+			return
+		}
+		tag = CosemTag(content[0])
+		str = bytes.NewReader(content[1:])
+	}
+	s.ciphering = cipheringNone
+	s.settings.CipheredApdu = CipheredApduServiceSpecific
+	switch tag {
+	case TagGloGetRequest, TagGloSetRequest, TagGloActionRequest, TagGloReadRequest, TagGloWriteRequest, TagGloUnconfirmedWriteRequest:
+		s.ciphering = cipheringGlobal
+		tag, str, err = al.recvcipheredpdu(str, tag, false)
+	case TagDedGetRequest, TagDedSetRequest, TagDedActionRequest, TagDedReadRequest, TagDedWriteRequest, TagDedUnconfirmedWriteRequest:
+		s.ciphering = cipheringDedicated
+		tag, str, err = al.recvcipheredpdu(str, tag, true)
+	case TagGeneralGloCiphering, TagGeneralCiphering:
+		s.ciphering = cipheringGlobal
+		s.settings.CipheredApdu = CipheredApduGeneralGloDed
+		if tag == TagGeneralCiphering {
+			s.settings.CipheredApdu = CipheredApduGeneral
+		}
+		tag, str, err = al.recvgeneralpdu(str, tag)
+	case TagGeneralDedCiphering:
+		s.ciphering = cipheringDedicated
+		s.settings.CipheredApdu = CipheredApduGeneralGloDed
+		tag, str, err = al.recvgeneralpdu(str, tag)
+	}
+	if err != nil {
+		return
+	}
+	data, err = io.ReadAll(io.LimitReader(str, maxserverpdu))
+	if err != nil {
+		return
+	}
+	if al.logger != nil {
+		al.logger.Debugf(base.LogHex(fmt.Sprintf("request %v", tag), data))
+	}
+	return
+}
+
+func (s *dlmsserver) dispatch(tag CosemTag, data []byte) error {
+	switch tag {
+	case TagAARQ:
+		return s.aarq(data)
+	case TagRLRQ:
+		s.release()
+		return s.al.transport.Write([]byte{byte(TagRLRE), 0x03, BERTypeContext, 0x01, byte(ReleaseRequestReasonNormal)})
+	}
+
+	if s.state == serverStateIdle {
+		if tag == TagUnconfirmedWriteRequest { // nothing is answered to unconfirmed service
+			return nil
+		}
+		return s.exception(1, 1) // service not allowed, operation not possible
+	}
+	src := bytes.NewBuffer(data)
+	switch tag {
+	case TagGetRequest:
+		return s.get(src)
+	case TagSetRequest:
+		return s.set(src)
+	case TagActionRequest:
+		return s.action(src)
+	case TagReadRequest:
+		return s.read(src)
+	case TagWriteRequest:
+		return s.write(src)
+	case TagUnconfirmedWriteRequest:
+		return s.unconfirmedwrite(src)
+	}
+	s.al.logf("unsupported request tag: %v", tag)
+	return s.exception(2, 2) // service unknown, service not supported
+}
+
+func cipheredresponsetag(tag CosemTag, ded bool) (CosemTag, error) {
+	if ded {
+		switch tag {
+		case TagGetResponse:
+			return TagDedGetResponse, nil
+		case TagSetResponse:
+			return TagDedSetResponse, nil
+		case TagActionResponse:
+			return TagDedActionResponse, nil
+		case TagReadResponse:
+			return TagDedReadResponse, nil
+		case TagWriteResponse:
+			return TagDedWriteResponse, nil
+		}
+	} else {
+		switch tag {
+		case TagGetResponse:
+			return TagGloGetResponse, nil
+		case TagSetResponse:
+			return TagGloSetResponse, nil
+		case TagActionResponse:
+			return TagGloActionResponse, nil
+		case TagReadResponse:
+			return TagGloReadResponse, nil
+		case TagWriteResponse:
+			return TagGloWriteResponse, nil
+		}
+	}
+	return tag, fmt.Errorf("unsupported tag %v", tag)
+}
+
+// send response from pdu buffer, ciphered the same way as request
+func (s *dlmsserver) sendpdu() error {
+	al := &s.al
+	b := al.pdu.Bytes()
+	if len(b) == 0 {
+		return fmt.Errorf("empty pdu")
+	}
+	if CosemTag(b[0]) != TagExceptionResponse {
+		switch {
+		case s.ciphering != cipheringNone && s.settings.CipheredApdu != CipheredApduServiceSpecific:
+			var err error
+			b, err = al.encryptgeneral(b, s.ciphering == cipheringDedicated)
+			if err != nil {
+				return err
+			}
+		case s.ciphering == cipheringGlobal:
+			tag, err := cipheredresponsetag(CosemTag(b[0]), false)
+			if err != nil {
+				return err
+			}
+			b, err = al.encryptpacket(byte(tag), b, false)
+			if err != nil {
+				return err
+			}
+		case s.ciphering == cipheringDedicated:
+			tag, err := cipheredresponsetag(CosemTag(b[0]), true)
+			if err != nil {
+				return err
+			}
+			b, err = al.encryptpacket(byte(tag), b, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if s.settings.SignApdus {
+		var err error
+		b, err = al.signpdu(b)
+		if err != nil {
+			return err
+		}
+	}
+	if s.gbt {
+		return al.sendgbt(b)
+	}
+	return al.transport.Write(b)
+}
+
+func (s *dlmsserver) exception(stateerror byte, serviceerror byte) error {
+	local := &s.al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagExceptionResponse))
+	local.WriteByte(stateerror)
+	local.WriteByte(serviceerror)
+	return s.sendpdu()
+}
+
+// usable size of data in a single block, tag, invoke, subtag are already in the local buffer
+func (s *dlmsserver) blocksize() int {
+	return s.al.maxPduSendSize - 16 - s.al.cipheroverhead() - s.al.pdu.Len()
+}
+
+// check if the rest of the response fits into pdu, ciphering overhead included, general block transfer has no limit
+func (s *dlmsserver) fits(l int) bool {
+	return s.gbt || s.al.maxPduSendSize == 0 || s.al.pdu.Len()+l <= s.al.maxPduSendSize-11-s.al.cipheroverhead()
+}
+
+// --- association part
+
+func parseMechanismName(tag *aaretag) (out Authentication, err error) {
+	if len(tag.data) != 7 {
+		err = fmt.Errorf("invalid 8B tag length")
+		return
+	}
+	if !bytes.Equal(tag.data[:6], []byte{0x60, 0x85, 0x74, 0x05, 0x08, 0x02}) {
+		err = fmt.Errorf("invalid 8B tag content")
+		return
+	}
+	out = Authentication(tag.data[6])
+	return
+}
+
+func decodeInitiateRequest(src []byte) (out initiateRequest, err error) {
+	if len(src) < 1 {
+		err = fmt.Errorf("invalid initiate request length")
+		return
+	}
+	if src[0] != 0 { // dedicated key
+		if len(src) < 2 || len(src) < 2+int(src[1]) {
+			err = fmt.Errorf("invalid initiate request length")
+			return
+		}
+		out.DedicatedKey = newcopy(src[2 : 2+int(src[1])])
+		src = src[2+int(src[1]):]
+	} else {
+		src = src[1:]
+	}
+	out.ResponseAllowed = true // default value
+	if len(src) < 1 {
+		err = fmt.Errorf("invalid initiate request length")
+		return
+	}
+	if src[0] != 0 {
+		if len(src) < 2 {
+			err = fmt.Errorf("invalid initiate request length")
+			return
+		}
+		out.ResponseAllowed = src[1] != 0
+		src = src[2:]
+	} else {
+		src = src[1:]
+	}
+	if len(src) < 1 {
+		err = fmt.Errorf("invalid initiate request length")
+		return
+	}
+	if src[0] != 0 {
+		if len(src) < 2 {
+			err = fmt.Errorf("invalid initiate request length")
+			return
+		}
+		out.ProposedQualityOfService = src[1]
+		src = src[2:]
+	} else {
+		src = src[1:]
+	}
+	if len(src) < 10 {
+		err = fmt.Errorf("invalid initiate request length")
+		return
+	}
+	out.ProposedDlmsVersion = src[0]
+	if !bytes.Equal(src[1:5], []byte{0x5F, 0x1F, 0x04, 0x00}) {
+		err = fmt.Errorf("invalid initiate request content")
+		return
+	}
+	out.ProposedConformance = binary.BigEndian.Uint32(src[4:8])
+	out.ClientMaxReceivePduSize = binary.BigEndian.Uint16(src[8:10])
+	return
+}
+
+func (s *dlmsserver) parsexdlms(xdlms []byte) (ir initiateRequest, ciphered bool, err error) {
+	if len(xdlms) < 2 {
+		err = fmt.Errorf("invalid xdlms length")
+		return
+	}
+	switch CosemTag(xdlms[0]) {
+	case TagInitiateRequest:
+		ir, err = decodeInitiateRequest(xdlms[1:])
+		return
+	case TagGloInitiateRequest:
+		if s.settings.gcm == nil {
+			return ir, true, fmt.Errorf("GCM not initialized")
+		}
+		ln, c, err := decodelength(bytes.NewBuffer(xdlms[1:]), &s.al.tmpbuffer)
+		if err != nil {
+			return ir, true, err
+		}
+		xdlms = xdlms[1+c:]
+		if len(xdlms) < int(ln) || ln < 5 {
+			return ir, true, fmt.Errorf("invalid xDlms tag length")
+		}
+		dec, err := s.al.decryptpacket(xdlms[:ln], false)
+		if err != nil {
+			return ir, true, err
+		}
+		if len(dec) < 2 || CosemTag(dec[0]) != TagInitiateRequest {
+			return ir, true, fmt.Errorf("invalid ciphered initiate request")
+		}
+		ir, err = decodeInitiateRequest(dec[1:])
+		return ir, true, err
+	}
+	err = fmt.Errorf("unexpected user information tag %02x", xdlms[0])
+	return
+}
+
+func (s *dlmsserver) aarq(data []byte) error {
+	al := &s.al
+	st := &s.settings
+	s.release()
+
+	l, c, err := decodelength(bytes.NewBuffer(data), &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	if len(data) < c+int(l) {
+		return fmt.Errorf("invalid aarq length")
+	}
+	tags, err := decodeaare(data[c:c+int(l)], &al.tmpbuffer)
+	if err != nil {
+		return fmt.Errorf("unable to parse aarq: %w", err)
+	}
+
+	var appctx ApplicationContext
+	mech := AuthenticationNone
+	var secvalue []byte
+	var xdlms []byte
+	for _, dt := range tags {
+		switch dt.tag {
+		case BERTypeContext | BERTypeConstructed | PduTypeApplicationContextName: // 0xa1
+			appctx, err = parseApplicationContextName(&dt)
+		case BERTypeContext | BERTypeConstructed | PduTypeCallingAPTitle: // 0xa6
+			al.aareres.SystemTitle, err = parseAPTitle(&dt, &al.tmpbuffer)
+		case BERTypeContext | PduTypeSenderAcseRequirements: // 0x8a
+		case BERTypeContext | PduTypeMechanismName: // 0x8b
+			mech, err = parseMechanismName(&dt)
+		case BERTypeContext | BERTypeConstructed | PduTypeCallingAuthenticationValue: // 0xac
+			secvalue, err = parseSenderAcseRequirements(&dt, &al.tmpbuffer) // the same inner 0x80 tag
+		case BERTypeContext | BERTypeConstructed | PduTypeUserInformation: // 0xbe
+			var t byte
+			t, _, xdlms, err = decodetag(dt.data, &al.tmpbuffer)
+			if err == nil && t != 0x04 {
+				err = fmt.Errorf("invalid BE tag content")
+			}
+		default:
+			al.logf("Unknown tag: %02x", dt.tag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if appctx != st.applicationContext {
+		return s.aare(AssociationResultPermanentRejected, SourceDiagnosticApplicationContextNameNotSupported, nil)
+	}
+	if mech != st.authentication {
+		return s.aare(AssociationResultPermanentRejected, SourceDiagnosticAuthenticationMechanismNameNotRecognized, nil)
+	}
+	if xdlms == nil {
+		return s.aare(AssociationResultPermanentRejected, SourceDiagnosticNoReasonGiven, nil)
+	}
+	if (st.gcm != nil || mech == AuthenticationHighSha256 || mech == AuthenticationHighEcdsa) && len(al.aareres.SystemTitle) != 8 {
+		return s.aare(AssociationResultPermanentRejected, SourceDiagnosticCallingAPTitleNotRecognized, nil)
+	}
+
+	diag := SourceDiagnosticNone
+	switch mech {
+	case AuthenticationNone:
+	case AuthenticationLow:
+		if subtle.ConstantTimeCompare(secvalue, st.password) != 1 {
+			return s.aare(AssociationResultPermanentRejected, SourceDiagnosticAuthenticationFailure, nil)
+		}
+	case AuthenticationHighGmac, AuthenticationHighMD5, AuthenticationHighSHA1, AuthenticationHighSha256, AuthenticationHighEcdsa:
+		if len(secvalue) == 0 {
+			return s.aare(AssociationResultPermanentRejected, SourceDiagnosticAuthenticationFailure, nil)
+		}
+		s.ctos = secvalue
+		diag = SourceDiagnosticAuthenticationRequired
+	default:
+		return s.aare(AssociationResultPermanentRejected, SourceDiagnosticAuthenticationMechanismNameNotRecognized, nil)
+	}
+
+	ir, ciphered, err := s.parsexdlms(xdlms)
+	if err != nil {
+		al.logf("unable to parse initiate request: %v", err)
+		return s.aare(AssociationResultPermanentRejected, SourceDiagnosticNoReasonGiven, nil)
+	}
+	if ir.ProposedDlmsVersion < DlmsVersion {
+		return s.aare(AssociationResultPermanentRejected, SourceDiagnosticNoReasonGiven, nil)
+	}
+	if ir.DedicatedKey != nil {
+		if err = st.SetDedicatedKey(ir.DedicatedKey); err != nil {
+			return err
+		}
+	}
+	s.conformance = ir.ProposedConformance & st.ConformanceBlock
+	al.maxPduSendSize = int(ir.ClientMaxReceivePduSize)
+
+	xres := make([]byte, 14)
+	xres[0] = byte(TagInitiateResponse)
+	xres[1] = 0x00 // no quality of service
+	xres[2] = DlmsVersion
+	xres[3] = 0x5f
+	xres[4] = 0x1f
+	xres[5] = 0x04
+	binary.BigEndian.PutUint32(xres[6:], s.conformance)
+	xres[10] = byte(st.MaxPduRecvSize >> 8)
+	xres[11] = byte(st.MaxPduRecvSize)
+	xres[12] = byte(st.VAAddress >> 8)
+	xres[13] = byte(st.VAAddress)
+	if ciphered {
+		xres, err = al.encryptpacket(byte(TagGloInitiateResponse), xres, false)
+		if err != nil {
+			return err
+		}
+		xres = newcopy(xres)
+	}
+
+	if diag == SourceDiagnosticAuthenticationRequired {
+		s.state = serverStatePendingAuth
+	} else {
+		s.state = serverStateAssociated
+	}
+	al.isopen = true
+	return s.aare(AssociationResultAccepted, diag, xres)
+}
+
+func (s *dlmsserver) aare(result AssociationResult, diag SourceDiagnostic, xdlms []byte) error {
+	st := &s.settings
+	var content bytes.Buffer
+	putappctxname(&content, st)
+	content.Write([]byte{BERTypeContext | BERTypeConstructed | PduTypeCalledAPTitle, 0x03, 0x02, 0x01, byte(result)})               // 0xa2
+	content.Write([]byte{BERTypeContext | BERTypeConstructed | PduTypeCalledAEQualifier, 0x05, 0xa1, 0x03, 0x02, 0x01, byte(diag)}) // 0xa3
+	if st.systemtitle != nil {
+		encodetag2(&content, BERTypeContext|BERTypeConstructed|PduTypeCalledAPInvocationID, 0x04, st.systemtitle) // 0xa4, responding ap title
+	}
+	if diag == SourceDiagnosticAuthenticationRequired {
+		encodetag(&content, BERTypeContext|PduTypeCallingAPInvocationID, []byte{0x07, 0x80}) // 0x88, responder acse requirements
+		content.WriteByte(BERTypeContext | PduTypeCallingAEInvocationID)                     // 0x89, mechanism name
+		content.Write([]byte{0x07, 0x60, 0x85, 0x74, 0x05, 0x08, 0x02})
+		content.WriteByte(byte(st.authentication))
+		encodetag2(&content, BERTypeContext|BERTypeConstructed|PduTypeSenderAcseRequirements, 0x80, st.password) // 0xaa, responding authentication value, so stoc
+	}
+	if xdlms != nil {
+		encodetag2(&content, BERTypeContext|BERTypeConstructed|PduTypeUserInformation, 0x04, xdlms)
+	}
+
+	var buf bytes.Buffer
+	encodetag(&buf, byte(TagAARE), content.Bytes())
+	if result != AssociationResultAccepted {
+		s.al.logf("association rejected: %v, diagnostic: %v", result, diag)
+	}
+	return s.al.transport.Write(buf.Bytes())
+}
+
+// reply_to_HLS_authentication of the current association, returns stoc hash
+func (s *dlmsserver) replytohls(data *DlmsData) (*DlmsData, DlmsResultTag) {
+	st := &s.settings
+	if data == nil {
+		return nil, TagResultTypeUnmatched
+	}
+	var req []byte
+	if err := Cast(&req, *data); err != nil {
+		return nil, TagResultTypeUnmatched
+	}
+
+	switch st.authentication {
+	case AuthenticationHighGmac:
+		if st.gcm == nil || len(req) != 5+gcm.GCM_TAG_LENGTH || req[0] != byte(SecurityAuthentication) {
+			return nil, TagResultReadWriteDenied
+		}
+		e, err := st.gcm.Encrypt(nil, req[0], binary.BigEndian.Uint32(req[1:]), s.al.aareres.SystemTitle, st.password)
+		if err != nil || len(e) < gcm.GCM_TAG_LENGTH || !bytes.Equal(req[5:], e[len(e)-gcm.GCM_TAG_LENGTH:]) {
+			s.al.logf("hls authentication failed")
+			return nil, TagResultReadWriteDenied
+		}
+		fc, err := st.nextframecounter()
+		if err != nil {
+			return nil, TagResultOtherReason
+		}
+		r, err := st.gcm.Encrypt(nil, byte(SecurityAuthentication), fc, st.systemtitle, s.ctos)
+		if err != nil {
+			return nil, TagResultOtherReason
+		}
+		hashresp := make([]byte, 5+gcm.GCM_TAG_LENGTH)
+		hashresp[0] = byte(SecurityAuthentication)
+		binary.BigEndian.PutUint32(hashresp[1:], fc)
+		copy(hashresp[5:], r[len(r)-gcm.GCM_TAG_LENGTH:])
+		s.state = serverStateAssociated
+		return &DlmsData{Tag: TagOctetString, Value: hashresp}, TagResultSuccess
+	case AuthenticationHighMD5, AuthenticationHighSHA1, AuthenticationHighSha256:
+		e, err := hlsdigest(st.authentication, st.hlssecret, s.al.aareres.SystemTitle, st.systemtitle, st.password, s.ctos)
+		if err != nil || !bytes.Equal(req, e) {
+			s.al.logf("hls authentication failed")
+			return nil, TagResultReadWriteDenied
+		}
+		r, err := hlsdigest(st.authentication, st.hlssecret, st.systemtitle, s.al.aareres.SystemTitle, s.ctos, st.password)
+		if err != nil {
+			return nil, TagResultOtherReason
+		}
+		s.state = serverStateAssociated
+		return &DlmsData{Tag: TagOctetString, Value: r}, TagResultSuccess
+	case AuthenticationHighEcdsa:
+		err := ecdsaverify(st.peerkey, req, s.al.aareres.SystemTitle, st.systemtitle, st.password, s.ctos)
+		if err != nil {
+			s.al.logf("hls authentication failed: %v", err)
+			return nil, TagResultReadWriteDenied
+		}
+		r, err := ecdsasign(st.signkey, st.systemtitle, s.al.aareres.SystemTitle, s.ctos, st.password)
+		if err != nil {
+			return nil, TagResultOtherReason
+		}
+		s.state = serverStateAssociated
+		return &DlmsData{Tag: TagOctetString, Value: r}, TagResultSuccess
+	}
+	return nil, TagResultReadWriteDenied
+}
+
+// --- SN part
+
+func decodesnitem(src io.Reader, item *DlmsSNRequestItem, tmp *tmpbuffer) error {
+	_, err := io.ReadFull(src, tmp[:3])
+	if err != nil {
+		return err
+	}
+	item.Address = int16(binary.BigEndian.Uint16(tmp[1:]))
+	switch variableAccessTag(tmp[0]) {
+	case TagVariableAccessName:
+		item.HasAccess = false
+	case TagVariableAccessParameterized:
+		_, err = io.ReadFull(src, tmp[:1])
+		if err != nil {
+			return err
+		}
+		item.HasAccess = true
+		item.AccessDescriptor = tmp[0]
+		d, _, err := decodeDataTag(src, tmp)
+		if err != nil {
+			return err
+		}
+		item.AccessData = &d
+	default:
+		return fmt.Errorf("unsupported variable access specification: %v", tmp[0])
+	}
+	return nil
+}
+
+func (s *dlmsserver) callread(item *DlmsSNRequestItem) DlmsData {
+	if item.HasAccess && uint16(item.Address) == snReplyToHls {
+		d, r := s.replytohls(item.AccessData)
+		if r != TagResultSuccess {
+			return NewDlmsDataError(r)
+		}
+		return *d
+	}
+	if s.state != serverStateAssociated {
+		return NewDlmsDataError(TagResultReadWriteDenied)
+	}
+	return s.handler.Read(item)
+}
+
+func (s *dlmsserver) read(src *bytes.Buffer) error {
+	al := &s.al
+	l, _, err := decodelength(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	if l == 1 && src.Len() > 0 { // block transfer uses a single item
+		switch variableAccessTag(src.Bytes()[0]) {
+		case TagVariableAccessBlockNumber:
+			src.Next(1)
+			return s.nextsnblock(src)
+		case TagVariableAccessReadDataBlock:
+			src.Next(1)
+			return s.readblock(src)
+		}
+	}
+	return s.readitems(l, src)
+}
+
+func (s *dlmsserver) readitems(l uint, src *bytes.Buffer) error {
+	al := &s.al
+	if l > uint(src.Len()) {
+		return fmt.Errorf("invalid read request length")
+	}
+	items := make([]DlmsSNRequestItem, l)
+	for i := 0; i < len(items); i++ {
+		err := decodesnitem(src, &items[i], &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+	}
+
+	var content bytes.Buffer
+	encodelength(&content, uint(len(items)))
+	for i := 0; i < len(items); i++ {
+		d := s.callread(&items[i])
+		if d.Tag == TagError {
+			content.WriteByte(byte(TagReadResponseDataAccessError))
+			content.WriteByte(byte(resultfromdata(&d)))
+			continue
+		}
+		content.WriteByte(byte(TagReadResponseData))
+		err := encodeData(&content, &d)
+		if err != nil {
+			return err
+		}
+	}
+
+	local := &al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagReadResponse))
+	if !s.fits(content.Len()) {
+		return s.sendblocks(TagReadResponse, content.Bytes())
+	}
+	local.Write(content.Bytes())
+	return s.sendpdu()
+}
+
+// block of the long read request, content is processed after the last one
+func (s *dlmsserver) readblock(src *bytes.Buffer) error {
+	al := &s.al
+	_, err := io.ReadFull(src, al.tmpbuffer[:3])
+	if err != nil {
+		return err
+	}
+	last := al.tmpbuffer[0] != 0
+	blockno := uint32(binary.BigEndian.Uint16(al.tmpbuffer[1:]))
+	l, _, err := decodelength(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	if l > uint(src.Len()) {
+		return fmt.Errorf("invalid block length")
+	}
+	if blockno == 1 {
+		s.startblocks(TagReadRequest, nil, false)
+	}
+	if s.intag != TagReadRequest || blockno != s.inblockno+1 {
+		s.intag = 0
+		return s.readerror(TagResultDataBlockNumberInvalid)
+	}
+	s.inblockno = blockno
+	s.indata.Write(src.Next(int(l)))
+	if !last {
+		local := &al.pdu
+		local.Reset()
+		local.WriteByte(byte(TagReadResponse))
+		local.WriteByte(1)
+		local.WriteByte(byte(TagReadResponseBlockNumber))
+		local.WriteByte(byte(blockno >> 8))
+		local.WriteByte(byte(blockno))
+		return s.sendpdu()
+	}
+	s.intag = 0
+	content := bytes.NewBuffer(newcopy(s.indata.Bytes()))
+	s.indata.Reset()
+	n, _, err := decodelength(content, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	return s.readitems(n, content)
+}
+
+// next block of the long read response, client sends the last received block number
+func (s *dlmsserver) nextsnblock(src *bytes.Buffer) error {
+	_, err := io.ReadFull(src, s.al.tmpbuffer[:2])
+	if err != nil {
+		return err
+	}
+	blockno := binary.BigEndian.Uint16(s.al.tmpbuffer[:])
+	switch {
+	case s.blockdata == nil || s.blocktag != TagReadResponse:
+		s.blockdata = nil
+		return s.readerror(TagResultDataBlockUnavailable)
+	case blockno != uint16(s.blockno):
+		s.blockdata = nil
+		return s.readerror(TagResultDataBlockNumberInvalid)
+	}
+	return s.sendnextblock()
+}
+
+// read response with a single data-access-error
+func (s *dlmsserver) readerror(res DlmsResultTag) error {
+	local := &s.al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagReadResponse))
+	local.WriteByte(1)
+	local.WriteByte(byte(TagReadResponseDataAccessError))
+	local.WriteByte(byte(res))
+	return s.sendpdu()
+}
+
+func (s *dlmsserver) write(src *bytes.Buffer) error {
+	al := &s.al
+	l, _, err := decodelength(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	if l == 1 && src.Len() > 0 && variableAccessTag(src.Bytes()[0]) == TagVariableAccessWriteDataBlock {
+		src.Next(1)
+		return s.writeblock(src)
+	}
+	items, err := s.decodewrite(l, src)
+	if err != nil {
+		return err
+	}
+
+	local := &al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagWriteResponse))
+	encodelength(local, uint(len(items)))
+	for i := 0; i < len(items); i++ {
+		r := s.callwrite(&items[i])
+		if r == TagResultSuccess {
+			local.WriteByte(byte(TagWriteResponseSuccess))
+		} else {
+			local.WriteByte(byte(TagWriteResponseDataAccessError))
+			local.WriteByte(byte(r))
+		}
+	}
+	return s.sendpdu()
+}
+
+// the same content as write, nothing is sent back
+func (s *dlmsserver) unconfirmedwrite(src *bytes.Buffer) error {
+	l, _, err := decodelength(src, &s.al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	items, err := s.decodewrite(l, src)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(items); i++ {
+		if r := s.callwrite(&items[i]); r != TagResultSuccess {
+			s.al.logf("unconfirmed write of %04x failed: %v", uint16(items[i].Address), r)
+		}
+	}
+	return nil
+}
+
+// variable access specifications (amount is already read) and list of data
+func (s *dlmsserver) decodewrite(l uint, src *bytes.Buffer) ([]DlmsSNRequestItem, error) {
+	al := &s.al
+	if l > uint(src.Len()) {
+		return nil, fmt.Errorf("invalid write request length")
+	}
+	items := make([]DlmsSNRequestItem, l)
+	for i := 0; i < len(items); i++ {
+		err := decodesnitem(src, &items[i], &al.tmpbuffer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	l, _, err := decodelength(src, &al.tmpbuffer)
+	if err != nil {
+		return nil, err
+	}
+	if l != uint(len(items)) {
+		return nil, fmt.Errorf("different amount of data to write")
+	}
+	for i := 0; i < len(items); i++ {
+		d, _, err := decodeDataTag(src, &al.tmpbuffer)
+		if err != nil {
+			return nil, err
+		}
+		items[i].WriteData = &d
+	}
+	return items, nil
+}
+
+func (s *dlmsserver) callwrite(item *DlmsSNRequestItem) DlmsResultTag {
+	if s.state != serverStateAssociated {
+		return TagResultReadWriteDenied
+	}
+	return s.handler.Write(item)
+}
+
+// block of the long write request, raw data is sent as a single octet string, content is processed after the last one
+func (s *dlmsserver) writeblock(src *bytes.Buffer) error {
+	al := &s.al
+	_, err := io.ReadFull(src, al.tmpbuffer[:4])
+	if err != nil {
+		return err
+	}
+	last := al.tmpbuffer[0] != 0
+	blockno := uint32(binary.BigEndian.Uint16(al.tmpbuffer[1:]))
+	if al.tmpbuffer[3] != 1 {
+		return fmt.Errorf("only one data item was expected in write block")
+	}
+	d, _, err := decodeDataTag(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	raw, ok := d.Value.([]byte)
+	if d.Tag != TagOctetString || !ok {
+		return fmt.Errorf("write block has to be octet string")
+	}
+	if blockno == 1 {
+		s.startblocks(TagWriteRequest, nil, false)
+	}
+	local := &al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagWriteResponse))
+	local.WriteByte(1)
+	if s.intag != TagWriteRequest || blockno != s.inblockno+1 {
+		s.intag = 0
+		local.WriteByte(byte(TagWriteResponseDataAccessError))
+		local.WriteByte(byte(TagResultDataBlockNumberInvalid))
+		return s.sendpdu()
+	}
+	s.inblockno = blockno
+	s.indata.Write(raw)
+	if !last {
+		local.WriteByte(byte(TagWriteResponseBlockNumber))
+		local.WriteByte(byte(blockno >> 8))
+		local.WriteByte(byte(blockno))
+		return s.sendpdu()
+	}
+	s.intag = 0
+	content := bytes.NewBuffer(newcopy(s.indata.Bytes()))
+	s.indata.Reset()
+	return s.write(content)
+}
+
+func resultfromdata(d *DlmsData) DlmsResultTag {
+	if e, ok := d.Value.(*DlmsError); ok {
+		return e.Result
+	}
+	return TagResultOtherReason
+}
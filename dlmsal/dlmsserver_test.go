@@ -0,0 +1,360 @@
+package dlmsal
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// in-memory apdu pipe, written data are sent as a single message with the next read or flush,
+// read returns io.EOF at the end of each message like wrapper or hdlc do
+type testpipe struct {
+	in      chan []byte
+	out     chan []byte
+	wbuf    bytes.Buffer
+	rbuf    []byte
+	reading bool
+	once    *sync.Once
+	onsend  func(msg []byte) []byte // sees every sent message and returns the delivered one, nil means lost
+}
+
+func newtestpipe() (*testpipe, *testpipe) {
+	a := make(chan []byte, 4)
+	b := make(chan []byte, 4)
+	o := &sync.Once{}
+	return &testpipe{in: a, out: b, once: o}, &testpipe{in: b, out: a, once: o}
+}
+
+func (p *testpipe) Close() error                   { return nil }
+func (p *testpipe) Open() error                    { return nil }
+func (p *testpipe) Disconnect() error              { p.once.Do(func() { close(p.out) }); return nil }
+func (p *testpipe) SetLogger(l *zap.SugaredLogger) {}
+func (p *testpipe) SetDeadline(t time.Time)        {}
+func (p *testpipe) SetTimeout(t time.Duration)     {}
+func (p *testpipe) SetMaxReceivedBytes(m int64)    {}
+func (p *testpipe) GetRxTxBytes() (int64, int64)   { return 0, 0 }
+
+func (p *testpipe) Write(src []byte) error {
+	p.wbuf.Write(src)
+	p.reading = false
+	return nil
+}
+
+func (p *testpipe) Flush() error {
+	if p.wbuf.Len() > 0 {
+		m := append([]byte(nil), p.wbuf.Bytes()...)
+		p.wbuf.Reset()
+		if p.onsend != nil {
+			m = p.onsend(m)
+		}
+		if m != nil {
+			p.out <- m
+		}
+	}
+	return nil
+}
+
+func (p *testpipe) Read(b []byte) (int, error) {
+	if !p.reading {
+		_ = p.Flush()
+		m, ok := <-p.in
+		if !ok {
+			return 0, io.EOF
+		}
+		p.rbuf = m
+		p.reading = true
+	}
+	if len(p.rbuf) == 0 {
+		p.reading = false
+		return 0, io.EOF
+	}
+	n := copy(b, p.rbuf)
+	p.rbuf = p.rbuf[n:]
+	return n, nil
+}
+
+// values by logical name or short name address, sn address without value returns the address itself
+type testhandler struct {
+	mu  sync.Mutex
+	ln  map[DlmsObis]DlmsData
+	sn  map[int16]DlmsData
+	ack map[int16]DlmsResultTag // write result of the address, success if missing
+}
+
+func newtesthandler() *testhandler {
+	return &testhandler{ln: make(map[DlmsObis]DlmsData), sn: make(map[int16]DlmsData), ack: make(map[int16]DlmsResultTag)}
+}
+
+func (h *testhandler) Get(item *DlmsLNRequestItem) DlmsData {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if v, ok := h.ln[item.Obis]; ok {
+		return v
+	}
+	return NewDlmsDataError(TagResultObjectUndefined)
+}
+
+func (h *testhandler) Set(item *DlmsLNRequestItem) DlmsResultTag {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.ln[item.Obis]; !ok {
+		return TagResultObjectUndefined
+	}
+	h.ln[item.Obis] = *item.SetData
+	return TagResultSuccess
+}
+
+func (h *testhandler) Action(item *DlmsLNRequestItem) (*DlmsData, DlmsResultTag) {
+	return item.SetData, TagResultSuccess
+}
+
+func (h *testhandler) Read(item *DlmsSNRequestItem) DlmsData {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if item.HasAccess { // echo of the parameters
+		return *item.AccessData
+	}
+	if v, ok := h.sn[item.Address]; ok {
+		return v
+	}
+	return DlmsData{Tag: TagLongUnsigned, Value: uint16(item.Address)}
+}
+
+func (h *testhandler) Write(item *DlmsSNRequestItem) DlmsResultTag {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r, ok := h.ack[item.Address]; ok {
+		return r
+	}
+	h.sn[item.Address] = *item.WriteData
+	return TagResultSuccess
+}
+
+func (h *testhandler) value(address int16) (DlmsData, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d, ok := h.sn[address]
+	return d, ok
+}
+
+// server serving the other end of the returned client transport, stop disconnects client and waits for the server
+func startserver(t *testing.T, settings *DlmsSettings, h DlmsServerHandler) (client *testpipe, srv *dlmsserver, stop func()) {
+	t.Helper()
+	client, server := newtestpipe()
+	srv, stop = startserveron(t, client, server, settings, h)
+	return client, srv, stop
+}
+
+func startserveron(t *testing.T, client *testpipe, server *testpipe, settings *DlmsSettings, h DlmsServerHandler) (srv *dlmsserver, stop func()) {
+	t.Helper()
+	srv = NewServer(server, settings, h).(*dlmsserver)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve() }()
+	return srv, func() {
+		t.Helper()
+		_ = client.Disconnect()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("server failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("server didnt stop")
+		}
+	}
+}
+
+func testsettings(t *testing.T, b *SettingsBuilder) *DlmsSettings {
+	t.Helper()
+	s, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var (
+	testek = []byte("0123456789abcdef")
+	testak = []byte("fedcba9876543210")
+)
+
+func TestServerSettingsCopiedPerConnection(t *testing.T) {
+	ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	h := newtesthandler()
+	obis := DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}
+	h.ln[obis] = DlmsData{Tag: TagDoubleLongUnsigned, Value: uint32(42)}
+
+	var wg sync.WaitGroup
+	srvs := make([]*dlmsserver, 2)
+	for i := range srvs {
+		cs := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+		tr, srv, stop := startserver(t, ss, h)
+		srvs[i] = srv
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stop()
+			c := New(tr, cs)
+			if err := c.Open(); err != nil {
+				t.Error(err)
+				return
+			}
+			for j := 0; j < 20; j++ {
+				r, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}})
+				if err != nil || r[0].Value != uint32(42) {
+					t.Error(err, r)
+					return
+				}
+			}
+			_ = c.Close()
+		}()
+	}
+	wg.Wait()
+
+	a, b := &srvs[0].settings, &srvs[1].settings
+	if ss.fcstore != nil {
+		t.Errorf("frame counter store attached to the settings of the caller")
+	}
+	if a.fcstore == nil || a.fcstore != b.fcstore {
+		t.Errorf("connections dont share the frame counter store")
+	}
+	if a.fclimit == b.fclimit {
+		t.Errorf("both connections use the same counter range ending at %d", a.fclimit)
+	}
+	if a.gcm == b.gcm || a.gcm == ss.gcm {
+		t.Errorf("gcm is shared between connections")
+	}
+	if &a.ekcopy[0] == &ss.ekcopy[0] || &a.systemtitle[0] == &ss.systemtitle[0] {
+		t.Errorf("key material is shared with the settings")
+	}
+}
+
+func TestServerReleaseKeepsCallerDedicatedKey(t *testing.T) {
+	ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	key := []byte("dedicatedkey0123")
+	if err := ss.SetDedicatedKey(key); err != nil {
+		t.Fatal(err)
+	}
+	_, srv, stop := startserver(t, ss, newtesthandler())
+	stop()
+	srv.release()
+	if !bytes.Equal(ss.dedicatedkey, key) {
+		t.Errorf("dedicated key of the settings was zeroized: %x", ss.dedicatedkey)
+	}
+}
+
+func TestServerLowAuthentication(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		ok       bool
+	}{
+		{"right password", "12345678", true},
+		{"wrong password", "12345670", false},
+		{"prefix of the password", "1234", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _, stop := startserver(t, testsettings(t, NewSettingsBuilderSN().LowAuthentication([]byte("12345678"))), newtesthandler())
+			defer stop()
+			err := New(client, testsettings(t, NewSettingsBuilderSN().LowAuthentication([]byte(tt.password)))).Open()
+			if (err == nil) != tt.ok {
+				t.Errorf("open with %s: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestServerSettingsNotChanged(t *testing.T) {
+	ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	a := NewServer(nil, ss, newtesthandler()).(*dlmsserver)
+	b := NewServer(nil, ss, newtesthandler()).(*dlmsserver)
+	if ss.fcstore != nil {
+		t.Errorf("frame counter store attached to the settings of the caller")
+	}
+	fa, err := a.settings.nextframecounter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb, err := b.settings.nextframecounter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fa == fb {
+		t.Errorf("both servers use invocation counter %d", fa)
+	}
+}
+
+func TestAutoDedicatedKey(t *testing.T) {
+	obis := DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}
+	ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	ss.MaxPduRecvSize = 1024
+	cs := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	cs.AutoDedicatedKey = true
+	var prev []byte
+	for _, disconnect := range []bool{false, true} {
+		h := newtesthandler()
+		h.ln[obis] = DlmsData{Tag: TagUnsigned, Value: uint8(3)}
+		var requests, responses [][]byte
+		client, server := newtestpipe()
+		client.onsend = func(m []byte) []byte { requests = append(requests, m); return m }
+		server.onsend = func(m []byte) []byte { responses = append(responses, m); return m }
+		srv, stop := startserveron(t, client, server, ss, h)
+		c := New(client, cs)
+		if err := c.Open(); err != nil {
+			t.Fatal(err)
+		}
+		key := cs.dedicatedkey
+		if len(key) != 16 || bytes.Equal(key, make([]byte, 16)) || bytes.Equal(key, prev) {
+			t.Fatalf("unexpected generated key %x", key)
+		}
+		prev = bytes.Clone(key)
+		if bytes.Contains(requests[0], key) { // initiate request in the aarq is ciphered by the global key
+			t.Errorf("dedicated key sent in plain")
+		}
+
+		r, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r[0].Value != uint8(3) {
+			t.Errorf("unexpected value %v", r[0])
+		}
+		if !bytes.Equal(srv.settings.dedicatedkey, prev) { // the server knows it only from the aarq
+			t.Errorf("server uses key %x instead of %x", srv.settings.dedicatedkey, prev)
+		}
+		if CosemTag(requests[1][0]) != TagDedGetRequest || CosemTag(responses[1][0]) != TagDedGetResponse {
+			t.Errorf("get is not ded ciphered: %x, %x", requests[1][0], responses[1][0])
+		}
+
+		if disconnect {
+			err = c.Disconnect()
+		} else {
+			err = c.Close()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, make([]byte, 16)) {
+			t.Errorf("key not wiped: %x", key)
+		}
+		if cs.dedicatedkey != nil || cs.dedgcm != nil || cs.usededicatedkey {
+			t.Errorf("dedicated key kept in the settings")
+		}
+		stop()
+	}
+
+	// generated key has to be ciphered by the global key
+	cs = testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(SecurityAuthentication, testek, testak, 1))
+	cs.AutoDedicatedKey = true
+	client, _, stop := startserver(t, ss, newtesthandler())
+	defer stop()
+	if err := New(client, cs).Open(); err == nil || !strings.Contains(err.Error(), "requires ciphering with encryption") {
+		t.Errorf("dedicated key without encryption, %v", err)
+	}
+}
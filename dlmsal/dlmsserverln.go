@@ -0,0 +1,604 @@
+package dlmsal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+func decodelncosemattr(src io.Reader, item *DlmsLNRequestItem, tmp *tmpbuffer) error {
+	_, err := io.ReadFull(src, tmp[:9])
+	if err != nil {
+		return err
+	}
+	item.ClassId = binary.BigEndian.Uint16(tmp[:])
+	item.Obis = DlmsObis{A: tmp[2], B: tmp[3], C: tmp[4], D: tmp[5], E: tmp[6], F: tmp[7]}
+	item.Attribute = int8(tmp[8])
+	return nil
+}
+
+func decodelngetitem(src io.Reader, item *DlmsLNRequestItem, tmp *tmpbuffer) error {
+	err := decodelncosemattr(src, item, tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(src, tmp[:1])
+	if err != nil {
+		return err
+	}
+	if tmp[0] == 0 {
+		item.HasAccess = false
+		return nil
+	}
+	_, err = io.ReadFull(src, tmp[:1])
+	if err != nil {
+		return err
+	}
+	item.HasAccess = true
+	item.AccessDescriptor = tmp[0]
+	d, _, err := decodeDataTag(src, tmp)
+	if err != nil {
+		return err
+	}
+	item.AccessData = &d
+	return nil
+}
+
+func decodelnactionitem(src io.Reader, item *DlmsLNRequestItem, tmp *tmpbuffer) error {
+	err := decodelncosemattr(src, item, tmp)
+	if err != nil {
+		return err
+	}
+	return decodeoptionaldata(src, &item.SetData, tmp)
+}
+
+func decodeoptionaldata(src io.Reader, dst **DlmsData, tmp *tmpbuffer) error {
+	_, err := io.ReadFull(src, tmp[:1])
+	if err != nil {
+		return err
+	}
+	if tmp[0] == 0 {
+		*dst = nil
+		return nil
+	}
+	d, _, err := decodeDataTag(src, tmp)
+	if err != nil {
+		return err
+	}
+	*dst = &d
+	return nil
+}
+
+func decodelnitems(src *bytes.Buffer, tmp *tmpbuffer, action bool) ([]DlmsLNRequestItem, error) {
+	l, _, err := decodelength(src, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if l > uint(src.Len()) {
+		return nil, fmt.Errorf("invalid list length")
+	}
+	items := make([]DlmsLNRequestItem, l)
+	for i := 0; i < len(items); i++ {
+		if action {
+			err = decodelncosemattr(src, &items[i], tmp)
+		} else {
+			err = decodelngetitem(src, &items[i], tmp)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// read block header (last, block number) and raw data
+func decodedatablock(src io.Reader, tmp *tmpbuffer) (last bool, blockno uint32, raw []byte, err error) {
+	_, err = io.ReadFull(src, tmp[:5])
+	if err != nil {
+		return
+	}
+	last = tmp[0] != 0
+	blockno = binary.BigEndian.Uint32(tmp[1:])
+	l, _, err := decodelength(src, tmp)
+	if err != nil {
+		return
+	}
+	raw = make([]byte, l)
+	_, err = io.ReadFull(src, raw)
+	return
+}
+
+func encodegetresult(dst *bytes.Buffer, d *DlmsData) error {
+	if d.Tag == TagError {
+		dst.WriteByte(1)
+		dst.WriteByte(byte(resultfromdata(d)))
+		return nil
+	}
+	dst.WriteByte(0)
+	return encodeData(dst, d)
+}
+
+func encodeactionresult(dst *bytes.Buffer, d *DlmsData, res DlmsResultTag) error {
+	dst.WriteByte(byte(res))
+	if d == nil {
+		dst.WriteByte(0)
+		return nil
+	}
+	dst.WriteByte(1)
+	return encodegetresult(dst, d)
+}
+
+func (s *dlmsserver) sendblocks(tag CosemTag, data []byte) error {
+	s.blocktag = tag
+	s.blockdata = data
+	s.blockno = 0
+	return s.sendnextblock()
+}
+
+func (s *dlmsserver) sendnextblock() error {
+	local := &s.al.pdu
+	local.Reset()
+	local.WriteByte(byte(s.blocktag))
+	switch s.blocktag {
+	case TagGetResponse:
+		local.WriteByte(byte(TagGetResponseWithDataBlock))
+		local.WriteByte(s.invoke)
+	case TagActionResponse:
+		local.WriteByte(byte(TagActionResponseWithPBlock))
+		local.WriteByte(s.invoke)
+	case TagReadResponse: // single data-block-result item
+		local.WriteByte(1)
+		local.WriteByte(byte(TagReadResponseDataBlockResult))
+	default:
+		return fmt.Errorf("program error, unexpected block tag: %v", s.blocktag)
+	}
+	ts := s.blocksize()
+	if ts <= 0 {
+		return fmt.Errorf("too small max pdu size for block transfer")
+	}
+	last := len(s.blockdata) <= ts
+	if last {
+		ts = len(s.blockdata)
+		local.WriteByte(1)
+	} else {
+		local.WriteByte(0)
+	}
+	s.blockno++
+	if s.blocktag != TagReadResponse { // block number of SN is only 16 bits
+		local.WriteByte(byte(s.blockno >> 24))
+		local.WriteByte(byte(s.blockno >> 16))
+	}
+	local.WriteByte(byte(s.blockno >> 8))
+	local.WriteByte(byte(s.blockno))
+	if s.blocktag == TagGetResponse {
+		local.WriteByte(0) // raw data
+	}
+	encodelength(local, uint(ts))
+	local.Write(s.blockdata[:ts])
+	s.blockdata = s.blockdata[ts:]
+	if last {
+		s.blockdata = nil
+	}
+	return s.sendpdu()
+}
+
+// next block requested by the client, client sends the last received block number
+func (s *dlmsserver) nextblock(tag CosemTag, src *bytes.Buffer) error {
+	_, err := io.ReadFull(src, s.al.tmpbuffer[:4])
+	if err != nil {
+		return err
+	}
+	blockno := binary.BigEndian.Uint32(s.al.tmpbuffer[:])
+	if s.blockdata == nil || s.blocktag != tag || blockno != s.blockno {
+		s.blockdata = nil
+		local := &s.al.pdu
+		local.Reset()
+		local.WriteByte(byte(tag))
+		switch tag {
+		case TagGetResponse:
+			local.WriteByte(byte(TagGetResponseNormal))
+			local.WriteByte(s.invoke)
+			local.WriteByte(1)
+			if blockno != s.blockno {
+				local.WriteByte(byte(TagResultDataBlockNumberInvalid))
+			} else {
+				local.WriteByte(byte(TagResultNoLongGetInProgress))
+			}
+		default:
+			local.WriteByte(byte(TagActionResponseNormal))
+			local.WriteByte(s.invoke)
+			local.WriteByte(byte(TagResultOtherReason))
+			local.WriteByte(0)
+		}
+		return s.sendpdu()
+	}
+	return s.sendnextblock()
+}
+
+func (s *dlmsserver) get(src *bytes.Buffer) error {
+	al := &s.al
+	_, err := io.ReadFull(src, al.tmpbuffer[:2])
+	if err != nil {
+		return err
+	}
+	s.invoke = al.tmpbuffer[1]
+	if s.state != serverStateAssociated {
+		return s.exception(1, 1)
+	}
+
+	var body bytes.Buffer
+	var rt getResponseTag
+	switch getRequestTag(al.tmpbuffer[0]) {
+	case TagGetRequestNormal:
+		var item DlmsLNRequestItem
+		err = decodelngetitem(src, &item, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		d := s.handler.Get(&item)
+		err = encodegetresult(&body, &d)
+		rt = TagGetResponseNormal
+	case TagGetRequestWithList:
+		items, err := decodelnitems(src, &al.tmpbuffer, false)
+		if err != nil {
+			return err
+		}
+		encodelength(&body, uint(len(items)))
+		for i := 0; i < len(items); i++ {
+			d := s.handler.Get(&items[i])
+			err = encodegetresult(&body, &d)
+			if err != nil {
+				return err
+			}
+		}
+		rt = TagGetResponseWithList
+	case TagGetRequestNext:
+		return s.nextblock(TagGetResponse, src)
+	default:
+		return s.exception(2, 2)
+	}
+	if err != nil {
+		return err
+	}
+
+	local := &al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagGetResponse))
+	local.WriteByte(byte(rt))
+	local.WriteByte(s.invoke)
+	if s.fits(body.Len()) {
+		local.Write(body.Bytes())
+		return s.sendpdu()
+	}
+	if rt == TagGetResponseNormal { // block contains just data, not the result
+		return s.sendblocks(TagGetResponse, body.Bytes()[1:])
+	}
+	return s.sendblocks(TagGetResponse, body.Bytes())
+}
+
+func (s *dlmsserver) set(src *bytes.Buffer) error {
+	al := &s.al
+	_, err := io.ReadFull(src, al.tmpbuffer[:2])
+	if err != nil {
+		return err
+	}
+	s.invoke = al.tmpbuffer[1]
+	if s.state != serverStateAssociated {
+		return s.exception(1, 1)
+	}
+
+	switch setRequestTag(al.tmpbuffer[0]) {
+	case TagSetRequestNormal:
+		var item DlmsLNRequestItem
+		err = decodelngetitem(src, &item, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		d, _, err := decodeDataTag(src, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		item.SetData = &d
+		r := s.handler.Set(&item)
+		local := &al.pdu
+		local.Reset()
+		local.WriteByte(byte(TagSetResponse))
+		local.WriteByte(byte(TagSetResponseNormal))
+		local.WriteByte(s.invoke)
+		local.WriteByte(byte(r))
+		return s.sendpdu()
+	case TagSetRequestWithList:
+		items, err := decodelnitems(src, &al.tmpbuffer, false)
+		if err != nil {
+			return err
+		}
+		return s.setlist(items, src, TagSetResponseWithList, 0)
+	case TagSetRequestWithFirstDataBlock:
+		var item DlmsLNRequestItem
+		err = decodelngetitem(src, &item, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		s.startblocks(TagSetRequest, []DlmsLNRequestItem{item}, false)
+		return s.setblock(src)
+	case TagSetRequestWithListAndFirstDataBlock:
+		items, err := decodelnitems(src, &al.tmpbuffer, false)
+		if err != nil {
+			return err
+		}
+		s.startblocks(TagSetRequest, items, true)
+		return s.setblock(src)
+	case TagSetRequestWithDataBlock:
+		if s.initems == nil || s.intag != TagSetRequest {
+			return s.exception(1, 1)
+		}
+		return s.setblock(src)
+	}
+	return s.exception(2, 2)
+}
+
+func (s *dlmsserver) startblocks(tag CosemTag, items []DlmsLNRequestItem, list bool) {
+	s.intag = tag
+	s.initems = items
+	s.inlist = list
+	s.indata.Reset()
+	s.inblockno = 0
+}
+
+func (s *dlmsserver) setblock(src *bytes.Buffer) error {
+	al := &s.al
+	last, blockno, raw, err := decodedatablock(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	local := &al.pdu
+	if blockno != s.inblockno+1 {
+		s.initems = nil
+		local.Reset()
+		local.WriteByte(byte(TagSetResponse))
+		local.WriteByte(byte(TagSetResponseNormal))
+		local.WriteByte(s.invoke)
+		local.WriteByte(byte(TagResultDataBlockNumberInvalid))
+		return s.sendpdu()
+	}
+	s.inblockno = blockno
+	s.indata.Write(raw)
+	if !last {
+		local.Reset()
+		local.WriteByte(byte(TagSetResponse))
+		local.WriteByte(byte(TagSetResponseDataBlock))
+		local.WriteByte(s.invoke)
+		local.WriteByte(byte(blockno >> 24))
+		local.WriteByte(byte(blockno >> 16))
+		local.WriteByte(byte(blockno >> 8))
+		local.WriteByte(byte(blockno))
+		return s.sendpdu()
+	}
+
+	items := s.initems
+	s.initems = nil
+	if !s.inlist {
+		d, _, err := decodeDataTag(&s.indata, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		items[0].SetData = &d
+		r := s.handler.Set(&items[0])
+		local.Reset()
+		local.WriteByte(byte(TagSetResponse))
+		local.WriteByte(byte(TagSetResponseLastDataBlock))
+		local.WriteByte(s.invoke)
+		local.WriteByte(byte(r))
+		local.WriteByte(byte(blockno >> 24))
+		local.WriteByte(byte(blockno >> 16))
+		local.WriteByte(byte(blockno >> 8))
+		local.WriteByte(byte(blockno))
+		return s.sendpdu()
+	}
+	return s.setlist(items, &s.indata, TagSetResponseLastDataBlockWithList, blockno)
+}
+
+func (s *dlmsserver) setlist(items []DlmsLNRequestItem, src *bytes.Buffer, rt setResponseTag, blockno uint32) error {
+	al := &s.al
+	l, _, err := decodelength(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	if l != uint(len(items)) {
+		return fmt.Errorf("different amount of data to set")
+	}
+	for i := 0; i < len(items); i++ {
+		d, _, err := decodeDataTag(src, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		items[i].SetData = &d
+	}
+
+	local := &al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagSetResponse))
+	local.WriteByte(byte(rt))
+	local.WriteByte(s.invoke)
+	encodelength(local, uint(len(items)))
+	for i := 0; i < len(items); i++ {
+		local.WriteByte(byte(s.handler.Set(&items[i])))
+	}
+	if rt == TagSetResponseLastDataBlockWithList {
+		local.WriteByte(byte(blockno >> 24))
+		local.WriteByte(byte(blockno >> 16))
+		local.WriteByte(byte(blockno >> 8))
+		local.WriteByte(byte(blockno))
+	}
+	return s.sendpdu()
+}
+
+func (s *dlmsserver) callaction(item *DlmsLNRequestItem) (*DlmsData, DlmsResultTag) {
+	if item.ClassId == 15 && item.Attribute == 1 && item.Obis.EqualTo(DlmsObis{A: 0, B: 0, C: 40, D: 0, E: 0, F: 255}) {
+		return s.replytohls(item.SetData)
+	}
+	if s.state != serverStateAssociated {
+		return nil, TagResultReadWriteDenied
+	}
+	return s.handler.Action(item)
+}
+
+func (s *dlmsserver) action(src *bytes.Buffer) error {
+	al := &s.al
+	_, err := io.ReadFull(src, al.tmpbuffer[:2])
+	if err != nil {
+		return err
+	}
+	s.invoke = al.tmpbuffer[1]
+
+	switch actionRequestTag(al.tmpbuffer[0]) {
+	case TagActionRequestNormal:
+		var item DlmsLNRequestItem
+		err = decodelnactionitem(src, &item, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		return s.actionsingle(&item)
+	case TagActionRequestWithList:
+		if s.state != serverStateAssociated {
+			return s.exception(1, 1)
+		}
+		items, err := decodelnitems(src, &al.tmpbuffer, true)
+		if err != nil {
+			return err
+		}
+		return s.actionlist(items, src)
+	case TagActionRequestNextPBlock:
+		return s.nextblock(TagActionResponse, src)
+	case TagActionRequestWithFirstPBlock:
+		var item DlmsLNRequestItem
+		err = decodelncosemattr(src, &item, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		s.startblocks(TagActionRequest, []DlmsLNRequestItem{item}, false)
+		return s.actionblock(src)
+	case TagActionRequestWithListAndFirstPBlock:
+		if s.state != serverStateAssociated {
+			return s.exception(1, 1)
+		}
+		items, err := decodelnitems(src, &al.tmpbuffer, true)
+		if err != nil {
+			return err
+		}
+		s.startblocks(TagActionRequest, items, true)
+		return s.actionblock(src)
+	case TagActionRequestWithPBlock:
+		if s.initems == nil || s.intag != TagActionRequest {
+			return s.exception(1, 1)
+		}
+		return s.actionblock(src)
+	}
+	return s.exception(2, 2)
+}
+
+func (s *dlmsserver) actionsingle(item *DlmsLNRequestItem) error {
+	d, r := s.callaction(item)
+	var body bytes.Buffer
+	err := encodeactionresult(&body, d, r)
+	if err != nil {
+		return err
+	}
+	local := &s.al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagActionResponse))
+	local.WriteByte(byte(TagActionResponseNormal))
+	local.WriteByte(s.invoke)
+	if s.fits(body.Len()) || r != TagResultSuccess || d == nil || d.Tag == TagError {
+		local.Write(body.Bytes())
+		return s.sendpdu()
+	}
+	return s.sendblocks(TagActionResponse, body.Bytes()[3:]) // only data itself without results
+}
+
+// parameters block, every block except the last one is confirmed by next pblock response
+func (s *dlmsserver) actionblock(src *bytes.Buffer) error {
+	al := &s.al
+	last, blockno, raw, err := decodedatablock(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	local := &al.pdu
+	if blockno != s.inblockno+1 {
+		s.initems = nil
+		local.Reset()
+		local.WriteByte(byte(TagActionResponse))
+		local.WriteByte(byte(TagActionResponseNormal))
+		local.WriteByte(s.invoke)
+		local.WriteByte(byte(TagResultDataBlockNumberInvalid))
+		local.WriteByte(0)
+		return s.sendpdu()
+	}
+	s.inblockno = blockno
+	s.indata.Write(raw)
+	if !last {
+		local.Reset()
+		local.WriteByte(byte(TagActionResponse))
+		local.WriteByte(byte(TagActionResponseNextPBlock))
+		local.WriteByte(s.invoke)
+		local.WriteByte(byte(blockno >> 24))
+		local.WriteByte(byte(blockno >> 16))
+		local.WriteByte(byte(blockno >> 8))
+		local.WriteByte(byte(blockno))
+		return s.sendpdu()
+	}
+
+	items := s.initems
+	s.initems = nil
+	if s.inlist {
+		return s.actionlist(items, &s.indata)
+	}
+	if s.indata.Len() > 0 {
+		d, _, err := decodeDataTag(&s.indata, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		items[0].SetData = &d
+	}
+	return s.actionsingle(&items[0])
+}
+
+// parameters are not optional in the list, null data is passed to the handler as is
+func (s *dlmsserver) actionlist(items []DlmsLNRequestItem, src *bytes.Buffer) error {
+	al := &s.al
+	l, _, err := decodelength(src, &al.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	if l != uint(len(items)) {
+		return fmt.Errorf("different amount of action parameters")
+	}
+	for i := 0; i < len(items); i++ {
+		d, _, err := decodeDataTag(src, &al.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		items[i].SetData = &d
+	}
+
+	var body bytes.Buffer
+	encodelength(&body, uint(len(items)))
+	for i := 0; i < len(items); i++ {
+		d, r := s.callaction(&items[i])
+		err = encodeactionresult(&body, d, r)
+		if err != nil {
+			return err
+		}
+	}
+	local := &al.pdu
+	local.Reset()
+	local.WriteByte(byte(TagActionResponse))
+	local.WriteByte(byte(TagActionResponseWithList))
+	local.WriteByte(s.invoke)
+	if s.fits(body.Len()) {
+		local.Write(body.Bytes())
+		return s.sendpdu()
+	}
+	return s.sendblocks(TagActionResponse, body.Bytes())
+}
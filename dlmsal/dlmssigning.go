@@ -0,0 +1,131 @@
+package dlmsal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// key signs outgoing apdus, public key from the certificate of the other side verifies the received signed ones,
+// apdus are signed only in case of SignApdus
+func (d *DlmsSettings) SetSigningKeys(key *ecdsa.PrivateKey, peercert *x509.Certificate) error {
+	if key == nil || peercert == nil {
+		return fmt.Errorf("both key and certificate have to be set")
+	}
+	pk, ok := peercert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("certificate does not contain ecdsa public key")
+	}
+	if _, _, err := ecdsaparams(key.Curve); err != nil {
+		return err
+	}
+	if _, _, err := ecdsaparams(pk.Curve); err != nil {
+		return err
+	}
+	d.signkey = key
+	d.peerkey = pk
+	return nil
+}
+
+// wraps already ciphered (or plain) apdu into general-signing
+func (d *dlmsal) signpdu(apdu []byte) ([]byte, error) {
+	s := d.settings
+	if len(d.aareres.SystemTitle) != 8 {
+		return nil, fmt.Errorf("system title of the other side is required for general signing")
+	}
+	var out bytes.Buffer
+	out.WriteByte(byte(TagGeneralSigning))
+	var tid [8]byte
+	binary.BigEndian.PutUint64(tid[:], s.transactionid)
+	s.transactionid++
+	var dt []byte
+	if s.GeneralDateTime {
+		var b bytes.Buffer
+		t := NewDlmsDateTimeFromTime(time.Now())
+		t.EncodeToDlms(&b)
+		dt = b.Bytes()[1:]
+	}
+	// transaction-id, originator, recipient, date-time, other-information and content, signature covers all of them including tag
+	for _, f := range [][]byte{tid[:], s.systemtitle, d.aareres.SystemTitle, dt, s.OtherInformation, apdu} {
+		encodelength(&out, uint(len(f)))
+		out.Write(f)
+	}
+	sig, err := ecdsasigndata(s.signkey, out.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	encodelength(&out, uint(len(sig)))
+	out.Write(sig)
+	return out.Bytes(), nil
+}
+
+// verifies whole general-signing apdu (tag included), returns signed content and originator system title,
+// apdu addressed to other recipient than the own system title is refused, empty recipient is accepted
+func verifygeneralsigning(apdu []byte, key *ecdsa.PublicKey, recipient []byte, tmp *tmpbuffer) (content []byte, originator []byte, err error) {
+	if len(apdu) == 0 || CosemTag(apdu[0]) != TagGeneralSigning {
+		return nil, nil, fmt.Errorf("not a general signing apdu")
+	}
+	src := bytes.NewBuffer(apdu[1:])
+	for i := 0; i < 6; i++ {
+		var f []byte
+		f, err = readoctetstring(src, tmp)
+		if err != nil {
+			return
+		}
+		switch i {
+		case 1:
+			originator = f
+		case 2:
+			if len(f) != 0 && !bytes.Equal(f, recipient) {
+				return nil, nil, fmt.Errorf("general signing is addressed to %x, not to %x", f, recipient)
+			}
+		case 5:
+			content = f
+		}
+	}
+	signed := apdu[:len(apdu)-src.Len()]
+	sig, err := readoctetstring(src, tmp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(content) == 0 {
+		return nil, nil, fmt.Errorf("empty signed content")
+	}
+	err = ecdsaverifydata(key, sig, signed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("general signing verification failed: %w", err)
+	}
+	return
+}
+
+// verifies general-signing received from the other side, tag is already read, returns signed content
+func (d *dlmsal) verifysignedpdu(src io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	apdu := make([]byte, 1+len(data))
+	apdu[0] = byte(TagGeneralSigning)
+	copy(apdu[1:], data)
+	content, _, err := verifygeneralsigning(apdu, d.settings.peerkey, d.settings.systemtitle, &d.tmpbuffer)
+	if err != nil {
+		return nil, err
+	}
+	if CosemTag(content[0]) == TagGeneralSigning {
+		return nil, fmt.Errorf("nested general signing is not supported")
+	}
+	return content, nil
+}
+
+// verifies general-signing received as the answer and unwraps its content
+func (d *dlmsal) recvsignedpdu(src io.Reader) (tag CosemTag, str io.Reader, err error) {
+	content, err := d.verifysignedpdu(src)
+	if err != nil {
+		return TagGeneralSigning, nil, err
+	}
+	return d.unwrappdu(CosemTag(content[0]), bytes.NewReader(content[1:]))
+}
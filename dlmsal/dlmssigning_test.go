@@ -0,0 +1,63 @@
+package dlmsal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"strings"
+	"testing"
+)
+
+func TestGeneralSigningRecipient(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{PublicKey: &key.PublicKey}
+	sender := testsettings(t, NewSettingsBuilderLN().SystemTitle(testpushsystemtitle))
+	if err = sender.SetSigningKeys(key, cert); err != nil {
+		t.Fatal(err)
+	}
+	receiver := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")))
+	if err = receiver.SetSigningKeys(key, cert); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		recipient []byte
+		tamper    bool
+		refused   string // part of the error, empty if accepted
+	}{
+		{"own system title", []byte("CLIENT01"), false, ""},
+		{"other system title", []byte("CLIENT02"), false, "is addressed to"},
+		{"broken signature", []byte("CLIENT01"), true, "verification failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &dlmsal{settings: sender}
+			d.aareres.SystemTitle = tt.recipient
+			apdu, err := d.signpdu(testnotification(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper {
+				apdu[len(apdu)-5] ^= 1
+			}
+			n, err := NewPushDecoder(receiver).Decode(apdu)
+			if tt.refused != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.refused) {
+					t.Errorf("expected refusal with %q, got %v", tt.refused, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !n.Signed || string(n.SystemTitle) != string(testpushsystemtitle) {
+				t.Errorf("unexpected notification %+v", n)
+			}
+		})
+	}
+}
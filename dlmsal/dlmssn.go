@@ -1,53 +1,246 @@
 package dlmsal
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 
 	"github.com/cybroslabs/libdlms-go/base"
 )
 
-// SN func read, for now it should be enough
-func (d *dlmsal) Read(items []DlmsSNRequestItem) ([]DlmsData, error) {
-	if !d.isopen {
-		return nil, base.ErrNotOpened
+func encodesnitem(dst *bytes.Buffer, item *DlmsSNRequestItem) error {
+	if item.HasAccess {
+		dst.WriteByte(byte(TagVariableAccessParameterized))
+		dst.WriteByte(byte(item.Address >> 8))
+		dst.WriteByte(byte(item.Address))
+		dst.WriteByte(item.AccessDescriptor)
+		return encodeData(dst, item.AccessData)
 	}
+	dst.WriteByte(byte(TagVariableAccessName))
+	dst.WriteByte(byte(item.Address >> 8))
+	dst.WriteByte(byte(item.Address))
+	return nil
+}
 
-	if len(items) == 0 {
-		return nil, base.ErrNothingToRead
+type dlmsalsnread struct { // reader of the read response content sent by data-block-result blocks
+	master    *dlmsal
+	transport io.Reader
+	blockno   uint16
+	lastblock bool
+	remaining uint
+	tmpbuffer tmpbuffer // own one, the reader can read into the tmpbuffer of the master
+}
+
+// last-block, block-number and length of raw-data
+func (sn *dlmsalsnread) readheader(str io.Reader) (err error) {
+	_, err = io.ReadFull(str, sn.tmpbuffer[:3])
+	if err != nil {
+		return
+	}
+	sn.lastblock = sn.tmpbuffer[0] != 0
+	sn.blockno = binary.BigEndian.Uint16(sn.tmpbuffer[1:])
+	sn.remaining, _, err = decodelength(str, &sn.tmpbuffer)
+	if err != nil {
+		return
 	}
+	if sn.remaining == 0 && !sn.lastblock {
+		return fmt.Errorf("zero length block")
+	}
+	sn.transport = str
+	return
+}
 
-	local := &d.pdu
-	// format request into byte slice and send that to unit
-	local.Reset()
-	local.WriteByte(byte(TagReadRequest))
-	encodelength(local, uint(len(items)))
-	for _, item := range items {
-		if item.HasAccess {
-			local.WriteByte(4)
-			local.WriteByte(byte(item.Address >> 8))
-			local.WriteByte(byte(item.Address))
-			local.WriteByte(item.AccessDescriptor)
-			err := encodeData(local, item.AccessData)
+func (sn *dlmsalsnread) Read(p []byte) (n int, err error) {
+	if len(p) == 0 { // that shouldnt happen
+		return 0, base.ErrNothingToRead
+	}
+	master := sn.master
+	for sn.remaining == 0 {
+		if sn.lastblock {
+			return 0, io.EOF
+		}
+		// ask for the next block by the number of the received one
+		local := &master.pdu
+		local.Reset()
+		local.WriteByte(byte(TagReadRequest))
+		local.WriteByte(1)
+		local.WriteByte(byte(TagVariableAccessBlockNumber))
+		local.WriteByte(byte(sn.blockno >> 8))
+		local.WriteByte(byte(sn.blockno))
+		tag, str, err := master.sendpdu()
+		if err != nil {
+			return 0, err
+		}
+		if tag != TagReadResponse {
+			return 0, fmt.Errorf("unexpected tag: %x", tag)
+		}
+		_, err = io.ReadFull(str, sn.tmpbuffer[:2])
+		if err != nil {
+			return 0, err
+		}
+		if sn.tmpbuffer[0] != 1 {
+			return 0, fmt.Errorf("only one item was expected")
+		}
+		switch readResponseTag(sn.tmpbuffer[1]) {
+		case TagReadResponseDataBlockResult:
+		case TagReadResponseDataAccessError:
+			_, err = io.ReadFull(str, sn.tmpbuffer[:1])
 			if err != nil {
-				return nil, err
+				return 0, err
 			}
-		} else {
-			local.WriteByte(2)
-			local.WriteByte(byte(item.Address >> 8))
-			local.WriteByte(byte(item.Address))
+			return 0, NewDlmsError(DlmsResultTag(sn.tmpbuffer[0]))
+		default:
+			return 0, fmt.Errorf("unexpected response tag: %x", sn.tmpbuffer[1])
+		}
+		blockexp := sn.blockno + 1
+		err = sn.readheader(str)
+		if err != nil {
+			return 0, err
+		}
+		if sn.blockno != blockexp {
+			return 0, fmt.Errorf("unexpected block number")
+		}
+	}
+	if uint(len(p)) > sn.remaining {
+		p = p[:sn.remaining]
+	}
+	n, err = sn.transport.Read(p)
+	sn.remaining -= uint(n)
+	return n, err
+}
+
+// sends read request, long one by read-data-block-access blocks, returns reader of the response content (amount of items and results)
+func (d *dlmsal) sendread(items []DlmsSNRequestItem) (io.Reader, error) {
+	var content bytes.Buffer
+	encodelength(&content, uint(len(items)))
+	for i := range items {
+		if err := encodesnitem(&content, &items[i]); err != nil {
+			return nil, err
 		}
 	}
 
-	tag, str, err := d.sendpdu()
+	var tag CosemTag
+	var str io.Reader
+	var err error
+	if d.usegbt() || d.maxPduSendSize == 0 || content.Len() <= d.maxPduSendSize-6-d.cipheroverhead() {
+		local := &d.pdu
+		local.Reset()
+		local.WriteByte(byte(TagReadRequest))
+		local.Write(content.Bytes())
+		tag, str, err = d.sendpdu()
+	} else {
+		tag, str, err = d.sendsnblocks(TagReadRequest, content.Bytes())
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	if tag != TagReadResponse {
+	switch tag {
+	case TagReadResponse:
+	case TagExceptionResponse:
+		return nil, decodeException(str, &d.tmpbuffer)
+	default:
 		return nil, fmt.Errorf("unexpected tag: %x", tag)
 	}
-	l, _, err := decodelength(str, &d.tmpbuffer)
+
+	// single data-block-result item means the whole content is sent in blocks
+	_, err = io.ReadFull(str, d.tmpbuffer[:2])
+	if err != nil {
+		return nil, err
+	}
+	if d.tmpbuffer[0] != 1 || readResponseTag(d.tmpbuffer[1]) != TagReadResponseDataBlockResult {
+		return io.MultiReader(bytes.NewReader([]byte{d.tmpbuffer[0], d.tmpbuffer[1]}), str), nil
+	}
+	sn := &dlmsalsnread{master: d}
+	return sn, sn.readheader(str)
+}
+
+// every block except the last one is acknowledged by block-number, response to the last one is the response itself,
+// read blocks carry raw data directly, write ones as a single octet string in the list of data
+func (d *dlmsal) sendsnblocks(reqtag CosemTag, data []byte) (tag CosemTag, str io.Reader, err error) {
+	size := d.maxPduSendSize - 16 - d.cipheroverhead()
+	if size <= 0 {
+		return 0, nil, fmt.Errorf("too small max pdu size for block transfer")
+	}
+	resptag := TagReadResponse
+	acktag := byte(TagReadResponseBlockNumber)
+	if reqtag == TagWriteRequest {
+		resptag = TagWriteResponse
+		acktag = byte(TagWriteResponseBlockNumber)
+	}
+	local := &d.pdu
+	blockno := uint16(0)
+	for {
+		blockno++
+		ts := min(size, len(data))
+		last := ts == len(data)
+		local.Reset()
+		local.WriteByte(byte(reqtag))
+		local.WriteByte(1)
+		if reqtag == TagWriteRequest {
+			local.WriteByte(byte(TagVariableAccessWriteDataBlock))
+		} else {
+			local.WriteByte(byte(TagVariableAccessReadDataBlock))
+		}
+		if last {
+			local.WriteByte(1)
+		} else {
+			local.WriteByte(0)
+		}
+		local.WriteByte(byte(blockno >> 8))
+		local.WriteByte(byte(blockno))
+		if reqtag == TagWriteRequest {
+			local.WriteByte(1)
+			local.WriteByte(byte(TagOctetString))
+		}
+		encodelength(local, uint(ts))
+		local.Write(data[:ts])
+		data = data[ts:]
+
+		tag, str, err = d.sendpdu()
+		if err != nil || last || tag != resptag {
+			return
+		}
+		_, err = io.ReadFull(str, d.tmpbuffer[:3])
+		if err != nil {
+			return
+		}
+		if d.tmpbuffer[0] != 1 {
+			return 0, nil, fmt.Errorf("only one item was expected")
+		}
+		switch d.tmpbuffer[1] {
+		case acktag:
+		case byte(TagReadResponseDataAccessError): // the same choice for write
+			return 0, nil, NewDlmsError(DlmsResultTag(d.tmpbuffer[2]))
+		default:
+			return 0, nil, fmt.Errorf("unexpected response tag: %x", d.tmpbuffer[1])
+		}
+		_, err = io.ReadFull(str, d.tmpbuffer[3:4])
+		if err != nil {
+			return
+		}
+		if binary.BigEndian.Uint16(d.tmpbuffer[2:]) != blockno {
+			return 0, nil, fmt.Errorf("unexpected block number")
+		}
+	}
+}
+
+// SN read, long requests and responses are transferred in blocks
+func (d *dlmsal) Read(items []DlmsSNRequestItem) ([]DlmsData, error) {
+	if !d.isopen {
+		return nil, base.ErrNotOpened
+	}
+
+	if len(items) == 0 {
+		return nil, base.ErrNothingToRead
+	}
+
+	str, err := d.sendread(items)
+	if err != nil {
+		return nil, err
+	}
+	var tmp tmpbuffer // item can be split between blocks and asking for the next block uses tmpbuffer of the master
+	l, _, err := decodelength(str, &tmp)
 	if err != nil {
 		return nil, err
 	}
@@ -56,63 +249,40 @@ func (d *dlmsal) Read(items []DlmsSNRequestItem) ([]DlmsData, error) {
 	}
 	ret := make([]DlmsData, len(items))
 	for i := 0; i < len(ret); i++ {
-		_, err = io.ReadFull(str, d.tmpbuffer[:1])
+		_, err = io.ReadFull(str, tmp[:1])
 		if err != nil {
 			return nil, err
 		}
-		switch d.tmpbuffer[0] {
-		case 0:
-			ret[i], _, err = decodeDataTag(str, &d.tmpbuffer)
+		switch readResponseTag(tmp[0]) {
+		case TagReadResponseData:
+			ret[i], _, err = decodeDataTag(str, &tmp)
 			if err != nil {
 				return nil, err
 			}
-		case 1:
-			_, err = io.ReadFull(str, d.tmpbuffer[:1])
+		case TagReadResponseDataAccessError:
+			_, err = io.ReadFull(str, tmp[:1])
 			if err != nil {
 				return nil, err
 			}
-			ret[i] = NewDlmsDataError(DlmsResultTag(d.tmpbuffer[0]))
+			ret[i] = NewDlmsDataError(DlmsResultTag(tmp[0]))
 		default:
-			return nil, fmt.Errorf("unexpected response tag: %x", d.tmpbuffer[0])
+			return nil, fmt.Errorf("unexpected response tag: %x", tmp[0])
 		}
 	}
 
 	return ret, nil
 }
 
+// only for big single item queries, blocks of the response are requested while the stream is read
 func (d *dlmsal) ReadStream(item DlmsSNRequestItem, inmem bool) (DlmsDataStream, error) {
 	if !d.isopen {
 		return nil, base.ErrNotOpened
 	}
 
-	local := &d.pdu
-	// format request into byte slice and send that to unit
-	local.Reset()
-	local.WriteByte(byte(TagReadRequest))
-	encodelength(local, 1)
-	if item.HasAccess {
-		local.WriteByte(4)
-		local.WriteByte(byte(item.Address >> 8))
-		local.WriteByte(byte(item.Address))
-		local.WriteByte(item.AccessDescriptor)
-		err := encodeData(local, item.AccessData)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		local.WriteByte(2)
-		local.WriteByte(byte(item.Address >> 8))
-		local.WriteByte(byte(item.Address))
-	}
-
-	tag, str, err := d.sendpdu()
+	str, err := d.sendread([]DlmsSNRequestItem{item})
 	if err != nil {
 		return nil, err
 	}
-
-	if tag != TagReadResponse {
-		return nil, fmt.Errorf("unexpected tag: %x", tag)
-	}
 	l, _, err := decodelength(str, &d.tmpbuffer)
 	if err != nil {
 		return nil, err
@@ -125,14 +295,14 @@ func (d *dlmsal) ReadStream(item DlmsSNRequestItem, inmem bool) (DlmsDataStream,
 	if err != nil {
 		return nil, err
 	}
-	switch d.tmpbuffer[0] {
-	case 0:
+	switch readResponseTag(d.tmpbuffer[0]) {
+	case TagReadResponseData:
 		str, err := newDataStream(str, inmem, d.logger)
 		if err != nil {
 			return nil, err
 		}
 		return str, nil
-	case 1:
+	case TagReadResponseDataAccessError:
 		_, err = io.ReadFull(str, d.tmpbuffer[:1])
 		if err != nil {
 			return nil, err
@@ -143,7 +313,72 @@ func (d *dlmsal) ReadStream(item DlmsSNRequestItem, inmem bool) (DlmsDataStream,
 	return nil, fmt.Errorf("unexpected response tag: %x", d.tmpbuffer[0])
 }
 
-// write support here
+// short name offset of the first method and amount of methods of the common classes, methods dont always follow
+// the attributes directly, so it cant be computed from the amount of attributes
+var snmethods = map[uint16]struct {
+	first uint16
+	count int
+}{
+	3:  {0x28, 1}, // register
+	4:  {0x38, 1}, // extended register
+	5:  {0x48, 2}, // demand register
+	6:  {0x30, 3}, // register activation
+	7:  {0x58, 4}, // profile generic
+	8:  {0x60, 6}, // clock
+	9:  {0x20, 1}, // script table
+	11: {0x10, 2}, // special days table
+	12: {0x20, 8}, // association SN
+	18: {0x40, 4}, // image transfer
+	20: {0x50, 1}, // activity calendar
+	70: {0x20, 2}, // disconnect control
+}
+
+// byte offset of the method (numbered from 1) of the class from the base name, as used by InvokeSN
+func SNMethodOffset(classid uint16, method int) (uint16, error) {
+	m, ok := snmethods[classid]
+	if !ok {
+		return 0, fmt.Errorf("unknown short name methods of class %d", classid)
+	}
+	if method < 1 || method > m.count {
+		return 0, fmt.Errorf("class %d has no method %d", classid, method)
+	}
+	return m.first + uint16(method-1)*8, nil
+}
+
+// invokes method of the SN object by read with parametrized access, offset is the byte offset of the method from the base
+// name given by the class (e.g. 0x58 for reply_to_HLS_authentication of association SN), not the method index, see
+// SNMethodOffset, nil params are sent as null-data, refused invocation is returned as data with TagError the same way as by Action
+func (d *dlmsal) InvokeSN(basename uint16, offset uint16, params *DlmsData) (*DlmsData, error) {
+	if params == nil {
+		params = &DlmsData{Tag: TagNull}
+	}
+	addr := basename + offset
+	r, err := d.Read([]DlmsSNRequestItem{{Address: int16(addr), HasAccess: true, AccessDescriptor: 0, AccessData: params}})
+	if err != nil {
+		return nil, err
+	}
+	return &r[0], nil
+}
+
+// list of variable access specifications followed by list of data, the same for confirmed and unconfirmed write
+func encodewrite(dst *bytes.Buffer, items []DlmsSNRequestItem) error {
+	encodelength(dst, uint(len(items)))
+	for i := range items {
+		if err := encodesnitem(dst, &items[i]); err != nil {
+			return err
+		}
+	}
+	encodelength(dst, uint(len(items)))
+	for _, item := range items {
+		err := encodeData(dst, item.WriteData)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SN write, long requests are transferred in write-data-block-access blocks
 func (d *dlmsal) Write(items []DlmsSNRequestItem) ([]DlmsResultTag, error) {
 	if !d.isopen {
 		return nil, base.ErrNotOpened
@@ -153,39 +388,30 @@ func (d *dlmsal) Write(items []DlmsSNRequestItem) ([]DlmsResultTag, error) {
 		return nil, base.ErrNothingToRead
 	}
 
-	local := &d.pdu
-	local.Reset()
-	local.WriteByte(byte(TagWriteRequest))
-	encodelength(local, uint(len(items)))
-	for _, item := range items {
-		if item.HasAccess {
-			local.WriteByte(4)
-			local.WriteByte(byte(item.Address >> 8))
-			local.WriteByte(byte(item.Address))
-			local.WriteByte(item.AccessDescriptor)
-			err := encodeData(local, item.AccessData)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			local.WriteByte(2)
-			local.WriteByte(byte(item.Address >> 8))
-			local.WriteByte(byte(item.Address))
-		}
+	var content bytes.Buffer
+	if err := encodewrite(&content, items); err != nil {
+		return nil, err
 	}
-
-	encodelength(local, uint(len(items)))
-	for _, item := range items {
-		err := encodeData(local, item.WriteData)
-		if err != nil {
-			return nil, err
-		}
+	var tag CosemTag
+	var str io.Reader
+	var err error
+	if d.usegbt() || d.maxPduSendSize == 0 || content.Len() <= d.maxPduSendSize-6-d.cipheroverhead() {
+		local := &d.pdu
+		local.Reset()
+		local.WriteByte(byte(TagWriteRequest))
+		local.Write(content.Bytes())
+		tag, str, err = d.sendpdu()
+	} else {
+		tag, str, err = d.sendsnblocks(TagWriteRequest, content.Bytes())
 	}
-	tag, str, err := d.sendpdu()
 	if err != nil {
 		return nil, err
 	}
-	if tag != TagWriteResponse {
+	switch tag {
+	case TagWriteResponse:
+	case TagExceptionResponse:
+		return nil, decodeException(str, &d.tmpbuffer)
+	default:
 		return nil, fmt.Errorf("unexpected tag: %x", tag)
 	}
 
@@ -202,10 +428,10 @@ func (d *dlmsal) Write(items []DlmsSNRequestItem) ([]DlmsResultTag, error) {
 		if err != nil {
 			return nil, err
 		}
-		switch d.tmpbuffer[0] {
-		case 0:
+		switch writeResponseTag(d.tmpbuffer[0]) {
+		case TagWriteResponseSuccess:
 			ret[i] = TagResultSuccess
-		case 1:
+		case TagWriteResponseDataAccessError:
 			_, err = io.ReadFull(str, d.tmpbuffer[:1])
 			if err != nil {
 				return nil, err
@@ -221,3 +447,33 @@ func (d *dlmsal) Write(items []DlmsSNRequestItem) ([]DlmsResultTag, error) {
 	}
 	return ret, nil
 }
+
+// SN write without any response, e.g. time synchronization of many meters at once, it has to fit into a single pdu
+// and it is refused if the unconfirmed write wasnt negotiated, the transport has to implement base.Flusher (wrapper, hdlc, llc over them)
+func (d *dlmsal) UnconfirmedWrite(items []DlmsSNRequestItem) error {
+	if !d.isopen {
+		return base.ErrNotOpened
+	}
+
+	if len(items) == 0 {
+		return base.ErrNothingToRead
+	}
+
+	if d.aareres.initiateResponse != nil && d.aareres.initiateResponse.NegotiatedConformance&ConformanceBlockUnconfirmedWrite == 0 {
+		return fmt.Errorf("unconfirmed write is not supported by the server")
+	}
+	flusher, ok := d.transport.(base.Flusher) // nothing is read back, so it has to be sent now
+	if !ok {
+		return fmt.Errorf("unconfirmed write requires transport implementing base.Flusher")
+	}
+	local := &d.pdu
+	local.Reset()
+	local.WriteByte(byte(TagUnconfirmedWriteRequest))
+	if err := encodewrite(local, items); err != nil {
+		return err
+	}
+	if err := d.writepdu(); err != nil {
+		return err
+	}
+	return flusher.Flush()
+}
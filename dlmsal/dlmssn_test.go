@@ -0,0 +1,312 @@
+package dlmsal
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cybroslabs/libdlms-go/base"
+)
+
+// sn client and server with small pdus, so longer requests and responses are transferred in blocks
+func startsnblocks(t *testing.T, h *testhandler, onsend func([]byte) []byte) (DlmsClient, func()) {
+	t.Helper()
+	client, server := newtestpipe()
+	server.onsend = onsend
+	ss := testsettings(t, NewSettingsBuilderSN())
+	ss.MaxPduRecvSize = 128
+	_, stop := startserveron(t, client, server, ss, h)
+	cs := testsettings(t, NewSettingsBuilderSN())
+	cs.MaxPduRecvSize = 128
+	c := New(client, cs)
+	if err := c.Open(); err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	return c, stop
+}
+
+// k-th response starting with prefix is replaced by the result of change
+func changeresponse(prefix []byte, k int, change func(m []byte) []byte) func([]byte) []byte {
+	var cnt int
+	return func(m []byte) []byte {
+		if bytes.HasPrefix(m, prefix) {
+			cnt++
+			if cnt == k {
+				return change(bytes.Clone(m))
+			}
+		}
+		return m
+	}
+}
+
+func TestSNReadBlocks(t *testing.T) {
+	long := DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{0x5a}, 1000)}
+	h := newtesthandler()
+	h.sn[0x100] = long
+	c, stop := startsnblocks(t, h, func(m []byte) []byte {
+		if len(m) > 128 {
+			t.Errorf("response of %d bytes sent", len(m))
+		}
+		return m
+	})
+	defer stop()
+
+	// long response
+	r, err := c.Read([]DlmsSNRequestItem{{Address: 0x100}, {Address: 0x108}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r[0].Value.([]byte), long.Value.([]byte)) || r[1].Value != uint16(0x108) {
+		t.Errorf("unexpected response %v", r[1])
+	}
+
+	// long request, parameters are echoed back
+	items := make([]DlmsSNRequestItem, 4)
+	for i := range items {
+		p := DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{byte(i)}, 100)}
+		items[i] = DlmsSNRequestItem{Address: int16(0x200 + 8*i), HasAccess: true, AccessDescriptor: 1, AccessData: &p}
+	}
+	r, err = c.Read(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range items {
+		if !bytes.Equal(r[i].Value.([]byte), items[i].AccessData.Value.([]byte)) {
+			t.Errorf("unexpected item %d: %v", i, r[i])
+		}
+	}
+
+	str, err := c.ReadStream(DlmsSNRequestItem{Address: 0x100}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer str.Close()
+	d, err := str.NextElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.Data.Value.([]byte), long.Value.([]byte)) {
+		t.Errorf("unexpected streamed value")
+	}
+}
+
+func TestSNWriteBlocks(t *testing.T) {
+	h := newtesthandler()
+	c, stop := startsnblocks(t, h, nil)
+	defer stop()
+	items := []DlmsSNRequestItem{
+		{Address: 0x100, WriteData: &DlmsData{Tag: TagOctetString, Value: bytes.Repeat([]byte{0xa5}, 1000)}},
+		{Address: 0x108, WriteData: &DlmsData{Tag: TagUnsigned, Value: uint8(7)}},
+	}
+	r, err := c.Write(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0] != TagResultSuccess || r[1] != TagResultSuccess {
+		t.Fatalf("unexpected results %v", r)
+	}
+	for _, item := range items {
+		v, ok := h.value(item.Address)
+		if !ok || v.Tag != item.WriteData.Tag || !bytes.Equal(encodeddata(t, &v), encodeddata(t, item.WriteData)) {
+			t.Errorf("unexpected value of %x: %v", item.Address, v)
+		}
+	}
+}
+
+func encodeddata(t *testing.T, d *DlmsData) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := encodeData(&b, d); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestSNBlockErrors(t *testing.T) {
+	long := bytes.Repeat([]byte{0x5a}, 1000)
+	read := func(c DlmsClient) error {
+		_, err := c.Read([]DlmsSNRequestItem{{Address: 0x100}})
+		return err
+	}
+	readlong := func(c DlmsClient) error {
+		_, err := c.Read([]DlmsSNRequestItem{{Address: 0x100, HasAccess: true, AccessDescriptor: 1, AccessData: &DlmsData{Tag: TagOctetString, Value: long[:300]}}})
+		return err
+	}
+	write := func(c DlmsClient) error {
+		_, err := c.Write([]DlmsSNRequestItem{{Address: 0x100, WriteData: &DlmsData{Tag: TagOctetString, Value: long}}})
+		return err
+	}
+	nextblock := func(m []byte) []byte { // block number is the last two bytes of the block header
+		m[4]++
+		return m
+	}
+	readblock := []byte{byte(TagReadResponse), 1, byte(TagReadResponseDataBlockResult)}
+	readack := []byte{byte(TagReadResponse), 1, byte(TagReadResponseBlockNumber)}
+	writeack := []byte{byte(TagWriteResponse), 1, byte(TagWriteResponseBlockNumber)}
+	denied := func(tag CosemTag) func([]byte) []byte {
+		return func([]byte) []byte {
+			return []byte{byte(tag), 1, byte(TagReadResponseDataAccessError), byte(TagResultReadWriteDenied)}
+		}
+	}
+	tests := []struct {
+		name   string
+		call   func(c DlmsClient) error
+		prefix []byte
+		change func([]byte) []byte
+		denied bool // data access error is expected, otherwise block number mismatch
+	}{
+		{"read response block number", read, readblock, func(m []byte) []byte { m[5]++; return m }, false},
+		{"read response data access error", read, readblock, denied(TagReadResponse), true},
+		{"read request block number", readlong, readack, nextblock, false},
+		{"read request data access error", readlong, readack, denied(TagReadResponse), true},
+		{"write request block number", write, writeack, nextblock, false},
+		{"write request data access error", write, writeack, denied(TagWriteResponse), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newtesthandler()
+			h.sn[0x100] = DlmsData{Tag: TagOctetString, Value: long}
+			k := 1
+			if tt.prefix[2] == byte(TagReadResponseDataBlockResult) { // the first block is answer to the request itself
+				k = 2
+			}
+			c, stop := startsnblocks(t, h, changeresponse(tt.prefix, k, tt.change))
+			defer stop()
+			err := tt.call(c)
+			if tt.denied {
+				var e *DlmsError
+				if !errors.As(err, &e) || e.Result != TagResultReadWriteDenied {
+					t.Errorf("expected data access error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "unexpected block number") {
+				t.Errorf("expected block number mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUnconfirmedWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		negotiated bool
+		flusher    bool
+	}{
+		{"negotiated", true, true},
+		{"not negotiated", false, true},
+		{"transport without flush", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newtesthandler()
+			ss := testsettings(t, NewSettingsBuilderSN())
+			if !tt.negotiated {
+				ss.ConformanceBlock &^= ConformanceBlockUnconfirmedWrite
+			}
+			client, _, stop := startserver(t, ss, h)
+			defer stop()
+			var tr base.Stream = client
+			if !tt.flusher {
+				tr = struct{ base.Stream }{client}
+			}
+			c := New(tr, testsettings(t, NewSettingsBuilderSN()))
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			err := c.UnconfirmedWrite([]DlmsSNRequestItem{{Address: 0x100, WriteData: &DlmsData{Tag: TagUnsigned, Value: uint8(3)}}})
+			if !tt.negotiated || !tt.flusher {
+				if err == nil {
+					t.Errorf("unconfirmed write sent")
+				}
+				// nothing is left written, so the next request is sent alone
+				if _, err = c.Read([]DlmsSNRequestItem{{Address: 0x108}}); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := h.value(0x100); ok {
+					t.Errorf("value written")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// requests are processed in order, so the write is done once the read is answered
+			if _, err = c.Read([]DlmsSNRequestItem{{Address: 0x108}}); err != nil {
+				t.Fatal(err)
+			}
+			if v, ok := h.value(0x100); !ok || v.Value != uint8(3) {
+				t.Errorf("unexpected value %v", v)
+			}
+		})
+	}
+}
+
+func TestSNMethodOffset(t *testing.T) {
+	tests := []struct {
+		classid uint16
+		method  int
+		offset  uint16
+		ok      bool
+	}{
+		{12, 8, 0x58, true}, // reply_to_HLS_authentication
+		{12, 1, 0x20, true},
+		{3, 1, 0x28, true},  // register reset
+		{7, 2, 0x60, true},  // profile generic capture
+		{8, 6, 0x88, true},  // clock shift_time
+		{70, 2, 0x28, true}, // remote_reconnect
+		{12, 9, 0, false},
+		{3, 0, 0, false},
+		{1, 1, 0, false}, // data has no methods
+	}
+	for _, tt := range tests {
+		o, err := SNMethodOffset(tt.classid, tt.method)
+		if (err == nil) != tt.ok || o != tt.offset {
+			t.Errorf("class %d method %d: %#x, %v", tt.classid, tt.method, o, err)
+		}
+	}
+}
+
+// records addresses of the reads
+type snaddresshandler struct {
+	*testhandler
+	addresses []int16
+}
+
+func (h *snaddresshandler) Read(item *DlmsSNRequestItem) DlmsData {
+	h.addresses = append(h.addresses, item.Address)
+	return h.testhandler.Read(item)
+}
+
+func TestInvokeSN(t *testing.T) {
+	h := &snaddresshandler{testhandler: newtesthandler()}
+	client, _, stop := startserver(t, testsettings(t, NewSettingsBuilderSN()), h)
+	defer stop()
+	c := New(client, testsettings(t, NewSettingsBuilderSN()))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := SNMethodOffset(70, 1) // remote_disconnect
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.InvokeSN(0x1000, offset, &DlmsData{Tag: TagInteger, Value: int8(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Tag != TagInteger || r.Value != int8(0) { // parameters are echoed
+		t.Errorf("unexpected result %v", r)
+	}
+	r, err = c.InvokeSN(0x1000, offset+8, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Tag != TagNull {
+		t.Errorf("nil parameters not sent as null-data: %v", r)
+	}
+	if len(h.addresses) != 2 || h.addresses[0] != 0x1020 || h.addresses[1] != 0x1028 {
+		t.Errorf("unexpected invoked addresses %x", h.addresses)
+	}
+}
@@ -1,6 +1,7 @@
 package dlmsal
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -10,13 +11,44 @@ import (
 
 // send and optionally encrypt packet at pdu to transport layer, returns also answer stream object with transparent ciphering and tag reading, hell
 func (d *dlmsal) sendpdu() (tag CosemTag, str io.Reader, err error) {
+	err = d.writepdu()
+	if err != nil {
+		return
+	}
+	for { // unsolicited notifications can come before the answer
+		tag, str, err = d.recvpdu()
+		if err != nil {
+			return
+		}
+		if tag == TagConfirmedServiceError {
+			return tag, nil, decodeConfirmedServiceErrorPdu(str)
+		}
+		if !isunsolicited(tag) {
+			return
+		}
+		err = d.unsolicited(tag, str)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// send and optionally encrypt packet at pdu without waiting for the answer, unconfirmed services use it directly
+func (d *dlmsal) writepdu() (err error) {
+	var tag CosemTag
 	local := &d.pdu
 	if local.Len() == 0 {
-		return tag, nil, fmt.Errorf("empty pdu")
+		return fmt.Errorf("empty pdu")
 	}
 	b := local.Bytes()
 	s := d.settings
-	if s.dedgcm != nil {
+	switch {
+	case (s.dedgcm != nil || s.gcm != nil) && s.CipheredApdu != CipheredApduServiceSpecific:
+		b, err = d.encryptgeneral(b, s.dedgcm != nil && s.CipheredApdu == CipheredApduGeneralGloDed)
+		if err != nil {
+			return
+		}
+	case s.dedgcm != nil:
 		switch CosemTag(b[0]) {
 		case TagGetRequest:
 			tag = TagDedGetRequest
@@ -28,11 +60,16 @@ func (d *dlmsal) sendpdu() (tag CosemTag, str io.Reader, err error) {
 			tag = TagDedReadRequest
 		case TagWriteRequest:
 			tag = TagDedWriteRequest
+		case TagUnconfirmedWriteRequest:
+			tag = TagDedUnconfirmedWriteRequest
 		default:
-			return tag, nil, fmt.Errorf("unsupported tag %v", b[0])
+			return fmt.Errorf("unsupported tag %v", b[0])
+		}
+		b, err = d.encryptpacket(byte(tag), b, true)
+		if err != nil {
+			return
 		}
-		b = d.encryptpacket(byte(tag), b, true)
-	} else if s.gcm != nil {
+	case s.gcm != nil:
 		switch CosemTag(b[0]) {
 		case TagGetRequest:
 			tag = TagGloGetRequest
@@ -44,35 +81,77 @@ func (d *dlmsal) sendpdu() (tag CosemTag, str io.Reader, err error) {
 			tag = TagGloReadRequest
 		case TagWriteRequest:
 			tag = TagGloWriteRequest
+		case TagUnconfirmedWriteRequest:
+			tag = TagGloUnconfirmedWriteRequest
 		default:
-			return tag, nil, fmt.Errorf("unsupported tag %v", b[0])
+			return fmt.Errorf("unsupported tag %v", b[0])
+		}
+		b, err = d.encryptpacket(byte(tag), b, false)
+		if err != nil {
+			return
 		}
-		b = d.encryptpacket(byte(tag), b, false)
 	}
 
-	if len(b) > d.maxPduSendSize && d.maxPduSendSize != 0 {
-		return tag, nil, fmt.Errorf("PDU size exceeds maximum size: %v > %v", len(b), d.maxPduSendSize)
+	if s.SignApdus {
+		b, err = d.signpdu(b)
+		if err != nil {
+			return
+		}
 	}
-	err = d.transport.Write(b)
-	if err != nil {
-		return
+
+	if d.usegbt() {
+		err = d.sendgbt(b)
+	} else {
+		if len(b) > d.maxPduSendSize && d.maxPduSendSize != 0 {
+			return fmt.Errorf("PDU size exceeds maximum size: %v > %v", len(b), d.maxPduSendSize)
+		}
+		err = d.transport.Write(b)
 	}
+	return
+}
+
+// receives the answer, returns stream with transparent ciphering and general block transfer
+func (d *dlmsal) recvpdu() (tag CosemTag, str io.Reader, err error) {
 	// read first fucking byte, this is sooooo, fuuuuuu
 	_, err = io.ReadFull(d.transport, d.tmpbuffer[:1])
 	if err != nil {
 		return
 	}
 	tag = CosemTag(d.tmpbuffer[0])
+	str = d.transport
+	if tag == TagGeneralBlockTransfer { // reassembled here, so the rest doesnt know about it
+		str, err = d.newgbtreader()
+		if err != nil {
+			return
+		}
+		_, err = io.ReadFull(str, d.tmpbuffer[:1])
+		if err != nil {
+			return
+		}
+		tag = CosemTag(d.tmpbuffer[0])
+	}
+	if tag == TagGeneralSigning {
+		return d.recvsignedpdu(str)
+	}
+	return d.unwrappdu(tag, str)
+}
+
+// decrypts ciphered apdu, tag is already read, plain apdu is returned as it is
+func (d *dlmsal) unwrappdu(tag CosemTag, str io.Reader) (CosemTag, io.Reader, error) {
 	switch tag {
-	case TagGloGetResponse, TagGloSetResponse, TagGloActionResponse, TagGloReadResponse, TagGloWriteResponse:
-		return d.recvcipheredpdu(tag, false)
-	case TagDedGetResponse, TagDedSetResponse, TagDedActionResponse, TagDedReadResponse, TagDedWriteResponse:
-		return d.recvcipheredpdu(tag, true)
+	case TagGloGetResponse, TagGloSetResponse, TagGloActionResponse, TagGloReadResponse, TagGloWriteResponse,
+		TagGloEventNotificationRequest, TagGloInformationReportRequest, TagGloConfirmedServiceError:
+		return d.recvcipheredpdu(str, tag, false)
+	case TagDedGetResponse, TagDedSetResponse, TagDedActionResponse, TagDedReadResponse, TagDedWriteResponse,
+		TagDedEventNotificationRequest, TagDedInformationReportRequest, TagDedConfirmedServiceError:
+		return d.recvcipheredpdu(str, tag, true)
+	case TagGeneralGloCiphering, TagGeneralDedCiphering, TagGeneralCiphering:
+		return d.recvgeneralpdu(str, tag)
 	}
-	return tag, d.transport, err
+	return tag, str, nil
 }
 
-func (d *dlmsal) recvcipheredpdu(rtag CosemTag, ded bool) (tag CosemTag, str io.Reader, err error) {
+func (d *dlmsal) recvcipheredpdu(src io.Reader, rtag CosemTag, ded bool) (tag CosemTag, str io.Reader, err error) {
 	tag = rtag
 	s := d.settings
 	var gcm gcm.Gcm
@@ -87,16 +166,41 @@ func (d *dlmsal) recvcipheredpdu(rtag CosemTag, ded bool) (tag CosemTag, str io.
 		}
 		gcm = s.gcm
 	}
-	l, _, err := decodelength(d.transport, &d.tmpbuffer)
+	l, _, err := decodelength(src, &d.tmpbuffer)
 	if err != nil {
 		return tag, nil, err
 	}
-	_, err = io.ReadFull(d.transport, d.tmpbuffer[:5])
+	_, err = io.ReadFull(src, d.tmpbuffer[:5])
 	if err != nil {
 		return tag, nil, fmt.Errorf("unable to read SC byte and frame counter")
 	}
+	if err = s.checksecurity(d.tmpbuffer[0]); err != nil {
+		return
+	}
 	fc := binary.BigEndian.Uint32(d.tmpbuffer[1:])
-	str, err = gcm.GetDecryptorStream(d.tmpbuffer[0], fc, d.aareres.SystemTitle, io.LimitReader(d.transport, int64(l)))
+	if s.ReplayProtection != ReplayProtectionOff { // counter can be accepted only after the tag check, so the whole apdu is decrypted at once
+		if l < 5 {
+			return tag, nil, fmt.Errorf("invalid ciphered apdu length")
+		}
+		if err = d.checkreplay(d.aareres.SystemTitle, fc); err != nil {
+			return
+		}
+		data := make([]byte, l-5)
+		_, err = io.ReadFull(src, data)
+		if err != nil {
+			return
+		}
+		plain, err := gcm.Decrypt(nil, d.tmpbuffer[0], fc, d.aareres.SystemTitle, data) // not reused, stream can outlive next request
+		if err != nil {
+			return tag, nil, err
+		}
+		if len(plain) == 0 {
+			return tag, nil, fmt.Errorf("empty ciphered apdu")
+		}
+		s.acceptframecounter(d.aareres.SystemTitle, fc)
+		return CosemTag(plain[0]), bytes.NewReader(plain[1:]), nil
+	}
+	str, err = gcm.GetDecryptorStream(d.tmpbuffer[0], fc, d.aareres.SystemTitle, io.LimitReader(src, int64(l)))
 	if err != nil {
 		return
 	}
@@ -0,0 +1,173 @@
+package dlmsal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cybroslabs/libdlms-go/base"
+)
+
+// persistent source of invocation counters, ranges are reserved in advance, so counters are never reused
+// even if the process crashes (unused rest of the range is just skipped)
+type FrameCounterStore interface {
+	// reserves count counters starting at least at min, returns the first one, the range is never returned again
+	Reserve(min uint32, count uint32) (uint32, error)
+}
+
+const defaultFrameCounterReserve = 100
+
+// counters are taken from the store in ranges of reserve size (default 100 if zero), current counter of the settings
+// is used as the minimum of the first reserved range
+func (d *DlmsSettings) SetFrameCounterStore(store FrameCounterStore, reserve uint32) {
+	if reserve == 0 {
+		reserve = defaultFrameCounterReserve
+	}
+	d.fcstore = store
+	d.fcreserve = reserve
+	d.fclimit = 0 // nothing reserved yet
+}
+
+// sets invocation counter of the next ciphered apdu, in case of store it is the minimum of the next reserved range
+func (d *DlmsSettings) SetFrameCounter(fc uint32) {
+	d.framecounter = fc
+	d.fclimit = 0
+}
+
+// invocation counter for the next ciphered apdu, new range is reserved if the current one is exhausted
+func (d *DlmsSettings) nextframecounter() (uint32, error) {
+	if d.fcstore != nil && uint64(d.framecounter) >= d.fclimit {
+		first, err := d.fcstore.Reserve(d.framecounter, d.fcreserve)
+		if err != nil {
+			return 0, fmt.Errorf("unable to reserve invocation counters: %w", err)
+		}
+		if first < d.framecounter {
+			return 0, fmt.Errorf("store returned invocation counter %d lower than requested %d", first, d.framecounter)
+		}
+		d.framecounter = first
+		d.fclimit = uint64(first) + uint64(d.fcreserve)
+	}
+	fc := d.framecounter
+	d.framecounter++
+	return fc, nil
+}
+
+func reserverange(next uint64, min uint32, count uint32) (first uint32, newnext uint64, err error) {
+	if next < uint64(min) {
+		next = uint64(min)
+	}
+	if next+uint64(count) > math.MaxUint32 {
+		return 0, 0, fmt.Errorf("invocation counters exhausted, new keys are needed")
+	}
+	return uint32(next), next + uint64(count), nil
+}
+
+type memoryframecounterstore struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+// not persistent store, counters are unique only during the life of the process
+func NewMemoryFrameCounterStore(next uint32) FrameCounterStore {
+	return &memoryframecounterstore{next: uint64(next)}
+}
+
+func (m *memoryframecounterstore) Reserve(min uint32, count uint32) (first uint32, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	first, m.next, err = reserverange(m.next, min, count)
+	return
+}
+
+type fileframecounterstore struct {
+	mu   *sync.Mutex
+	path string
+}
+
+// mutexes of the files by absolute path, so more stores of the same file in the process dont reserve the same range
+var filestoremutexes sync.Map
+
+// next free counter is kept as decimal number in the file, missing file means zero, file is replaced atomically;
+// reservations are serialized only inside the process, there is no lock between processes,
+// so the file must not be used by more processes at the same time
+func NewFileFrameCounterStore(path string) FrameCounterStore {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	mu, _ := filestoremutexes.LoadOrStore(path, &sync.Mutex{})
+	return &fileframecounterstore{mu: mu.(*sync.Mutex), path: path}
+}
+
+func (f *fileframecounterstore) Reserve(min uint32, count uint32) (uint32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var next uint64
+	data, err := os.ReadFile(f.path)
+	switch {
+	case err == nil:
+		next, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid content of %s: %w", f.path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return 0, err
+	}
+	first, next, err := reserverange(next, min, count)
+	if err != nil {
+		return 0, err
+	}
+	return first, writefile(f.path, []byte(strconv.FormatUint(next, 10)+"\n"))
+}
+
+// written to temporary file and renamed, so there is either old or new content after crash
+func writefile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// reads invocation counter of the security setup instance (0-0:43.1.instance.255) by not ciphered association
+// of the public client, transport has to be addressed to the public client, it is opened and closed here
+func ReadFrameCounter(transport base.Stream, instance byte) (uint32, error) {
+	settings, err := NewSettingsNoAuthenticationLN()
+	if err != nil {
+		return 0, err
+	}
+	c := New(transport, settings)
+	if err = c.Open(); err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	d, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: DlmsObis{A: 0, B: 0, C: 43, D: 1, E: instance, F: 255}, Attribute: 2}})
+	if err != nil {
+		return 0, err
+	}
+	var fc uint32
+	err = Cast(&fc, d[0])
+	if err != nil {
+		return 0, fmt.Errorf("unable to read invocation counter: %w", err)
+	}
+	return fc, nil
+}
@@ -0,0 +1,68 @@
+package dlmsal
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestFileFrameCounterStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fc")
+	s := NewFileFrameCounterStore(path)
+	first, err := s.Reserve(10, 100)
+	if err != nil || first != 10 {
+		t.Fatal(first, err)
+	}
+	first, err = s.Reserve(0, 100)
+	if err != nil || first != 110 {
+		t.Fatal(first, err)
+	}
+	// new store of the same file continues after the reserved ranges
+	first, err = NewFileFrameCounterStore(path).Reserve(50, 10)
+	if err != nil || first != 210 {
+		t.Fatal(first, err)
+	}
+	if _, err = NewFileFrameCounterStore(path).Reserve(0xfffffff0, 100); err == nil {
+		t.Errorf("exhausted counters reserved")
+	}
+	if err = os.WriteFile(path, []byte("nonsense"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Reserve(0, 1); err == nil {
+		t.Errorf("invalid content accepted")
+	}
+}
+
+func TestFileFrameCounterStoresOfSameFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fc")
+	const stores, reserves = 4, 25
+	var mu sync.Mutex
+	var firsts []int
+	var wg sync.WaitGroup
+	for i := 0; i < stores; i++ {
+		s := NewFileFrameCounterStore(path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < reserves; j++ {
+				first, err := s.Reserve(0, 10)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				firsts = append(firsts, int(first))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Ints(firsts)
+	for i, f := range firsts {
+		if f != i*10 {
+			t.Fatalf("overlapping or skipped ranges: %v", firsts)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package dlmsal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cybroslabs/libdlms-go/base"
+)
+
+const (
+	gbtLastBlock  = 0x80
+	gbtStreaming  = 0x40
+	gbtWindowMask = 0x3f
+
+	gbtHeaderLength = 11 // tag, control, block number, ack and worst length
+	maxGbtRetries   = 3
+)
+
+type gbtstate struct {
+	peerwindow byte   // receive window of the peer, taken from the last received block
+	sentbn     uint16 // last sent block number
+	recvbn     uint16 // last block number received in order
+	pending    []byte // last sent apdu, kept till the peer answers, lost blocks of the last window are sent again
+}
+
+// general block transfer is used for requests only if it is wanted and negotiated, responses are accepted always
+func (d *dlmsal) usegbt() bool {
+	return d.settings.GbtWindowSize > 0 && d.aareres.initiateResponse != nil &&
+		d.aareres.initiateResponse.NegotiatedConformance&ConformanceBlockGeneralBlockTransfer != 0
+}
+
+func (d *dlmsal) gbtwindow() byte {
+	w := d.settings.GbtWindowSize & gbtWindowMask
+	if w == 0 {
+		return 1
+	}
+	return w
+}
+
+func (d *dlmsal) writegbtblock(control byte, bn uint16, ack uint16, data []byte) error {
+	var hdr [gbtHeaderLength]byte
+	hdr[0] = byte(TagGeneralBlockTransfer)
+	hdr[1] = control
+	binary.BigEndian.PutUint16(hdr[2:], bn)
+	binary.BigEndian.PutUint16(hdr[4:], ack)
+	l := encodelength2(hdr[6:], uint(len(data)))
+	if err := d.transport.Write(hdr[:6+l]); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return d.transport.Write(data)
+}
+
+// tag is already read
+func (d *dlmsal) readgbtheader() (control byte, bn uint16, ack uint16, l uint, err error) {
+	_, err = io.ReadFull(d.transport, d.tmpbuffer[:5])
+	if err != nil {
+		return
+	}
+	control = d.tmpbuffer[0]
+	bn = binary.BigEndian.Uint16(d.tmpbuffer[1:])
+	ack = binary.BigEndian.Uint16(d.tmpbuffer[3:])
+	l, _, err = decodelength(d.transport, &d.tmpbuffer)
+	return
+}
+
+// sends whole apdu splitted into blocks, windows are sent as streams if the transport can flush,
+// the last block is acknowledged by the answer itself, so it is not waited for;
+// transports without base.Flusher send only with the next read, so every block waits for
+// its acknowledge (window 1); hdlc flush waits for RR of the frame, so each frame is still answered
+func (d *dlmsal) sendgbt(b []byte) error {
+	d.gbt.pending = b
+	return d.sendgbtfrom(1)
+}
+
+func (d *dlmsal) sendgbtfrom(next int) error {
+	b := d.gbt.pending
+	size := len(b)
+	if d.maxPduSendSize > 0 {
+		size = d.maxPduSendSize - gbtHeaderLength
+		if size <= 0 {
+			return fmt.Errorf("too small max pdu size for general block transfer")
+		}
+	}
+	total := 1
+	if len(b) > size {
+		total = (len(b) + size - 1) / size
+	}
+	if total > 0xffff {
+		return fmt.Errorf("too many blocks for general block transfer")
+	}
+	flusher, canflush := d.transport.(base.Flusher)
+	window := int(d.gbt.peerwindow)
+	if window == 0 || !canflush {
+		window = 1
+	}
+	ack := d.gbt.recvbn
+	retries := maxGbtRetries
+	for {
+		end := next + window - 1
+		if end > total {
+			end = total
+		}
+		for i := next; i <= end; i++ {
+			control := d.gbtwindow()
+			if i == total {
+				control |= gbtLastBlock
+			} else if i < end {
+				control |= gbtStreaming
+			}
+			off := (i - 1) * size
+			blk := b[off:min(off+size, len(b))]
+			if err := d.writegbtblock(control, uint16(i), ack, blk); err != nil {
+				return err
+			}
+			if i < end {
+				if err := flusher.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+		d.gbt.sentbn = uint16(end)
+		if end == total {
+			return nil
+		}
+
+		// wait for acknowledge of the window, missing blocks are sent again
+		_, err := io.ReadFull(d.transport, d.tmpbuffer[:1])
+		if err != nil {
+			if errors.Is(err, base.ErrCommunicationTimeout) && retries > 0 {
+				retries--
+				d.logf("no acknowledge of block %d, sending window again", end)
+				continue
+			}
+			return err
+		}
+		if CosemTag(d.tmpbuffer[0]) != TagGeneralBlockTransfer {
+			return fmt.Errorf("unexpected tag %x, expected general block transfer acknowledge", d.tmpbuffer[0])
+		}
+		control, _, rack, _, err := d.readgbtheader()
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(io.Discard, d.transport); err != nil {
+			return err
+		}
+		if int(rack) < next-1 || int(rack) > end {
+			return fmt.Errorf("unexpected acknowledged block %d, sent %d-%d", rack, next, end)
+		}
+		if int(rack) < end {
+			d.logf("blocks %d-%d lost, sending them again", rack+1, end)
+		}
+		d.gbt.peerwindow = control & gbtWindowMask
+		window = int(d.gbt.peerwindow)
+		if window == 0 || !canflush {
+			window = 1
+		}
+		next = int(rack) + 1
+		retries = maxGbtRetries
+	}
+}
+
+// reassembles apdu from general block transfer blocks, blocks out of order are dropped and the window
+// is acknowledged with the last good block, so the peer sends the rest again
+type gbtreader struct {
+	master    *dlmsal
+	remaining int
+	last      bool
+	streaming bool
+}
+
+// tag of the first block is already read
+func (d *dlmsal) newgbtreader() (*gbtreader, error) {
+	d.gbt.recvbn = 0
+	r := &gbtreader{master: d}
+	ok, err := r.readblock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err = r.next(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// reads block header, false means dropped block
+func (r *gbtreader) readblock() (bool, error) {
+	d := r.master
+	control, bn, ack, l, err := d.readgbtheader()
+	if err != nil {
+		return false, err
+	}
+	d.gbt.peerwindow = control & gbtWindowMask
+	r.streaming = control&gbtStreaming != 0
+	if l == 0 && d.gbt.pending != nil && ack < d.gbt.sentbn { // peer lost some blocks of the last window, no answer yet
+		d.logf("blocks %d-%d lost, sending them again", ack+1, d.gbt.sentbn)
+		if _, err = io.Copy(io.Discard, d.transport); err != nil {
+			return false, err
+		}
+		r.streaming = true // nothing to acknowledge
+		return false, d.sendgbtfrom(int(ack) + 1)
+	}
+	if bn != d.gbt.recvbn+1 {
+		d.logf("unexpected block number %d, expected %d, dropping it", bn, d.gbt.recvbn+1)
+		_, err = io.Copy(io.Discard, d.transport)
+		return false, err
+	}
+	d.gbt.recvbn = bn
+	d.gbt.pending = nil
+	r.last = control&gbtLastBlock != 0
+	r.remaining = int(l)
+	if l == 0 {
+		_, err = io.Copy(io.Discard, d.transport)
+	}
+	return true, err
+}
+
+// acknowledges window if the peer waits for it and reads the next good block
+func (r *gbtreader) next() error {
+	d := r.master
+	retries := maxGbtRetries
+	for {
+		if !r.streaming {
+			if err := d.writegbtblock(gbtLastBlock|d.gbtwindow(), d.gbt.sentbn, d.gbt.recvbn, nil); err != nil {
+				return err
+			}
+		}
+		_, err := io.ReadFull(d.transport, d.tmpbuffer[:1])
+		if err != nil {
+			if errors.Is(err, base.ErrCommunicationTimeout) && retries > 0 {
+				retries--
+				r.streaming = false // ask for the rest again
+				continue
+			}
+			return err
+		}
+		if CosemTag(d.tmpbuffer[0]) != TagGeneralBlockTransfer {
+			return fmt.Errorf("unexpected tag %x inside general block transfer", d.tmpbuffer[0])
+		}
+		ok, err := r.readblock()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+func (r *gbtreader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, base.ErrNothingToRead
+	}
+	for r.remaining == 0 {
+		if r.last {
+			return 0, io.EOF
+		}
+		if err = r.next(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+	d := r.master
+	n, err = d.transport.Read(p)
+	r.remaining -= n
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return n, io.ErrUnexpectedEOF
+		}
+		return
+	}
+	if r.remaining == 0 { // end of block, so the end of the apdu
+		_, err = io.Copy(io.Discard, d.transport)
+	}
+	return
+}
@@ -0,0 +1,193 @@
+package dlmsal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/cybroslabs/libdlms-go/base"
+)
+
+type gbtblock struct {
+	control byte
+	bn      uint16
+	ack     uint16
+	data    bool
+}
+
+func parsegbt(m []byte) (b gbtblock, ok bool) {
+	if len(m) < 7 || CosemTag(m[0]) != TagGeneralBlockTransfer {
+		return
+	}
+	return gbtblock{control: m[1], bn: binary.BigEndian.Uint16(m[2:]), ack: binary.BigEndian.Uint16(m[4:]), data: m[6] != 0}, true
+}
+
+// records sent data blocks, the first transmission of the block lost is dropped
+func recordgbt(blocks *[]gbtblock, lost uint16) func([]byte) []byte {
+	dropped := false
+	return func(m []byte) []byte {
+		b, ok := parsegbt(m)
+		if !ok || !b.data {
+			return m
+		}
+		*blocks = append(*blocks, b)
+		if b.bn == lost && !dropped {
+			dropped = true
+			return nil
+		}
+		return m
+	}
+}
+
+// the longest run of blocks sent without waiting for acknowledge
+func gbtmaxwindow(blocks []gbtblock) int {
+	ret, run := 0, 0
+	for _, b := range blocks {
+		run++
+		ret = max(ret, run)
+		if b.control&gbtStreaming == 0 {
+			run = 0
+		}
+	}
+	return ret
+}
+
+func gbtsettings(t *testing.T, window byte) *DlmsSettings {
+	t.Helper()
+	s, err := NewSettingsNoAuthenticationLN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxPduRecvSize = 128
+	s.ConformanceBlock |= ConformanceBlockGeneralBlockTransfer
+	s.GbtWindowSize = window
+	return s
+}
+
+// sets long value and gets it back, both by general block transfer
+func gbtexchange(t *testing.T, tr base.Stream, cs *DlmsSettings) {
+	t.Helper()
+	obis := DlmsObis{A: 0, B: 0, C: 96, D: 1, E: 0, F: 255}
+	long := make([]byte, 1500)
+	for i := range long {
+		long[i] = byte(i * 13)
+	}
+	c := New(tr, cs)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := c.Set([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2, SetData: &DlmsData{Tag: TagOctetString, Value: long}}})
+	if err != nil || rs[0] != TagResultSuccess {
+		t.Fatal(rs, err)
+	}
+	r, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := r[0].Value.([]byte); !ok || !bytes.Equal(b, long) {
+		t.Errorf("long value damaged by general block transfer: %v", r[0].Tag)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGbtWindows(t *testing.T) {
+	tests := []struct {
+		name         string
+		clientwindow byte
+		serverwindow byte
+		flush        bool
+	}{
+		{"window 1", 1, 1, true},
+		{"client 3 server 2", 3, 2, true},
+		{"window 5", 5, 5, true},
+		{"client without flush", 4, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newtesthandler()
+			h.ln[DlmsObis{A: 0, B: 0, C: 96, D: 1, E: 0, F: 255}] = DlmsData{Tag: TagOctetString, Value: []byte{}}
+			client, server := newtestpipe()
+			var sent, received []gbtblock
+			client.onsend = recordgbt(&sent, 0)
+			server.onsend = recordgbt(&received, 0)
+			_, stop := startserveron(t, client, server, gbtsettings(t, tt.serverwindow), h)
+			var tr base.Stream = client
+			if !tt.flush {
+				tr = struct{ base.Stream }{client}
+			}
+			gbtexchange(t, tr, gbtsettings(t, tt.clientwindow))
+			stop()
+
+			expsent := int(tt.serverwindow)
+			if !tt.flush {
+				expsent = 1
+			}
+			if w := gbtmaxwindow(sent); w != expsent {
+				t.Errorf("client sent window of %d blocks, expected %d", w, expsent)
+			}
+			if w := gbtmaxwindow(received); w != int(tt.clientwindow) {
+				t.Errorf("server sent window of %d blocks, expected %d", w, tt.clientwindow)
+			}
+			for _, b := range sent {
+				if b.control&gbtWindowMask != tt.clientwindow {
+					t.Fatalf("client block %d announces window %d", b.bn, b.control&gbtWindowMask)
+				}
+			}
+		})
+	}
+}
+
+func TestGbtLostBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  bool // block of the request is lost, otherwise block of the response
+		lost     uint16
+		lastwind bool
+	}{
+		{"request block", true, 3, false},
+		{"request block of the last window", true, 11, true},
+		{"response block", false, 2, false},
+		{"response block of the next window", false, 6, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newtesthandler()
+			h.ln[DlmsObis{A: 0, B: 0, C: 96, D: 1, E: 0, F: 255}] = DlmsData{Tag: TagOctetString, Value: []byte{}}
+			client, server := newtestpipe()
+			var sent, received []gbtblock
+			if tt.request {
+				client.onsend = recordgbt(&sent, tt.lost)
+				server.onsend = recordgbt(&received, 0)
+			} else {
+				client.onsend = recordgbt(&sent, 0)
+				server.onsend = recordgbt(&received, tt.lost)
+			}
+			_, stop := startserveron(t, client, server, gbtsettings(t, 4), h)
+			gbtexchange(t, client, gbtsettings(t, 4))
+			stop()
+
+			blocks := received
+			if tt.request {
+				blocks = sent
+			}
+			cnt := 0
+			last := uint16(0)
+			for _, b := range blocks {
+				if b.bn == tt.lost {
+					cnt++
+				}
+				if b.control&gbtLastBlock != 0 && last == 0 {
+					last = b.bn
+				}
+			}
+			if cnt != 2 {
+				t.Errorf("block %d sent %d times, expected once again after loss", tt.lost, cnt)
+			}
+			if tt.lastwind && last-tt.lost >= 4 {
+				t.Errorf("lost block %d isnt in the last window ending by %d", tt.lost, last)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package dlmsal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"math/big"
+)
+
+const (
+	snCurrentAssociation = 0xfa00                      // base name of the current association (class 12)
+	snReplyToHls         = snCurrentAssociation + 0x58 // method 8, reply_to_HLS_authentication
+)
+
+func ishashhls(mech Authentication) bool {
+	switch mech {
+	case AuthenticationHighMD5, AuthenticationHighSHA1, AuthenticationHighSha256:
+		return true
+	}
+	return false
+}
+
+// f(challenge) for hash based hls mechanisms, challenge is the one of the other side, ownchallenge the sent one,
+// system titles are used only by SHA-256, so the result is the same no matter which side computes it
+func hlsdigest(mech Authentication, secret []byte, ownst []byte, otherst []byte, challenge []byte, ownchallenge []byte) ([]byte, error) {
+	switch mech {
+	case AuthenticationHighMD5:
+		h := md5.New()
+		h.Write(challenge)
+		h.Write(secret)
+		return h.Sum(nil), nil
+	case AuthenticationHighSHA1:
+		h := sha1.New()
+		h.Write(challenge)
+		h.Write(secret)
+		return h.Sum(nil), nil
+	case AuthenticationHighSha256:
+		if len(ownst) != 8 || len(otherst) != 8 {
+			return nil, fmt.Errorf("system titles of both sides are required for SHA-256 authentication")
+		}
+		h := sha256.New()
+		h.Write(secret)
+		h.Write(ownst)
+		h.Write(otherst)
+		h.Write(challenge)
+		h.Write(ownchallenge)
+		return h.Sum(nil), nil
+	}
+	return nil, fmt.Errorf("unsupported authentication mechanism: %v", mech)
+}
+
+// P-256 with SHA-256 (suite 1) or P-384 with SHA-384 (suite 2), returns hash and length of the coordinate
+func ecdsaparams(curve elliptic.Curve) (hash.Hash, int, error) {
+	switch curve {
+	case elliptic.P256():
+		return sha256.New(), 32, nil
+	case elliptic.P384():
+		return sha512.New384(), 48, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported curve, only P-256 and P-384 are supported")
+}
+
+// digest of concatenated data, returns also length of the coordinate
+func ecdsadigest(curve elliptic.Curve, data ...[]byte) ([]byte, int, error) {
+	h, l, err := ecdsaparams(curve)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil), l, nil
+}
+
+// signature of concatenated data, r || s with fixed length
+func ecdsasigndata(key *ecdsa.PrivateKey, data ...[]byte) ([]byte, error) {
+	if key == nil {
+		return nil, fmt.Errorf("no signing key set")
+	}
+	dg, l, err := ecdsadigest(key.Curve, data...)
+	if err != nil {
+		return nil, err
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, key, dg)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]byte, 2*l)
+	r.FillBytes(ret[:l])
+	s.FillBytes(ret[l:])
+	return ret, nil
+}
+
+func ecdsaverifydata(key *ecdsa.PublicKey, sig []byte, data ...[]byte) error {
+	if key == nil {
+		return fmt.Errorf("no public key of the other side set")
+	}
+	dg, l, err := ecdsadigest(key.Curve, data...)
+	if err != nil {
+		return err
+	}
+	if len(sig) != 2*l {
+		return fmt.Errorf("invalid signature length")
+	}
+	r := new(big.Int).SetBytes(sig[:l])
+	s := new(big.Int).SetBytes(sig[l:])
+	if !ecdsa.Verify(key, dg, r, s) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// f(challenge) for ECDSA mechanism
+func ecdsasign(key *ecdsa.PrivateKey, ownst []byte, otherst []byte, challenge []byte, ownchallenge []byte) ([]byte, error) {
+	if len(ownst) != 8 || len(otherst) != 8 {
+		return nil, fmt.Errorf("system titles of both sides are required for ECDSA authentication")
+	}
+	return ecdsasigndata(key, ownst, otherst, challenge, ownchallenge)
+}
+
+// verifies f(challenge) of the other side, so system titles and challenges are from its point of view
+func ecdsaverify(key *ecdsa.PublicKey, sig []byte, ownst []byte, otherst []byte, challenge []byte, ownchallenge []byte) error {
+	if len(ownst) != 8 || len(otherst) != 8 {
+		return fmt.Errorf("system titles of both sides are required for ECDSA authentication")
+	}
+	return ecdsaverifydata(key, sig, ownst, otherst, challenge, ownchallenge)
+}
@@ -0,0 +1,207 @@
+package dlmsal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHlsDigest(t *testing.T) {
+	secret := []byte("HLSsecret0123456")
+	client := []byte("CLIENT01")
+	server := []byte("SERVER01")
+	ctos := []byte("K56iVagY")
+	stoc := []byte("P6wRJ21F")
+	tests := []struct {
+		name string
+		mech Authentication
+		stoc string // f(StoC) sent by the client
+		ctos string // f(CtoS) sent by the server
+	}{
+		// MD5(StoC || secret), MD5(CtoS || secret)
+		{"md5", AuthenticationHighMD5, "0602adef0fa124ef97244832ee69cae9", "022f917d15cb5a354e7854044832d11b"},
+		// SHA-1(StoC || secret), SHA-1(CtoS || secret)
+		{"sha1", AuthenticationHighSHA1, "3aa1f678a7f93c5b6fa68f97277a5d2dfc988244", "f3929863d032b9be82c87241b36499e1eb2e8cd8"},
+		// SHA-256(secret || SystemTitle-C || SystemTitle-S || StoC || CtoS) and the same from the server side
+		{"sha256", AuthenticationHighSha256, "2f9affe6ef207d4ded2cd41ebe23ed75d8cf7dba38a039ab7eb5001ae705cbb1", "6c28f4f2da6b31f025b5306fd917728d4d742bd43bc002f2f1bab453c818f264"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the same arguments as Pass3 and Pass4 of the client use
+			fstoc, err := hlsdigest(tt.mech, secret, client, server, stoc, ctos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(fstoc) != tt.stoc {
+				t.Errorf("f(StoC) %x, expected %s", fstoc, tt.stoc)
+			}
+			fctos, err := hlsdigest(tt.mech, secret, server, client, ctos, stoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(fctos) != tt.ctos {
+				t.Errorf("f(CtoS) %x, expected %s", fctos, tt.ctos)
+			}
+		})
+	}
+
+	if _, err := hlsdigest(AuthenticationHighSha256, secret, nil, server, stoc, ctos); err == nil {
+		t.Errorf("SHA-256 digest without system title computed")
+	}
+	if _, err := hlsdigest(AuthenticationHighGmac, secret, client, server, stoc, ctos); err == nil {
+		t.Errorf("digest of gmac computed")
+	}
+}
+
+func TestHlsWrongServerResponse(t *testing.T) {
+	secret := []byte("HLSsecret0123456")
+	for _, mech := range []Authentication{AuthenticationHighMD5, AuthenticationHighSHA1, AuthenticationHighSha256} {
+		for _, checkresp := range []bool{true, false} {
+			ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).HlsAuthentication(mech, secret, []byte("serverchallenge1")))
+			ss.MaxPduRecvSize = 1024
+			client, server := newtestpipe()
+			server.onsend = changeresponse([]byte{byte(TagActionResponse), byte(TagActionResponseNormal)}, 1, func(m []byte) []byte {
+				m[len(m)-1] ^= 0xff // last byte of f(CtoS)
+				return m
+			})
+			_, stop := startserveron(t, client, server, ss, newtesthandler())
+			c := New(client, testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).HlsAuthentication(mech, secret, []byte("clientchallenge1"))))
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			err := c.LNAuthentication(checkresp)
+			if checkresp {
+				if err == nil || !strings.Contains(err.Error(), "mismatch") {
+					t.Errorf("%v: wrong server response accepted, %v", mech, err)
+				}
+			} else if err != nil {
+				t.Errorf("%v: response checked: %v", mech, err)
+			}
+			stop()
+		}
+	}
+
+	// unchanged response is accepted
+	ss := testsettings(t, NewSettingsBuilderLN().HlsAuthentication(AuthenticationHighMD5, secret, []byte("serverchallenge1")))
+	ss.MaxPduRecvSize = 1024
+	client, _, stop := startserver(t, ss, newtesthandler())
+	defer stop()
+	c := New(client, testsettings(t, NewSettingsBuilderLN().HlsAuthentication(AuthenticationHighMD5, secret, bytes.Repeat([]byte{1}, 16))))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LNAuthentication(true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEcdsaAuthentication(t *testing.T) {
+	obis := DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			ck, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sk, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				name      string
+				clientkey *ecdsa.PrivateKey // key the client signs by, the server knows only ck
+				serverkey *ecdsa.PublicKey  // key the client verifies the server by
+				err       string            // expected error, empty means success
+				refused   bool              // refused by the server
+			}{
+				{"valid", ck, &sk.PublicKey, "", false},
+				{"wrong client signature", other, &sk.PublicKey, "authentication refused", true},
+				{"wrong server signature", ck, &other.PublicKey, "signature mismatch", false},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					h := newtesthandler()
+					h.ln[obis] = DlmsData{Tag: TagUnsigned, Value: uint8(5)}
+					ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).EcdsaAuthentication(bytes.Repeat([]byte{0x53}, 32), sk, &ck.PublicKey))
+					ss.MaxPduRecvSize = 1024
+					client, _, stop := startserver(t, ss, h)
+					defer stop()
+					cs, err := NewSettingsWithEcdsaLN([]byte("CLIENT01"), bytes.Repeat([]byte{0x43}, 48), tt.clientkey, tt.serverkey)
+					if err != nil {
+						t.Fatal(err)
+					}
+					c := New(client, cs)
+					if err = c.Open(); err != nil {
+						t.Fatal(err)
+					}
+					err = c.LNAuthentication(true)
+					if tt.err != "" {
+						if err == nil || !strings.Contains(err.Error(), tt.err) {
+							t.Fatalf("expected %s, got %v", tt.err, err)
+						}
+					} else if err != nil {
+						t.Fatal(err)
+					}
+					r, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}})
+					if tt.refused { // association stays unauthenticated
+						var e *ExceptionError
+						if !errors.As(err, &e) || e.StateError != TagStateErrorServiceNotAllowed {
+							t.Errorf("get allowed without authentication: %v", err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if r[0].Value != uint8(5) {
+						t.Errorf("unexpected value %v", r[0])
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestEcdsaSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := []byte("CLIENT01")
+	server := []byte("SERVER01")
+	ctos := bytes.Repeat([]byte{1}, 32)
+	stoc := bytes.Repeat([]byte{2}, 32)
+	sig, err := ecdsasign(key, client, server, stoc, ctos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != 64 {
+		t.Fatalf("unexpected signature length %d", len(sig))
+	}
+	if err = ecdsaverify(&key.PublicKey, sig, client, server, stoc, ctos); err != nil {
+		t.Fatal(err)
+	}
+	changed := bytes.Clone(sig)
+	changed[10] ^= 1
+	if err = ecdsaverify(&key.PublicKey, changed, client, server, stoc, ctos); err == nil {
+		t.Errorf("changed signature accepted")
+	}
+	if err = ecdsaverify(&key.PublicKey, sig, server, client, stoc, ctos); err == nil { // the other direction
+		t.Errorf("signature of swapped system titles accepted")
+	}
+	if err = ecdsaverify(&key.PublicKey, sig[:63], client, server, stoc, ctos); err == nil {
+		t.Errorf("short signature accepted")
+	}
+	if _, err = ecdsasign(key, nil, server, stoc, ctos); err == nil {
+		t.Errorf("signed without system title")
+	}
+}
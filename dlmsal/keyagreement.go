@@ -0,0 +1,352 @@
+package dlmsal
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"fmt"
+	"hash"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
+)
+
+// cryptographic algorithm ids (AlgorithmID of the kdf)
+var (
+	algidAesGcm128 = []byte{0x60, 0x85, 0x74, 0x05, 0x08, 0x03, 0x00}
+	algidAesGcm256 = []byte{0x60, 0x85, 0x74, 0x05, 0x08, 0x03, 0x01}
+)
+
+// curve, kdf hash, algorithm id and key length of the suite, only suites 1 and 2 support key agreement
+func ecdhparams(suite SecuritySuite) (ecdh.Curve, hash.Hash, []byte, int, error) {
+	switch suite {
+	case SecuritySuite1:
+		return ecdh.P256(), sha256.New(), algidAesGcm128, 16, nil
+	case SecuritySuite2:
+		return ecdh.P384(), sha512.New384(), algidAesGcm256, 32, nil
+	}
+	return nil, nil, nil, 0, fmt.Errorf("key agreement is not supported by security suite %d", suite)
+}
+
+// NIST SP 800-56A concatenation kdf, single round is enough as the key is never longer than the hash,
+// otherinfo is AlgorithmID || PartyUInfo || PartyVInfo, all of them with fixed length
+func ecdhkdf(suite SecuritySuite, z []byte, otherinfo ...[]byte) ([]byte, error) {
+	_, h, algid, kl, err := ecdhparams(suite)
+	if err != nil {
+		return nil, err
+	}
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write(z)
+	h.Write(algid)
+	for _, o := range otherinfo {
+		h.Write(o)
+	}
+	return h.Sum(nil)[:kl], nil
+}
+
+// shared secret of the own private key and public key of the other side, both have to be on the curve of the suite
+func ecdhsecret(suite SecuritySuite, key *ecdh.PrivateKey, peer *ecdh.PublicKey) ([]byte, error) {
+	c, _, _, _, err := ecdhparams(suite)
+	if err != nil {
+		return nil, err
+	}
+	if key.Curve() != c || peer.Curve() != c {
+		return nil, fmt.Errorf("keys dont match curve of security suite %d", suite)
+	}
+	return key.ECDH(peer)
+}
+
+// public key as x || y, without the uncompressed point prefix
+func ecdhpublic(key *ecdh.PublicKey) []byte {
+	return key.Bytes()[1:]
+}
+
+func ecdhparsepublic(suite SecuritySuite, raw []byte) (*ecdh.PublicKey, error) {
+	c, _, _, _, err := ecdhparams(suite)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewPublicKey(append([]byte{0x04}, raw...))
+}
+
+// PartyVInfo of the one-pass and static schemes, transaction-id with its length and system title of the recipient
+func partyvinfo(transactionid []byte, recipient []byte) []byte {
+	ret := make([]byte, 0, 1+len(transactionid)+len(recipient))
+	ret = append(ret, byte(len(transactionid)))
+	ret = append(ret, transactionid...)
+	return append(ret, recipient...)
+}
+
+// One-Pass Diffie-Hellman C(1e, 1s) of the originator, recipientkey is static key agreement key of the recipient,
+// returns own ephemeral public key (x || y) to be sent with the apdu and the derived key
+func OnePassKeyOriginator(suite SecuritySuite, recipientkey *ecdsa.PublicKey, originator []byte, recipient []byte, transactionid []byte) (ephemeral []byte, key []byte, err error) {
+	c, _, _, _, err := ecdhparams(suite)
+	if err != nil {
+		return
+	}
+	peer, err := recipientkey.ECDH()
+	if err != nil {
+		return
+	}
+	eph, err := c.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	z, err := ecdhsecret(suite, eph, peer)
+	if err != nil {
+		return
+	}
+	defer clear(z)
+	key, err = ecdhkdf(suite, z, originator, partyvinfo(transactionid, recipient))
+	if err != nil {
+		return
+	}
+	return ecdhpublic(eph.PublicKey()), key, nil
+}
+
+// One-Pass Diffie-Hellman C(1e, 1s) of the recipient, key is own static key agreement key,
+// ephemeral is the received public key of the originator
+func OnePassKeyRecipient(suite SecuritySuite, key *ecdsa.PrivateKey, ephemeral []byte, originator []byte, recipient []byte, transactionid []byte) ([]byte, error) {
+	own, err := key.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	peer, err := ecdhparsepublic(suite, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	z, err := ecdhsecret(suite, own, peer)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(z)
+	return ecdhkdf(suite, z, originator, partyvinfo(transactionid, recipient))
+}
+
+// Static Unified Model C(0e, 2s), both sides use static key agreement keys, so both of them derive the same key
+// from the same originator, recipient and transaction-id
+func StaticUnifiedModelKey(suite SecuritySuite, key *ecdsa.PrivateKey, peerkey *ecdsa.PublicKey, originator []byte, recipient []byte, transactionid []byte) ([]byte, error) {
+	own, err := key.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	peer, err := peerkey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	z, err := ecdhsecret(suite, own, peer)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(z)
+	return ecdhkdf(suite, z, originator, partyvinfo(transactionid, recipient))
+}
+
+// static key agreement keys of general-ciphering with agreed key (KeyAgreement), key is own key, peercert holds the key
+// of the other side, one-pass originator needs only the key of the other side and recipient only own key
+func (d *DlmsSettings) SetKeyAgreementKeys(key *ecdsa.PrivateKey, peercert *x509.Certificate) error {
+	var pk *ecdsa.PublicKey
+	if peercert != nil {
+		var ok bool
+		if pk, ok = peercert.PublicKey.(*ecdsa.PublicKey); !ok {
+			return fmt.Errorf("certificate does not contain ecdsa public key")
+		}
+	}
+	if key == nil && pk == nil {
+		return fmt.Errorf("key or certificate has to be set")
+	}
+	if key != nil {
+		if _, _, err := ecdsaparams(key.Curve); err != nil {
+			return err
+		}
+	}
+	if pk != nil {
+		if _, _, err := ecdsaparams(pk.Curve); err != nil {
+			return err
+		}
+	}
+	d.agreekey = key
+	d.agreepeerkey = pk
+	return nil
+}
+
+// ciphering of a single sent general-ciphering by the key agreed with recipient, ephemeral is own public key
+// in case of one-pass scheme, it is sent as key-ciphered-data
+func (d *DlmsSettings) sendagreedgcm(recipient []byte, transactionid []byte) (g gcm.Gcm, ephemeral []byte, err error) {
+	if d.agreepeerkey == nil || (d.KeyAgreement == KeyAgreementStaticUnifiedModel && d.agreekey == nil) {
+		return nil, nil, fmt.Errorf("key agreement keys are required for agreed key")
+	}
+	var key []byte
+	switch d.KeyAgreement {
+	case KeyAgreementOnePass:
+		ephemeral, key, err = OnePassKeyOriginator(d.SecuritySuite, d.agreepeerkey, d.systemtitle, recipient, transactionid)
+	case KeyAgreementStaticUnifiedModel:
+		key, err = StaticUnifiedModelKey(d.SecuritySuite, d.agreekey, d.agreepeerkey, d.systemtitle, recipient, transactionid)
+	default:
+		return nil, nil, fmt.Errorf("unsupported key agreement scheme: %d", d.KeyAgreement)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	g, err = d.agreedgcm(key)
+	return g, ephemeral, err
+}
+
+// ciphering of a single received general-ciphering with agreed key, own system title is the recipient
+func (d *DlmsSettings) recvagreedgcm(gc *generalciphered) (gcm.Gcm, error) {
+	if d.agreekey == nil || (gc.agreement == KeyAgreementStaticUnifiedModel && d.agreepeerkey == nil) {
+		return nil, fmt.Errorf("key agreement keys are required for agreed key")
+	}
+	var key []byte
+	var err error
+	switch gc.agreement {
+	case KeyAgreementOnePass:
+		key, err = OnePassKeyRecipient(d.SecuritySuite, d.agreekey, gc.keydata, gc.systitle, d.systemtitle, gc.transactionid)
+	case KeyAgreementStaticUnifiedModel:
+		key, err = StaticUnifiedModelKey(d.SecuritySuite, d.agreekey, d.agreepeerkey, gc.systitle, d.systemtitle, gc.transactionid)
+	default:
+		return nil, fmt.Errorf("unsupported key agreement scheme: %d", gc.agreement)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.agreedgcm(key)
+}
+
+// agreed key is used with the current authentication key, key is cleared
+func (d *DlmsSettings) agreedgcm(key []byte) (gcm.Gcm, error) {
+	defer clear(key)
+	ak, err := d.currentkey(KeyIdAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	if d.keyprovider != nil {
+		defer clear(ak)
+	}
+	return gcm.NewGCM(key, ak)
+}
+
+// Ephemeral Unified Model C(2e, 0s) by key_agreement (method 3) of the security setup 0-0:43.0.instance.255,
+// ephemeral keys are signed by the keys set by SetSigningKeys (or ecdsa settings), the client is party U,
+// agreed unicast and authentication keys replace ciphering of the settings, all agreed keys are returned
+func (d *dlmsal) AgreeKeys(instance byte, keys []KeyId) ([]KeyData, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys to agree")
+	}
+	s := d.settings
+	c, _, _, _, err := ecdhparams(s.SecuritySuite)
+	if err != nil {
+		return nil, err
+	}
+	if s.signkey == nil || s.peerkey == nil {
+		return nil, fmt.Errorf("signing keys are required for key agreement")
+	}
+	if len(s.systemtitle) != 8 || len(d.aareres.SystemTitle) != 8 {
+		return nil, fmt.Errorf("system titles of both sides are required for key agreement")
+	}
+
+	ephs := make([]*ecdh.PrivateKey, len(keys))
+	kd := make([]DlmsData, len(keys))
+	for i, id := range keys {
+		switch id {
+		case KeyIdGlobalUnicast, KeyIdGlobalBroadcast, KeyIdAuthentication, KeyIdMaster:
+		default:
+			return nil, fmt.Errorf("unsupported key id: %d", id)
+		}
+		ephs[i], err = c.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		pub := ecdhpublic(ephs[i].PublicKey())
+		sig, err := ecdsasigndata(s.signkey, []byte{byte(id)}, pub)
+		if err != nil {
+			return nil, err
+		}
+		kd[i] = DlmsData{Tag: TagStructure, Value: []DlmsData{{Tag: TagEnum, Value: uint8(id)}, {Tag: TagOctetString, Value: append(pub, sig...)}}}
+	}
+
+	req := DlmsLNRequestItem{
+		ClassId:   64,
+		Obis:      DlmsObis{A: 0, B: 0, C: 43, D: 0, E: instance, F: 255},
+		Attribute: 3,
+		SetData:   &DlmsData{Tag: TagArray, Value: kd}}
+	data, err := d.Action(req)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("no data received from key agreement")
+	}
+	if data.Tag == TagError {
+		if e, ok := data.Value.(error); ok {
+			return nil, fmt.Errorf("key agreement refused: %w", e)
+		}
+		return nil, fmt.Errorf("key agreement refused")
+	}
+	rd, ok := data.Value.([]DlmsData)
+	if data.Tag != TagArray || !ok || len(rd) != len(keys) {
+		return nil, fmt.Errorf("unexpected key agreement response")
+	}
+
+	ret := make([]KeyData, len(keys))
+	var ek, ak []byte
+	for i, id := range keys {
+		param, err := decodekeydata(&rd[i], id)
+		if err != nil {
+			return nil, err
+		}
+		pl := len(ecdhpublic(ephs[i].PublicKey()))
+		if len(param) <= pl {
+			return nil, fmt.Errorf("invalid key parameter length")
+		}
+		if err = ecdsaverifydata(s.peerkey, param[pl:], []byte{byte(id)}, param[:pl]); err != nil {
+			return nil, fmt.Errorf("invalid signature of server ephemeral key: %w", err)
+		}
+		peer, err := ecdhparsepublic(s.SecuritySuite, param[:pl])
+		if err != nil {
+			return nil, err
+		}
+		z, err := ecdhsecret(s.SecuritySuite, ephs[i], peer)
+		if err != nil {
+			return nil, err
+		}
+		k, err := ecdhkdf(s.SecuritySuite, z, s.systemtitle, d.aareres.SystemTitle)
+		clear(z)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = KeyData{KeyId: id, Key: k}
+		switch id {
+		case KeyIdGlobalUnicast:
+			ek = k
+		case KeyIdAuthentication:
+			ak = k
+		}
+	}
+	if err = d.replacekeys(ek, ak); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// key_parameter of the key_data structure with expected key id
+func decodekeydata(data *DlmsData, id KeyId) ([]byte, error) {
+	st, ok := data.Value.([]DlmsData)
+	if data.Tag != TagStructure || !ok || len(st) != 2 {
+		return nil, fmt.Errorf("unexpected key data")
+	}
+	var rid uint8
+	if err := Cast(&rid, st[0]); err != nil {
+		return nil, err
+	}
+	if KeyId(rid) != id {
+		return nil, fmt.Errorf("unexpected key id %d, expected %d", rid, id)
+	}
+	var param []byte
+	if err := Cast(&param, st[1]); err != nil {
+		return nil, err
+	}
+	return param, nil
+}
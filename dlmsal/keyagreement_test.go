@@ -0,0 +1,154 @@
+package dlmsal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestKeyAgreementSchemes(t *testing.T) {
+	u, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ust, vst, tid := []byte("CLIENT01"), []byte("SERVER01"), []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+	eph, ukey, err := OnePassKeyOriginator(SecuritySuite1, &v.PublicKey, ust, vst, tid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err := OnePassKeyRecipient(SecuritySuite1, v, eph, ust, vst, tid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ukey) != 16 || !bytes.Equal(ukey, vkey) {
+		t.Errorf("one-pass keys differ: %x %x", ukey, vkey)
+	}
+	if other, _ := OnePassKeyRecipient(SecuritySuite1, v, eph, ust, vst, []byte{1}); bytes.Equal(other, ukey) {
+		t.Errorf("the same key agreed for other transaction")
+	}
+
+	ukey, err = StaticUnifiedModelKey(SecuritySuite1, u, &v.PublicKey, ust, vst, tid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err = StaticUnifiedModelKey(SecuritySuite1, v, &u.PublicKey, ust, vst, tid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ukey) != 16 || !bytes.Equal(ukey, vkey) {
+		t.Errorf("static unified model keys differ: %x %x", ukey, vkey)
+	}
+
+	if _, err = StaticUnifiedModelKey(SecuritySuite0, u, &v.PublicKey, ust, vst, tid); err == nil {
+		t.Errorf("key agreed by suite 0")
+	}
+	if _, err = StaticUnifiedModelKey(SecuritySuite2, u, &v.PublicKey, ust, vst, tid); err == nil {
+		t.Errorf("P-256 keys used by suite 2")
+	}
+}
+
+// suite 1 settings with general-ciphering by agreed key, key is own static key, peer is the key of the other side
+func agreedsettings(t *testing.T, st string, scheme KeyAgreementScheme, key *ecdsa.PrivateKey, peer *ecdsa.PrivateKey) *DlmsSettings {
+	t.Helper()
+	s := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte(st)).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	if err := s.SetSecuritySuite(SecuritySuite1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetKeyAgreementKeys(key, &x509.Certificate{PublicKey: &peer.PublicKey}); err != nil {
+		t.Fatal(err)
+	}
+	s.CipheredApdu = CipheredApduGeneral
+	s.KeyAgreement = scheme
+	s.MaxPduRecvSize = 1024
+	return s
+}
+
+func TestGeneralCipheringAgreedKey(t *testing.T) {
+	obis := DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}
+	ck, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []KeyAgreementScheme{KeyAgreementOnePass, KeyAgreementStaticUnifiedModel} {
+		t.Run(map[KeyAgreementScheme]string{KeyAgreementOnePass: "one-pass", KeyAgreementStaticUnifiedModel: "static unified model"}[scheme], func(t *testing.T) {
+			h := newtesthandler()
+			h.ln[obis] = DlmsData{Tag: TagUnsigned, Value: uint8(5)}
+			client, server := newtestpipe()
+			var agreed int
+			client.onsend = func(m []byte) []byte {
+				gc, err := decodegeneralciphering(CosemTag(m[0]), bytes.NewBuffer(m[1:]), &tmpbuffer{})
+				if err == nil && gc.agreement == scheme {
+					agreed++
+				}
+				return m
+			}
+			_, stop := startserveron(t, client, server, agreedsettings(t, "SERVER01", scheme, sk, ck), h)
+			defer stop()
+			c := New(client, agreedsettings(t, "CLIENT01", scheme, ck, sk))
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				r, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r[0].Value != uint8(5) {
+					t.Errorf("unexpected value %v", r[0])
+				}
+			}
+			if agreed != 2 {
+				t.Errorf("%d requests sent by agreed key", agreed)
+			}
+		})
+	}
+}
+
+func TestGeneralCipheringAgreedKeyRefused(t *testing.T) {
+	ck, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := newtestpipe()
+	srv := NewServer(server, agreedsettings(t, "SERVER01", KeyAgreementOnePass, sk, ck), newtesthandler())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve() }()
+	// request is agreed with other key than the server has
+	c := New(client, agreedsettings(t, "CLIENT01", KeyAgreementOnePass, ck, other))
+	if err = c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}, Attribute: 2}})
+	}()
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Errorf("request agreed with other key accepted")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("server didnt refuse the request")
+	}
+	_ = server.Disconnect()
+}
@@ -0,0 +1,201 @@
+package dlmsal
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
+)
+
+// source of meter keys resolved on demand, systemtitle is system title of the meter,
+// implementation can keep keys outside of the process (hsm) and return its own gcm
+type KeyProvider interface {
+	// ciphering by global unicast key (or dedicated key if it is not nil) and authentication key of the meter
+	Gcm(systemtitle []byte, dedicatedkey []byte) (gcm.Gcm, error)
+	// raw key, it is needed only by key transfer and agreement if some of the global keys are kept, provider can refuse it
+	Key(systemtitle []byte, id KeyId) ([]byte, error)
+}
+
+// provider which is also able to store keys, new keys are stored there after successful key transfer or agreement
+type KeyStore interface {
+	KeyProvider
+	SetKey(systemtitle []byte, id KeyId, key []byte) error
+}
+
+type zeroizer interface {
+	Zeroize()
+}
+
+// keys of the meter with given system title are resolved by Open and dropped (zeroized) by Close or Disconnect,
+// so settings dont keep any key material between associations, keys given to the settings constructor are ignored
+func (d *DlmsSettings) SetKeyProvider(provider KeyProvider, systemtitle []byte) error {
+	if provider != nil && len(systemtitle) != 8 {
+		return fmt.Errorf("systemtitle of the meter has to be 8 bytes long")
+	}
+	d.dropkeys()
+	clear(d.ekcopy)
+	clear(d.akcopy)
+	d.ekcopy = nil
+	d.akcopy = nil
+	d.keyprovider = provider
+	d.peersystemtitle = newcopy(systemtitle)
+	return nil
+}
+
+// called by Open, dedicated key set by SetDedicatedKey is resolved too
+func (d *DlmsSettings) resolvekeys() (err error) {
+	d.gcm, err = d.keyprovider.Gcm(d.peersystemtitle, nil)
+	if err != nil {
+		return fmt.Errorf("unable to resolve keys of %x: %w", d.peersystemtitle, err)
+	}
+	if d.dedicatedkey != nil {
+		d.dedgcm, err = d.keyprovider.Gcm(d.peersystemtitle, d.dedicatedkey)
+		if err != nil {
+			return fmt.Errorf("unable to resolve dedicated key: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolved gcm is zeroized, dedicated key is kept unless it is generated
+func (d *DlmsSettings) dropkeys() {
+	if d.keyprovider == nil {
+		return
+	}
+	if z, ok := d.gcm.(zeroizer); ok {
+		z.Zeroize()
+	}
+	if z, ok := d.dedgcm.(zeroizer); ok {
+		z.Zeroize()
+	}
+	d.gcm = nil
+	d.dedgcm = nil
+}
+
+// current global key, nil key is returned in case of missing authentication key
+func (d *DlmsSettings) currentkey(id KeyId) ([]byte, error) {
+	if d.keyprovider == nil {
+		switch id {
+		case KeyIdGlobalUnicast:
+			return d.ekcopy, nil
+		case KeyIdAuthentication:
+			return d.akcopy, nil
+		}
+		return nil, fmt.Errorf("key %d is not kept by the settings", id)
+	}
+	return d.keyprovider.Key(d.peersystemtitle, id)
+}
+
+type filekeystore struct {
+	mu   sync.Mutex
+	path string
+	kek  []byte
+}
+
+// keys are wrapped (RFC 3394) by kek and kept in json file as hex strings per system title and key id,
+// file is read on every request, so unwrapped keys live only during gcm creation, missing file means no keys
+func NewFileKeyStore(path string, kek []byte) (KeyStore, error) {
+	if len(kek) != 16 && len(kek) != 24 && len(kek) != 32 {
+		return nil, fmt.Errorf("kek has to be 16, 24 or 32 bytes long")
+	}
+	return &filekeystore{path: path, kek: newcopy(kek)}, nil
+}
+
+// system title -> key id -> wrapped key
+type filekeystorecontent map[string]map[KeyId]string
+
+func (f *filekeystore) read() (filekeystorecontent, error) {
+	ret := make(filekeystorecontent)
+	data, err := os.ReadFile(f.path)
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(data, &ret); err != nil {
+			return nil, fmt.Errorf("invalid content of %s: %w", f.path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (f *filekeystore) key(systemtitle []byte, id KeyId) ([]byte, error) {
+	c, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	w, ok := c[hex.EncodeToString(systemtitle)][id]
+	if !ok {
+		return nil, nil
+	}
+	wb, err := hex.DecodeString(w)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %d of %x: %w", id, systemtitle, err)
+	}
+	ret, err := gcm.KeyUnwrap(f.kek, wb)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap key %d of %x: %w", id, systemtitle, err)
+	}
+	return ret, nil
+}
+
+func (f *filekeystore) Key(systemtitle []byte, id KeyId) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret, err := f.key(systemtitle, id)
+	if err == nil && ret == nil && id != KeyIdAuthentication {
+		return nil, fmt.Errorf("no key %d of %x", id, systemtitle)
+	}
+	return ret, err
+}
+
+func (f *filekeystore) Gcm(systemtitle []byte, dedicatedkey []byte) (gcm.Gcm, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ek := dedicatedkey
+	if ek == nil {
+		k, err := f.key(systemtitle, KeyIdGlobalUnicast)
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			return nil, fmt.Errorf("no key %d of %x", KeyIdGlobalUnicast, systemtitle)
+		}
+		defer clear(k)
+		ek = k
+	}
+	ak, err := f.key(systemtitle, KeyIdAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(ak)
+	return gcm.NewGCM(ek, ak)
+}
+
+func (f *filekeystore) SetKey(systemtitle []byte, id KeyId, key []byte) error {
+	w, err := gcm.KeyWrap(f.kek, key)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.read()
+	if err != nil {
+		return err
+	}
+	st := hex.EncodeToString(systemtitle)
+	if c[st] == nil {
+		c[st] = make(map[KeyId]string)
+	}
+	c[st][id] = hex.EncodeToString(w)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writefile(f.path, append(data, '\n'))
+}
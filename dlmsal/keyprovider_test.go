@@ -0,0 +1,92 @@
+package dlmsal_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybroslabs/libdlms-go/dlmsal"
+	"github.com/cybroslabs/libdlms-go/gcm"
+)
+
+// key store implemented outside of the package
+type mapkeystore map[string]map[dlmsal.KeyId][]byte
+
+func (m mapkeystore) Key(systemtitle []byte, id dlmsal.KeyId) ([]byte, error) {
+	k, ok := m[string(systemtitle)][id]
+	if !ok && id != dlmsal.KeyIdAuthentication {
+		return nil, fmt.Errorf("no key %d of %x", id, systemtitle)
+	}
+	return bytes.Clone(k), nil
+}
+
+func (m mapkeystore) SetKey(systemtitle []byte, id dlmsal.KeyId, key []byte) error {
+	if m[string(systemtitle)] == nil {
+		m[string(systemtitle)] = make(map[dlmsal.KeyId][]byte)
+	}
+	m[string(systemtitle)][id] = bytes.Clone(key)
+	return nil
+}
+
+func (m mapkeystore) Gcm(systemtitle []byte, dedicatedkey []byte) (gcm.Gcm, error) {
+	ek := dedicatedkey
+	if ek == nil {
+		ek = m[string(systemtitle)][dlmsal.KeyIdGlobalUnicast]
+	}
+	return gcm.NewGCM(ek, m[string(systemtitle)][dlmsal.KeyIdAuthentication])
+}
+
+func TestKeyStoreOutsideOfPackage(t *testing.T) {
+	var ks dlmsal.KeyStore = mapkeystore{}
+	st := []byte("METER001")
+	if err := ks.SetKey(st, dlmsal.KeyIdGlobalUnicast, []byte("0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dlmsal.NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).
+		CipheringWithKeyProvider(dlmsal.SecurityEncryption, ks, st, 1).Build(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Gcm(st, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	kek := []byte("masterkey0123456")
+	st := []byte("METER001")
+	ks, err := dlmsal.NewFileKeyStore(path, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ks.Key(st, dlmsal.KeyIdGlobalUnicast); err == nil {
+		t.Errorf("missing key returned")
+	}
+	if err = ks.SetKey(st, dlmsal.KeyIdGlobalUnicast, []byte("0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	if ak, err := ks.Key(st, dlmsal.KeyIdAuthentication); err != nil || ak != nil {
+		t.Errorf("missing authentication key: %x %v", ak, err)
+	}
+
+	// keys are kept in the file
+	ks, err = dlmsal.NewFileKeyStore(path, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ks.Key(st, dlmsal.KeyIdGlobalUnicast)
+	if err != nil || string(k) != "0123456789abcdef" {
+		t.Fatalf("unexpected key %x %v", k, err)
+	}
+	if _, err = ks.Gcm(st, nil); err != nil {
+		t.Fatal(err)
+	}
+	other, err := dlmsal.NewFileKeyStore(path, []byte("otherkey01234567"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.Key(st, dlmsal.KeyIdGlobalUnicast); err == nil {
+		t.Errorf("key unwrapped by other kek")
+	}
+}
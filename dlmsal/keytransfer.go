@@ -0,0 +1,140 @@
+package dlmsal
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
+)
+
+// key_id of the security setup, it identifies keys of KeyProvider and KeyStore too
+type KeyId byte
+
+const (
+	KeyIdGlobalUnicast   KeyId = 0 // global unicast encryption key
+	KeyIdGlobalBroadcast KeyId = 1 // global broadcast encryption key
+	KeyIdAuthentication  KeyId = 2
+	KeyIdMaster          KeyId = 3 // key encryption key
+)
+
+// plain key, it is wrapped by the master key before the transfer
+type KeyData struct {
+	KeyId KeyId
+	Key   []byte
+}
+
+// invokes key_transfer (method 2) of the security setup 0-0:43.0.instance.255, keys are wrapped by kek (current master key),
+// new unicast and authentication keys replace ciphering of the settings once the meter accepts them,
+// broadcast and master keys are not used by the client, so keeping them is up to the caller
+func (d *dlmsal) TransferKeys(instance byte, kek []byte, keys []KeyData) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys to transfer")
+	}
+	s := d.settings
+	kl := 16
+	if s.SecuritySuite == SecuritySuite2 {
+		kl = 32
+	}
+	var ek, ak []byte
+	kd := make([]DlmsData, len(keys))
+	for i, k := range keys {
+		if len(k.Key) != kl {
+			return fmt.Errorf("security suite %d requires %d bytes long keys", s.SecuritySuite, kl)
+		}
+		switch k.KeyId {
+		case KeyIdGlobalUnicast:
+			ek = k.Key
+		case KeyIdAuthentication:
+			ak = k.Key
+		case KeyIdGlobalBroadcast, KeyIdMaster:
+		default:
+			return fmt.Errorf("unsupported key id: %d", k.KeyId)
+		}
+		w, err := gcm.KeyWrap(kek, k.Key)
+		if err != nil {
+			return fmt.Errorf("unable to wrap key: %w", err)
+		}
+		kd[i] = DlmsData{Tag: TagStructure, Value: []DlmsData{{Tag: TagEnum, Value: uint8(k.KeyId)}, {Tag: TagOctetString, Value: w}}}
+	}
+
+	req := DlmsLNRequestItem{
+		ClassId:   64,
+		Obis:      DlmsObis{A: 0, B: 0, C: 43, D: 0, E: instance, F: 255},
+		Attribute: 2,
+		SetData:   &DlmsData{Tag: TagArray, Value: kd}}
+	data, err := d.Action(req)
+	if err != nil {
+		return err
+	}
+	if data != nil && data.Tag == TagError {
+		if e, ok := data.Value.(error); ok {
+			return fmt.Errorf("key transfer refused: %w", e)
+		}
+		return fmt.Errorf("key transfer refused")
+	}
+
+	return d.replacekeys(ek, ak)
+}
+
+// replaces ciphering of the settings by new global keys, nil key means the current one, dedicated key is kept,
+// nothing is changed in case of error, settings without ciphering are kept as they are,
+// new keys are stored if the key provider is KeyStore
+func (d *dlmsal) replacekeys(ek []byte, ak []byte) (err error) {
+	s := d.settings
+	if s.gcm == nil || (ek == nil && ak == nil) {
+		return nil
+	}
+	newek, newak := ek, ak
+	ekchanged := ek != nil && !bytes.Equal(ek, s.ekcopy)
+	if ek == nil {
+		if ek, err = s.currentkey(KeyIdGlobalUnicast); err != nil {
+			return err
+		}
+		if s.keyprovider != nil {
+			defer clear(ek)
+		}
+	}
+	if ak == nil {
+		if ak, err = s.currentkey(KeyIdAuthentication); err != nil {
+			return err
+		}
+		if s.keyprovider != nil {
+			defer clear(ak)
+		}
+	}
+	g, err := gcm.NewGCM(ek, ak)
+	if err != nil {
+		return err
+	}
+	var dg gcm.Gcm
+	if s.dedicatedkey != nil {
+		dg, err = gcm.NewGCM(s.dedicatedkey, ak)
+		if err != nil {
+			return err
+		}
+	}
+	if ks, ok := s.keyprovider.(KeyStore); ok {
+		if newek != nil {
+			if err = ks.SetKey(s.peersystemtitle, KeyIdGlobalUnicast, newek); err != nil {
+				return fmt.Errorf("unable to store new key: %w", err)
+			}
+		}
+		if newak != nil {
+			if err = ks.SetKey(s.peersystemtitle, KeyIdAuthentication, newak); err != nil {
+				return fmt.Errorf("unable to store new key: %w", err)
+			}
+		}
+	}
+	s.gcm = g
+	if s.keyprovider == nil {
+		s.ekcopy = newcopy(ek)
+		s.akcopy = newcopy(ak)
+	}
+	if dg != nil {
+		s.dedgcm = dg
+	}
+	if ekchanged && s.rxframecounters != nil { // meter starts counting from zero with the new key
+		delete(s.rxframecounters, string(d.aareres.SystemTitle))
+	}
+	return nil
+}
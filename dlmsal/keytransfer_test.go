@@ -0,0 +1,93 @@
+package dlmsal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
+)
+
+// unwraps transferred keys like the meter does
+type keytransferhandler struct {
+	*testhandler
+	kek  []byte
+	keys map[KeyId][]byte
+}
+
+func (h *keytransferhandler) Action(item *DlmsLNRequestItem) (*DlmsData, DlmsResultTag) {
+	if item.ClassId != 64 || item.Attribute != 2 || item.SetData == nil || item.SetData.Tag != TagArray {
+		return nil, TagResultOtherReason
+	}
+	for _, k := range item.SetData.Value.([]DlmsData) {
+		f := k.Value.([]DlmsData)
+		key, err := gcm.KeyUnwrap(h.kek, f[1].Value.([]byte))
+		if err != nil {
+			return nil, TagResultOtherReason
+		}
+		h.keys[KeyId(f[0].Value.(uint8))] = key
+	}
+	return nil, TagResultSuccess
+}
+
+func TestTransferKeys(t *testing.T) {
+	obis := DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}
+	kek := []byte("masterkey0123456")
+	newek := []byte("newunicastkey012")
+	newak := []byte("newauthkey012345")
+	h := &keytransferhandler{testhandler: newtesthandler(), kek: kek, keys: make(map[KeyId][]byte)}
+	h.ln[obis] = DlmsData{Tag: TagUnsigned, Value: uint8(5)}
+	ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	ss.MaxPduRecvSize = 1024
+	client, srv, stop := startserver(t, ss, h)
+	defer stop()
+	cs := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	c := New(client, cs)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.TransferKeys(0, kek, []KeyData{{KeyId: KeyIdGlobalUnicast, Key: newek}, {KeyId: KeyIdAuthentication, Key: make([]byte, 8)}}); err == nil {
+		t.Fatalf("key of wrong length transferred")
+	}
+	if err := c.TransferKeys(0, kek, []KeyData{{KeyId: KeyIdGlobalUnicast, Key: newek}, {KeyId: KeyIdAuthentication, Key: newak}}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.keys[KeyIdGlobalUnicast], newek) || !bytes.Equal(h.keys[KeyIdAuthentication], newak) {
+		t.Fatalf("meter received %x", h.keys)
+	}
+	if !bytes.Equal(cs.ekcopy, newek) || !bytes.Equal(cs.akcopy, newak) {
+		t.Fatalf("client keys not replaced")
+	}
+
+	// the meter switches to the new keys, so the association goes on only if the client did the same
+	if err := srv.al.replacekeys(h.keys[KeyIdGlobalUnicast], h.keys[KeyIdAuthentication]); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Get([]DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0].Value != uint8(5) {
+		t.Errorf("unexpected value %v", r[0])
+	}
+}
+
+func TestTransferKeysRefused(t *testing.T) {
+	h := &keytransferhandler{testhandler: newtesthandler(), kek: []byte("masterkey0123456"), keys: make(map[KeyId][]byte)}
+	ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	ss.MaxPduRecvSize = 1024
+	client, _, stop := startserver(t, ss, h)
+	defer stop()
+	cs := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+	c := New(client, cs)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	// wrapped by other kek, so the meter fails the integrity check
+	if err := c.TransferKeys(0, []byte("otherkey01234567"), []KeyData{{KeyId: KeyIdGlobalUnicast, Key: []byte("newunicastkey012")}}); err == nil {
+		t.Fatalf("refused key transfer succeeded")
+	}
+	if !bytes.Equal(cs.ekcopy, testek) {
+		t.Errorf("client keys replaced after refused transfer")
+	}
+}
@@ -0,0 +1,188 @@
+package dlmsal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
+	"go.uber.org/zap"
+)
+
+// unsolicited data-notification sent by the meter, ciphered pushes are already decrypted
+type DataNotification struct {
+	LongInvokeId uint32        // long-invoke-id-and-priority as received
+	DateTime     *DlmsDateTime // nil if not present
+	Body         DlmsData
+	SystemTitle  []byte       // system title of the sender, nil in case of not ciphered and not signed push
+	Security     DlmsSecurity // security applied to the push
+	FrameCounter uint32       // invocation counter of the ciphered push
+	Signed       bool         // push was sent in general-signing and its signature is verified
+}
+
+// decodes pushed apdus, ciphered ones (general-glo, general-ded and general ciphering) are decrypted
+// by the keys of the settings, system title of the sender is taken from the apdu itself,
+// signature of general-signing is verified by the certificate set by SetSigningKeys,
+// not ciphered pushes are refused if the security policy of the settings requires ciphering,
+// ReplayProtection of the settings is applied the same way as for responses
+type PushDecoder struct {
+	settings    *DlmsSettings
+	logger      *zap.SugaredLogger
+	tmpbuffer   tmpbuffer
+	cryptbuffer []byte
+}
+
+// settings can be nil in case of not ciphered pushes only, decoder is not safe for concurrent use
+func NewPushDecoder(settings *DlmsSettings) *PushDecoder {
+	return &PushDecoder{settings: settings}
+}
+
+// replays accepted by ReplayProtectionWarn are logged
+func (p *PushDecoder) SetLogger(logger *zap.SugaredLogger) {
+	p.logger = logger
+}
+
+func (p *PushDecoder) logf(format string, v ...any) {
+	if p.logger != nil {
+		p.logger.Infof(format, v...)
+	}
+}
+
+func (p *PushDecoder) Decode(apdu []byte) (*DataNotification, error) {
+	var n DataNotification
+	err := p.decode(apdu, &n, false)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (p *PushDecoder) decode(apdu []byte, n *DataNotification, ciphered bool) error {
+	if len(apdu) == 0 {
+		return fmt.Errorf("empty apdu")
+	}
+	src := bytes.NewBuffer(apdu[1:])
+	tag := CosemTag(apdu[0])
+	switch tag {
+	case TagDataNotification:
+		if !ciphered && p.settings != nil {
+			if err := p.settings.checksecurity(0); err != nil {
+				return err
+			}
+		}
+		return p.decodenotification(src, n)
+	case TagGeneralGloCiphering, TagGeneralDedCiphering, TagGeneralCiphering:
+		if ciphered {
+			return fmt.Errorf("nested ciphering is not supported")
+		}
+		gc, err := decodegeneralciphering(tag, src, &p.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		g, err := p.getgcm(&gc)
+		if err != nil {
+			return err
+		}
+		if z, ok := g.(zeroizer); ok && gc.agreement != KeyAgreementNone {
+			defer z.Zeroize()
+		}
+		plain, err := p.decrypt(g, &gc, n)
+		if err != nil {
+			return err
+		}
+		return p.decode(plain, n, true)
+	case TagGeneralSigning:
+		if ciphered || n.Signed {
+			return fmt.Errorf("signing inside ciphering or nested signing is not supported")
+		}
+		if p.settings == nil {
+			return fmt.Errorf("no settings for signed push")
+		}
+		content, originator, err := verifygeneralsigning(apdu, p.settings.peerkey, p.settings.systemtitle, &p.tmpbuffer)
+		if err != nil {
+			return err
+		}
+		n.Signed = true
+		n.SystemTitle = newcopy(originator)
+		return p.decode(content, n, false)
+	}
+	return fmt.Errorf("unexpected push tag: %02x", apdu[0])
+}
+
+func (p *PushDecoder) getgcm(gc *generalciphered) (gcm.Gcm, error) {
+	if p.settings == nil {
+		return nil, fmt.Errorf("no settings for ciphered push")
+	}
+	if gc.agreement != KeyAgreementNone {
+		return p.settings.recvagreedgcm(gc)
+	}
+	if gc.ded {
+		if p.settings.dedgcm == nil {
+			return nil, fmt.Errorf("no dedicated ciphering set")
+		}
+		return p.settings.dedgcm, nil
+	}
+	if p.settings.gcm == nil {
+		return nil, fmt.Errorf("no global ciphering set")
+	}
+	return p.settings.gcm, nil
+}
+
+func (p *PushDecoder) decrypt(g gcm.Gcm, gc *generalciphered, n *DataNotification) (ret []byte, err error) {
+	if err = p.settings.checksecurity(gc.content[0]); err != nil {
+		return nil, err
+	}
+	fc := binary.BigEndian.Uint32(gc.content[1:])
+	if err = p.checkreplay(gc.systitle, fc); err != nil {
+		return nil, err
+	}
+	p.cryptbuffer, err = g.DecryptWithAad(p.cryptbuffer, gc.content[0], fc, gc.systitle, gc.aad, gc.content[5:])
+	if err != nil {
+		return nil, err
+	}
+	p.settings.acceptframecounter(gc.systitle, fc)
+	n.SystemTitle = newcopy(gc.systitle)
+	n.Security = DlmsSecurity(gc.content[0] & 0x30)
+	n.FrameCounter = fc
+	return p.cryptbuffer, nil
+}
+
+// in case of warn policy, replay is logged and nil is returned
+func (p *PushDecoder) checkreplay(systitle []byte, fc uint32) error {
+	err := p.settings.checkreplay(systitle, fc)
+	if err != nil && p.settings.ReplayProtection == ReplayProtectionWarn {
+		p.logf("%v", err)
+		return nil
+	}
+	return err
+}
+
+func (p *PushDecoder) decodenotification(src io.Reader, n *DataNotification) error {
+	_, err := io.ReadFull(src, p.tmpbuffer[:4])
+	if err != nil {
+		return err
+	}
+	n.LongInvokeId = binary.BigEndian.Uint32(p.tmpbuffer[:])
+	l, _, err := decodelength(src, &p.tmpbuffer)
+	if err != nil {
+		return err
+	}
+	switch l {
+	case 0:
+	case 12:
+		_, err = io.ReadFull(src, p.tmpbuffer[:12])
+		if err != nil {
+			return err
+		}
+		dt, err := NewDlmsDateTimeFromSlice(p.tmpbuffer[:12])
+		if err != nil {
+			return err
+		}
+		n.DateTime = &dt
+	default:
+		return fmt.Errorf("invalid date-time length: %d", l)
+	}
+	n.Body, _, err = decodeDataTag(src, &p.tmpbuffer)
+	return err
+}
@@ -0,0 +1,124 @@
+package dlmsal
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testpushsystemtitle = []byte("METER001")
+
+// data-notification with long invoke id and unsigned body, without date-time
+func testnotification(body byte) []byte {
+	return []byte{byte(TagDataNotification), 0x40, 0, 0, 7, 0, byte(TagUnsigned), body}
+}
+
+// general-glo-ciphering of the apdu, sc and fc are the ciphering ones
+func testgeneralglo(t *testing.T, sc byte, fc uint32, apdu []byte) []byte {
+	t.Helper()
+	g, err := gcm.NewGCM(testek, testak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := g.Encrypt(nil, sc, fc, testpushsystemtitle, apdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := []byte{byte(TagGeneralGloCiphering), byte(len(testpushsystemtitle))}
+	ret = append(ret, testpushsystemtitle...)
+	ret = append(ret, byte(5+len(ct)), sc)
+	ret = binary.BigEndian.AppendUint32(ret, fc)
+	return append(ret, ct...)
+}
+
+func testpushsettings(t *testing.T, security DlmsSecurity, rp ReplayProtection) *DlmsSettings {
+	t.Helper()
+	s := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(security, testek, testak, 1))
+	s.ReplayProtection = rp
+	return s
+}
+
+func TestPushSecurityPolicy(t *testing.T) {
+	plain := testnotification(1)
+	authonly := testgeneralglo(t, byte(SecurityAuthentication), 5, testnotification(2))
+	tests := []struct {
+		name     string
+		settings func(t *testing.T) *DlmsSettings
+		apdu     []byte
+		ok       bool
+	}{
+		{"plain without settings", func(t *testing.T) *DlmsSettings { return nil }, plain, true},
+		{"plain with ciphering required", func(t *testing.T) *DlmsSettings {
+			return testpushsettings(t, SecurityAuthentication|SecurityEncryption, ReplayProtectionOff)
+		}, plain, false},
+		{"authenticated only with encryption required", func(t *testing.T) *DlmsSettings {
+			return testpushsettings(t, SecurityAuthentication|SecurityEncryption, ReplayProtectionOff)
+		}, authonly, false},
+		{"authenticated with authentication required", func(t *testing.T) *DlmsSettings {
+			return testpushsettings(t, SecurityAuthentication, ReplayProtectionOff)
+		}, authonly, true},
+		{"ciphered", func(t *testing.T) *DlmsSettings {
+			return testpushsettings(t, SecurityAuthentication|SecurityEncryption, ReplayProtectionOff)
+		}, testgeneralglo(t, byte(SecurityAuthentication|SecurityEncryption), 5, testnotification(3)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewPushDecoder(tt.settings(t)).Decode(tt.apdu)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("push accepted: %v", n.Body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.LongInvokeId != 0x40000007 || n.Body.Tag != TagUnsigned {
+				t.Errorf("unexpected notification %+v", n)
+			}
+		})
+	}
+}
+
+func TestPushReplayProtection(t *testing.T) {
+	sc := byte(SecurityAuthentication | SecurityEncryption)
+	tests := []struct {
+		name     string
+		rp       ReplayProtection
+		accepted int // of the three pushes with counters 10, 10 and 9
+		logged   int
+	}{
+		{"off", ReplayProtectionOff, 3, 0},
+		{"warn", ReplayProtectionWarn, 3, 2},
+		{"strict", ReplayProtectionStrict, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.InfoLevel)
+			p := NewPushDecoder(testpushsettings(t, DlmsSecurity(sc), tt.rp))
+			p.SetLogger(zap.New(core).Sugar())
+			accepted := 0
+			for _, fc := range []uint32{10, 10, 9} {
+				_, err := p.Decode(testgeneralglo(t, sc, fc, testnotification(byte(fc))))
+				if err == nil {
+					accepted++
+					continue
+				}
+				var re *ReplayError
+				if !errors.As(err, &re) || re.FrameCounter != fc || re.Last != 10 {
+					t.Errorf("unexpected error %v", err)
+				}
+			}
+			if accepted != tt.accepted {
+				t.Errorf("accepted %d pushes, expected %d", accepted, tt.accepted)
+			}
+			if logs.Len() != tt.logged {
+				t.Errorf("logged %d replays, expected %d", logs.Len(), tt.logged)
+			}
+		})
+	}
+}
@@ -34,6 +34,8 @@ const (
 	TagGloWriteRequest             CosemTag = 38
 	TagGloReadResponse             CosemTag = 44
 	TagGloWriteResponse            CosemTag = 45
+	TagGloUnconfirmedWriteRequest  CosemTag = 54
+	TagGloInformationReportRequest CosemTag = 56
 	TagGloGetRequest               CosemTag = 200
 	TagGloSetRequest               CosemTag = 201
 	TagGloEventNotificationRequest CosemTag = 202
@@ -46,6 +48,9 @@ const (
 	TagDedWriteRequest             CosemTag = 70
 	TagDedReadResponse             CosemTag = 76
 	TagDedWriteResponse            CosemTag = 77
+	TagDedConfirmedServiceError    CosemTag = 78
+	TagDedUnconfirmedWriteRequest  CosemTag = 86
+	TagDedInformationReportRequest CosemTag = 88
 	TagDedGetRequest               CosemTag = 208
 	TagDedSetRequest               CosemTag = 209
 	TagDedEventNotificationRequest CosemTag = 210
@@ -54,6 +59,13 @@ const (
 	TagDedSetResponse              CosemTag = 213
 	TagDedActionResponse           CosemTag = 215
 	TagExceptionResponse           CosemTag = 216
+	// --- general ciphered pdus
+	TagGeneralGloCiphering CosemTag = 219
+	TagGeneralDedCiphering CosemTag = 220
+	TagGeneralCiphering    CosemTag = 221
+	TagGeneralSigning      CosemTag = 223
+
+	TagGeneralBlockTransfer CosemTag = 224
 )
 
 type DlmsResultTag byte
@@ -134,6 +146,33 @@ const (
 	TagActionResponseNextPBlock actionResponseTag = 0x4
 )
 
+type variableAccessTag byte
+
+const (
+	TagVariableAccessName           variableAccessTag = 0x2
+	TagVariableAccessParameterized  variableAccessTag = 0x4
+	TagVariableAccessBlockNumber    variableAccessTag = 0x5 // next block of the response, number of the last received one
+	TagVariableAccessReadDataBlock  variableAccessTag = 0x6 // block of the long read request
+	TagVariableAccessWriteDataBlock variableAccessTag = 0x7 // block of the long write request
+)
+
+type readResponseTag byte
+
+const (
+	TagReadResponseData            readResponseTag = 0x0
+	TagReadResponseDataAccessError readResponseTag = 0x1
+	TagReadResponseDataBlockResult readResponseTag = 0x2
+	TagReadResponseBlockNumber     readResponseTag = 0x3 // acknowledged block of the long request
+)
+
+type writeResponseTag byte
+
+const (
+	TagWriteResponseSuccess         writeResponseTag = 0x0
+	TagWriteResponseDataAccessError writeResponseTag = 0x1
+	TagWriteResponseBlockNumber     writeResponseTag = 0x2 // acknowledged block of the long request
+)
+
 func (s DlmsResultTag) String() string {
 	switch s {
 	case TagResultSuccess:
@@ -0,0 +1,84 @@
+package dlmsal
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+type ReplayProtection byte
+
+const (
+	ReplayProtectionOff    ReplayProtection = 0 // received invocation counters are not checked
+	ReplayProtectionWarn   ReplayProtection = 1 // replayed apdu is only logged and accepted
+	ReplayProtectionStrict ReplayProtection = 2 // replayed apdu is refused with ReplayError
+)
+
+// received invocation counter is not greater than the last accepted one of the same system title
+type ReplayError struct {
+	SystemTitle  []byte
+	FrameCounter uint32 // received one
+	Last         uint32 // last accepted one
+}
+
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("replayed invocation counter %d of %x, last accepted is %d", e.FrameCounter, e.SystemTitle, e.Last)
+}
+
+// last accepted invocation counters of received apdus, key is hex encoded system title of the sender,
+// returned map is a copy, so it can be stored and set back by SetReceivedFrameCounters after reconnect
+func (d *DlmsSettings) ReceivedFrameCounters() map[string]uint32 {
+	ret := make(map[string]uint32, len(d.rxframecounters))
+	for k, v := range d.rxframecounters {
+		ret[hex.EncodeToString([]byte(k))] = v
+	}
+	return ret
+}
+
+func (d *DlmsSettings) SetReceivedFrameCounters(counters map[string]uint32) error {
+	m := make(map[string]uint32, len(counters))
+	for k, v := range counters {
+		st, err := hex.DecodeString(k)
+		if err != nil {
+			return fmt.Errorf("invalid system title %s: %w", k, err)
+		}
+		m[string(st)] = v
+	}
+	d.rxframecounters = m
+	return nil
+}
+
+// returns *ReplayError in case of replayed or decreasing counter, nil if the protection is off
+func (d *DlmsSettings) checkreplay(systitle []byte, fc uint32) error {
+	if d.ReplayProtection == ReplayProtectionOff {
+		return nil
+	}
+	last, ok := d.rxframecounters[string(systitle)]
+	if ok && fc <= last {
+		return &ReplayError{SystemTitle: newcopy(systitle), FrameCounter: fc, Last: last}
+	}
+	return nil
+}
+
+// called after successful authentication of the apdu, so forged counter cant block the valid ones
+func (d *DlmsSettings) acceptframecounter(systitle []byte, fc uint32) {
+	if d.ReplayProtection == ReplayProtectionOff {
+		return
+	}
+	if d.rxframecounters == nil {
+		d.rxframecounters = make(map[string]uint32)
+	}
+	last, ok := d.rxframecounters[string(systitle)]
+	if !ok || fc > last { // warn policy can accept lower one
+		d.rxframecounters[string(systitle)] = fc
+	}
+}
+
+// in case of warn policy, replay is logged and nil is returned
+func (d *dlmsal) checkreplay(systitle []byte, fc uint32) error {
+	err := d.settings.checkreplay(systitle, fc)
+	if err != nil && d.settings.ReplayProtection == ReplayProtectionWarn {
+		d.logf("%v", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package dlmsal
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// invoke id repeats every 8 requests, so the response to the 9th one can be replaced by the first one
+const replayedrequest = 9
+
+// the response to the replayed request is replaced by the first response of the association
+func replayfirstresponse() func([]byte) []byte {
+	var cnt int
+	var first []byte
+	return func(m []byte) []byte {
+		cnt++ // aare is the first message
+		switch cnt {
+		case 2:
+			first = m
+		case replayedrequest + 1:
+			return first
+		}
+		return m
+	}
+}
+
+func TestReplayProtection(t *testing.T) {
+	obis := DlmsObis{A: 0, B: 0, C: 1, D: 0, E: 0, F: 255}
+	tests := []struct {
+		name   string
+		rp     ReplayProtection
+		ok     bool
+		logged bool
+	}{
+		{"off", ReplayProtectionOff, true, false},
+		{"warn", ReplayProtectionWarn, true, true},
+		{"strict", ReplayProtectionStrict, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newtesthandler()
+			h.ln[obis] = DlmsData{Tag: TagDoubleLongUnsigned, Value: uint32(1)}
+			client, server := newtestpipe()
+			server.onsend = replayfirstresponse()
+			ss := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("SERVER01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+			_, stop := startserveron(t, client, server, ss, h)
+			defer stop()
+
+			cs := testsettings(t, NewSettingsBuilderLN().SystemTitle([]byte("CLIENT01")).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1))
+			cs.ReplayProtection = tt.rp
+			core, logs := observer.New(zap.InfoLevel)
+			c := New(client, cs)
+			c.SetLogger(zap.New(core).Sugar())
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			item := []DlmsLNRequestItem{{ClassId: 1, Obis: obis, Attribute: 2}}
+			for i := 1; i < replayedrequest; i++ {
+				if _, err := c.Get(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			h.mu.Lock()
+			h.ln[obis] = DlmsData{Tag: TagDoubleLongUnsigned, Value: uint32(2)}
+			h.mu.Unlock()
+			r, err := c.Get(item)
+			if !tt.ok {
+				var re *ReplayError
+				if !errors.As(err, &re) || string(re.SystemTitle) != "SERVER01" {
+					t.Errorf("expected replay error, got %v %v", r, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r[0].Value != uint32(1) {
+				t.Errorf("expected replayed value, got %v", r[0])
+			}
+			if logged := len(logs.FilterMessageSnippet("replayed invocation counter").All()) > 0; logged != tt.logged {
+				t.Errorf("replay logged: %v, expected %v", logged, tt.logged)
+			}
+		})
+	}
+}
+
+func TestReceivedFrameCountersRestored(t *testing.T) {
+	s := testsettings(t, NewSettingsBuilderLN())
+	s.ReplayProtection = ReplayProtectionStrict
+	st := []byte("SERVER01")
+	s.acceptframecounter(st, 10)
+	saved := s.ReceivedFrameCounters()
+	if saved["5345525645523031"] != 10 {
+		t.Fatalf("unexpected counters %v", saved)
+	}
+
+	r := testsettings(t, NewSettingsBuilderLN())
+	r.ReplayProtection = ReplayProtectionStrict
+	if err := r.SetReceivedFrameCounters(saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.checkreplay(st, 10); err == nil {
+		t.Errorf("replay after restore accepted")
+	}
+	if err := r.checkreplay(st, 11); err != nil {
+		t.Error(err)
+	}
+	if err := r.SetReceivedFrameCounters(map[string]uint32{"xx": 1}); err == nil {
+		t.Errorf("invalid system title accepted")
+	}
+}
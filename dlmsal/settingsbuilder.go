@@ -0,0 +1,223 @@
+package dlmsal
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/cybroslabs/libdlms-go/gcm"
+)
+
+// settings for any combination of referencing (LN/SN), authentication mechanism and security policy,
+// ciphered application context is used if Ciphering is set, errors are reported by Build
+type SettingsBuilder struct {
+	ln             bool
+	authentication Authentication
+	password       []byte // low password or own challenge
+	secret         []byte
+	signkey        *ecdsa.PrivateKey
+	peerkey        *ecdsa.PublicKey
+	systemtitle    []byte
+	ciphered       bool
+	security       DlmsSecurity
+	ek             []byte
+	ak             []byte
+	fc             uint32
+	keyprovider    KeyProvider
+	authenticator  Authenticator
+	serverst       []byte
+}
+
+func NewSettingsBuilderLN() *SettingsBuilder {
+	return &SettingsBuilder{ln: true}
+}
+
+func NewSettingsBuilderSN() *SettingsBuilder {
+	return &SettingsBuilder{ln: false}
+}
+
+func (b *SettingsBuilder) SystemTitle(systemtitle []byte) *SettingsBuilder {
+	b.systemtitle = newcopy(systemtitle)
+	return b
+}
+
+func (b *SettingsBuilder) LowAuthentication(password []byte) *SettingsBuilder {
+	b.authentication = AuthenticationLow
+	b.password = newcopy(password)
+	return b
+}
+
+// MD5, SHA-1 or SHA-256 mechanism, challenge is own challenge (CtoS)
+func (b *SettingsBuilder) HlsAuthentication(mechanism Authentication, secret []byte, challenge []byte) *SettingsBuilder {
+	b.authentication = mechanism
+	b.secret = newcopy(secret)
+	b.password = newcopy(challenge)
+	return b
+}
+
+// GMAC mechanism requires ciphering
+func (b *SettingsBuilder) GmacAuthentication(challenge []byte) *SettingsBuilder {
+	b.authentication = AuthenticationHighGmac
+	b.password = newcopy(challenge)
+	return b
+}
+
+func (b *SettingsBuilder) EcdsaAuthentication(challenge []byte, key *ecdsa.PrivateKey, serverkey *ecdsa.PublicKey) *SettingsBuilder {
+	b.authentication = AuthenticationHighEcdsa
+	b.password = newcopy(challenge)
+	b.signkey = key
+	b.peerkey = serverkey
+	return b
+}
+
+// custom mechanism, challenges and secrets are up to the authenticator, system title is checked only if it requires it
+func (b *SettingsBuilder) CustomAuthentication(a Authenticator) *SettingsBuilder {
+	b.authentication = a.Mechanism()
+	b.authenticator = a
+	return b
+}
+
+// security is the policy of ciphered apdus (authentication, encryption or both), ak is needed only for authentication,
+// fc is the first invocation counter
+func (b *SettingsBuilder) Ciphering(security DlmsSecurity, ek []byte, ak []byte, fc uint32) *SettingsBuilder {
+	b.ciphered = true
+	b.security = security
+	b.ek = newcopy(ek)
+	b.ak = nil
+	if len(ak) != 0 {
+		b.ak = newcopy(ak)
+	}
+	b.fc = fc
+	b.keyprovider = nil
+	return b
+}
+
+// same as Ciphering, but keys of the meter with serversystemtitle are resolved by the provider during Open,
+// security suite is not derived from the keys, so it has to be set by SetSecuritySuite if it is not suite 0
+func (b *SettingsBuilder) CipheringWithKeyProvider(security DlmsSecurity, provider KeyProvider, serversystemtitle []byte, fc uint32) *SettingsBuilder {
+	b.ciphered = true
+	b.security = security
+	b.ek = nil
+	b.ak = nil
+	b.keyprovider = provider
+	b.serverst = newcopy(serversystemtitle)
+	b.fc = fc
+	return b
+}
+
+func (b *SettingsBuilder) Build() (*DlmsSettings, error) {
+	ret := DlmsSettings{
+		authentication: b.authentication,
+		password:       b.password,
+		systemtitle:    b.systemtitle,
+	}
+	stneeded := b.ciphered
+	switch {
+	case b.authenticator != nil:
+		ret.authenticator = b.authenticator
+		stneeded = stneeded || b.authenticator.SystemTitleRequired()
+	case b.authentication == AuthenticationNone:
+	case b.authentication == AuthenticationLow:
+		if len(b.password) == 0 {
+			return nil, fmt.Errorf("password is empty")
+		}
+	case ishashhls(b.authentication):
+		if len(b.secret) == 0 {
+			return nil, fmt.Errorf("secret is empty")
+		}
+		if len(b.password) < 8 || len(b.password) > 64 {
+			return nil, fmt.Errorf("challenge has to be 8 to 64 bytes long")
+		}
+		ret.hlssecret = b.secret
+		stneeded = stneeded || b.authentication == AuthenticationHighSha256
+	case b.authentication == AuthenticationHighGmac:
+		if !b.ciphered {
+			return nil, fmt.Errorf("GMAC authentication requires ciphering")
+		}
+		if len(b.password) == 0 {
+			return nil, fmt.Errorf("challenge is empty")
+		}
+	case b.authentication == AuthenticationHighEcdsa:
+		if len(b.password) < 32 || len(b.password) > 64 {
+			return nil, fmt.Errorf("challenge has to be 32 to 64 bytes long")
+		}
+		if b.signkey == nil || b.peerkey == nil {
+			return nil, fmt.Errorf("both keys have to be set")
+		}
+		if _, _, err := ecdsaparams(b.signkey.Curve); err != nil {
+			return nil, err
+		}
+		if _, _, err := ecdsaparams(b.peerkey.Curve); err != nil {
+			return nil, err
+		}
+		ret.signkey = b.signkey
+		ret.peerkey = b.peerkey
+		stneeded = true
+	default:
+		return nil, fmt.Errorf("unsupported authentication mechanism: %v", b.authentication)
+	}
+	if stneeded && len(b.systemtitle) != 8 {
+		return nil, fmt.Errorf("systemtitle has to be 8 bytes long")
+	}
+	if b.authenticator == nil && b.authentication != AuthenticationNone && b.authentication != AuthenticationLow {
+		ret.CtoS = ret.password // just reference
+	}
+
+	if b.ciphered {
+		switch b.security {
+		case SecurityAuthentication, SecurityEncryption, SecurityAuthentication | SecurityEncryption:
+		default:
+			return nil, fmt.Errorf("unsupported security policy: %v", b.security)
+		}
+		ret.framecounter = b.fc
+		ret.Security = b.security
+		if b.keyprovider != nil {
+			if err := ret.SetKeyProvider(b.keyprovider, b.serverst); err != nil {
+				return nil, err
+			}
+		} else {
+			if (b.security&SecurityAuthentication != 0 || b.authentication == AuthenticationHighGmac) && len(b.ak) == 0 {
+				return nil, fmt.Errorf("authentication key is required")
+			}
+			g, err := gcm.NewGCM(b.ek, b.ak)
+			if err != nil {
+				return nil, err
+			}
+			ret.gcm = g
+			ret.ekcopy = b.ek
+			ret.akcopy = b.ak
+			suite := SecuritySuite0
+			if len(b.ek) == 32 {
+				suite = SecuritySuite2
+			}
+			if err = ret.SetSecuritySuite(suite); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if b.ln {
+		ret.applicationContext = ApplicationContextLNNoCiphering
+		if b.ciphered {
+			ret.applicationContext = ApplicationContextLNCiphering
+		}
+		ret.HighPriority = true
+		ret.ConfirmedRequests = true
+		ret.ConformanceBlock = ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
+			ConformanceBlockBlockTransferWithAction | ConformanceBlockAction | ConformanceBlockGet | ConformanceBlockSet |
+			ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences | ConformanceBlockAttribute0SupportedWithGet
+	} else {
+		ret.applicationContext = ApplicationContextSNNoCiphering
+		if b.ciphered {
+			ret.applicationContext = ApplicationContextSNCiphering
+		}
+		ret.ConformanceBlock = ConformanceBlockBlockTransferWithGetOrRead | ConformanceBlockBlockTransferWithSetOrWrite |
+			ConformanceBlockRead | ConformanceBlockWrite | ConformanceBlockUnconfirmedWrite | ConformanceBlockSelectiveAccess | ConformanceBlockMultipleReferences
+		if ret.CtoS != nil || b.authenticator != nil { // reply_to_HLS_authentication is invoked by parametrized access
+			ret.ConformanceBlock |= ConformanceBlockParametrizedAccess
+		}
+	}
+	if b.ciphered {
+		ret.ConformanceBlock |= ConformanceBlockGeneralProtection
+	}
+	return &ret, nil
+}
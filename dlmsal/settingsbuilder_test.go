@@ -0,0 +1,83 @@
+package dlmsal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestSettingsBuilderInvalid(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := []byte("CLIENT01")
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+	tests := []struct {
+		name    string
+		builder *SettingsBuilder
+		refused string // part of the error
+	}{
+		{"low without password", NewSettingsBuilderSN().LowAuthentication(nil), "password is empty"},
+		{"hls without secret", NewSettingsBuilderLN().HlsAuthentication(AuthenticationHighMD5, nil, challenge), "secret is empty"},
+		{"hls with short challenge", NewSettingsBuilderLN().HlsAuthentication(AuthenticationHighSHA1, []byte("secret"), []byte("short")), "8 to 64 bytes"},
+		{"sha256 without system title", NewSettingsBuilderLN().HlsAuthentication(AuthenticationHighSha256, []byte("secret"), challenge), "systemtitle"},
+		{"gmac without ciphering", NewSettingsBuilderLN().SystemTitle(st).GmacAuthentication(challenge), "requires ciphering"},
+		{"gmac without challenge", NewSettingsBuilderLN().SystemTitle(st).GmacAuthentication(nil).Ciphering(SecurityEncryption, testek, testak, 1), "challenge is empty"},
+		{"gmac without authentication key", NewSettingsBuilderLN().SystemTitle(st).GmacAuthentication(challenge).Ciphering(SecurityEncryption, testek, nil, 1), "authentication key"},
+		{"ecdsa with short challenge", NewSettingsBuilderLN().SystemTitle(st).EcdsaAuthentication(challenge[:16], p256, &p256.PublicKey), "32 to 64 bytes"},
+		{"ecdsa without server key", NewSettingsBuilderLN().SystemTitle(st).EcdsaAuthentication(challenge, p256, nil), "both keys"},
+		{"ecdsa with unsupported curve", NewSettingsBuilderLN().SystemTitle(st).EcdsaAuthentication(challenge, p224, &p256.PublicKey), "unsupported curve"},
+		{"ecdsa without system title", NewSettingsBuilderLN().EcdsaAuthentication(challenge, p256, &p256.PublicKey), "systemtitle"},
+		{"unsupported mechanism", NewSettingsBuilderLN().HlsAuthentication(AuthenticationHigh, []byte("secret"), challenge), "unsupported authentication"},
+		{"ciphering without system title", NewSettingsBuilderLN().Ciphering(SecurityEncryption, testek, testak, 1), "systemtitle"},
+		{"ciphering with short system title", NewSettingsBuilderLN().SystemTitle(st[:7]).Ciphering(SecurityEncryption, testek, testak, 1), "systemtitle"},
+		{"ciphering without security", NewSettingsBuilderLN().SystemTitle(st).Ciphering(SecurityNone, testek, testak, 1), "unsupported security policy"},
+		{"authenticated ciphering without authentication key", NewSettingsBuilderSN().SystemTitle(st).Ciphering(SecurityAuthentication, testek, nil, 1), "authentication key"},
+		{"ciphering with invalid key", NewSettingsBuilderLN().SystemTitle(st).Ciphering(SecurityEncryption, testek[:15], testak, 1), "16, 24 or 32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.builder.Build()
+			if err == nil || !strings.Contains(err.Error(), tt.refused) {
+				t.Errorf("expected error with %q, got %v %v", tt.refused, s, err)
+			}
+		})
+	}
+}
+
+func TestSettingsBuilderValid(t *testing.T) {
+	st := []byte("CLIENT01")
+	challenge := []byte("0123456789abcdef")
+	key32 := []byte("0123456789abcdef0123456789abcdef")
+	tests := []struct {
+		name        string
+		builder     *SettingsBuilder
+		context     ApplicationContext
+		suite       SecuritySuite
+		conformance uint32 // has to be set
+	}{
+		{"ln without authentication", NewSettingsBuilderLN(), ApplicationContextLNNoCiphering, SecuritySuite0, ConformanceBlockGet},
+		{"sn with low authentication", NewSettingsBuilderSN().LowAuthentication([]byte("12345678")), ApplicationContextSNNoCiphering, SecuritySuite0, ConformanceBlockRead},
+		{"sn with hls", NewSettingsBuilderSN().HlsAuthentication(AuthenticationHighMD5, []byte("secret"), challenge), ApplicationContextSNNoCiphering, SecuritySuite0, ConformanceBlockParametrizedAccess},
+		{"ln with gmac", NewSettingsBuilderLN().SystemTitle(st).GmacAuthentication(challenge).Ciphering(SecurityAuthentication|SecurityEncryption, testek, testak, 1), ApplicationContextLNCiphering, SecuritySuite0, ConformanceBlockGeneralProtection},
+		{"sn ciphered by suite 2", NewSettingsBuilderSN().SystemTitle(st).Ciphering(SecurityEncryption, key32, nil, 1), ApplicationContextSNCiphering, SecuritySuite2, ConformanceBlockGeneralProtection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.applicationContext != tt.context || s.SecuritySuite != tt.suite || s.ConformanceBlock&tt.conformance == 0 {
+				t.Errorf("unexpected settings %+v", s)
+			}
+		})
+	}
+}
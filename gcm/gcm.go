@@ -27,6 +27,10 @@ type Gcm interface { // add length to the streamer interface? add systitle to co
 	Decrypt2(ret []byte, scControl byte, scContent byte, fc uint32, systitle []byte, apdu []byte) ([]byte, error)
 	GetDecryptorStream(sc byte, fc uint32, systitle []byte, apdu io.Reader) (GcmDecryptorStream, error)
 	GetDecryptorStream2(scControl byte, scContent byte, fc uint32, systitle []byte, apdu io.Reader) (GcmDecryptorStream, error)
+	// aad is authenticated after SC and AK (fields of general ciphering), ret can be nil in case of not reused
+	EncryptWithAad(ret []byte, sc byte, fc uint32, systitle []byte, aad []byte, apdu []byte) ([]byte, error)
+	// aad is authenticated after SC and AK (fields of general ciphering), ret can be nil in case of not reused
+	DecryptWithAad(ret []byte, sc byte, fc uint32, systitle []byte, aad []byte, apdu []byte) ([]byte, error)
 }
 
 type gcm struct {
@@ -63,6 +67,16 @@ func NewGCM(ek []byte, ak []byte) (Gcm, error) {
 	return &g, nil
 }
 
+// clears authentication key and hash tables, expanded key inside the aes cipher cant be reached, so it is just dropped,
+// instance cant be used anymore
+func (g *gcm) Zeroize() {
+	clear(g.aadbuf[:])
+	clear(g.tmp[:])
+	clear(g.hl[:])
+	clear(g.hh[:])
+	g.aes = nil
+}
+
 // using first tmp slot, depends on zero initialized arrays
 func (g *gcm) make_tables() {
 	h := g.tmp[:AES_BLOCK_SIZE]
@@ -97,6 +111,28 @@ func (g *gcm) Decrypt(ret []byte, sc byte, fc uint32, systitle []byte, apdu []by
 }
 
 func (g *gcm) Decrypt2(ret []byte, scControl byte, scContent byte, fc uint32, systitle []byte, apdu []byte) ([]byte, error) {
+	return g.decrypt(ret, scControl, scContent, fc, systitle, nil, apdu)
+}
+
+func (g *gcm) DecryptWithAad(ret []byte, sc byte, fc uint32, systitle []byte, aad []byte, apdu []byte) ([]byte, error) {
+	return g.decrypt(ret, sc, sc, fc, systitle, aad, apdu)
+}
+
+// returns sc, ak and extra aad, internal aad buffer is used if there is no extra one
+func (g *gcm) getaad(sc byte, extra []byte, apdu []byte) []byte {
+	if len(extra) == 0 && len(apdu) == 0 {
+		g.aad[0] = sc
+		return g.aad
+	}
+	aad := make([]byte, 1+len(g.ak)+len(extra)+len(apdu))
+	aad[0] = sc
+	copy(aad[1:], g.ak)
+	copy(aad[1+len(g.ak):], extra)
+	copy(aad[1+len(g.ak)+len(extra):], apdu)
+	return aad
+}
+
+func (g *gcm) decrypt(ret []byte, scControl byte, scContent byte, fc uint32, systitle []byte, extra []byte, apdu []byte) ([]byte, error) {
 	if len(systitle) != 8 {
 		return nil, fmt.Errorf("systitle has to be 8 bytes long")
 	}
@@ -120,11 +156,7 @@ func (g *gcm) Decrypt2(ret []byte, scControl byte, scContent byte, fc uint32, sy
 			if len(apdu) < GCM_TAG_LENGTH {
 				return nil, fmt.Errorf("too short ciphered data, no space for tag")
 			}
-			aad := make([]byte, 1+len(g.ak)+len(apdu)-GCM_TAG_LENGTH)
-			aad[0] = scContent
-			copy(aad[1:], g.ak)
-			copy(aad[1+len(g.ak):], apdu[:len(apdu)-GCM_TAG_LENGTH])
-
+			aad := g.getaad(scContent, extra, apdu[:len(apdu)-GCM_TAG_LENGTH])
 			err := g.aes_gcm_ad(nil, aad, nil, apdu[len(apdu)-GCM_TAG_LENGTH:])
 			if err != nil {
 				return nil, err
@@ -154,14 +186,14 @@ func (g *gcm) Decrypt2(ret []byte, scControl byte, scContent byte, fc uint32, sy
 			if len(apdu) < GCM_TAG_LENGTH {
 				return nil, fmt.Errorf("too short ciphered data, no space for tag")
 			}
-			g.aad[0] = scContent
+			aad := g.getaad(scContent, extra, nil)
 			wl := len(apdu) - GCM_TAG_LENGTH
 			if ret != nil && cap(ret) >= wl {
 				ret = ret[:wl]
 			} else {
 				ret = make([]byte, wl)
 			}
-			err := g.aes_gcm_ad(apdu[:len(apdu)-GCM_TAG_LENGTH], g.aad, ret, apdu[len(apdu)-GCM_TAG_LENGTH:])
+			err := g.aes_gcm_ad(apdu[:len(apdu)-GCM_TAG_LENGTH], aad, ret, apdu[len(apdu)-GCM_TAG_LENGTH:])
 			return ret, err
 		}
 	}
@@ -206,6 +238,14 @@ func (g *gcm) Encrypt(ret []byte, sc byte, fc uint32, systitle []byte, apdu []by
 }
 
 func (g *gcm) Encrypt2(ret []byte, scControl byte, scContent byte, fc uint32, systitle []byte, apdu []byte) ([]byte, error) {
+	return g.encrypt(ret, scControl, scContent, fc, systitle, nil, apdu)
+}
+
+func (g *gcm) EncryptWithAad(ret []byte, sc byte, fc uint32, systitle []byte, aad []byte, apdu []byte) ([]byte, error) {
+	return g.encrypt(ret, sc, sc, fc, systitle, aad, apdu)
+}
+
+func (g *gcm) encrypt(ret []byte, scControl byte, scContent byte, fc uint32, systitle []byte, extra []byte, apdu []byte) ([]byte, error) {
 	if len(systitle) != 8 {
 		return nil, fmt.Errorf("systitle has to be 8 bytes long")
 	}
@@ -230,11 +270,7 @@ func (g *gcm) Encrypt2(ret []byte, scControl byte, scContent byte, fc uint32, sy
 	switch scControl & 0xf0 {
 	case 0x10:
 		{
-			aad := make([]byte, 1+len(g.ak)+len(apdu))
-			aad[0] = scContent
-			copy(aad[1:], g.ak)
-			copy(aad[1+len(g.ak):], apdu)
-
+			aad := g.getaad(scContent, extra, apdu)
 			if cap(ret) >= wl {
 				ret = ret[:wl]
 			} else {
@@ -256,13 +292,13 @@ func (g *gcm) Encrypt2(ret []byte, scControl byte, scContent byte, fc uint32, sy
 		}
 	case 0x30:
 		{
-			g.aad[0] = scContent
+			aad := g.getaad(scContent, extra, nil)
 			if cap(ret) >= wl {
 				ret = ret[:wl]
 			} else {
 				ret = make([]byte, wl)
 			}
-			g.aes_gcm_ae(apdu, g.aad, ret[:len(apdu)], ret[len(apdu):])
+			g.aes_gcm_ae(apdu, aad, ret[:len(apdu)], ret[len(apdu):])
 			return ret, nil
 		}
 	}
@@ -0,0 +1,68 @@
+package gcm
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+)
+
+// default initial value of RFC 3394
+var keywrapiv = [...]byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// RFC 3394 AES key wrap, kek is 16, 24 or 32 bytes long, key has to be multiple of 8 bytes, at least 16,
+// returned wrapped key is 8 bytes longer
+func KeyWrap(kek []byte, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, fmt.Errorf("key has to be multiple of 8 bytes, at least 16 bytes long")
+	}
+	c, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(key) >> 3
+	ret := make([]byte, 8+len(key))
+	copy(ret[8:], key)
+	var b [AES_BLOCK_SIZE]byte
+	copy(b[:8], keywrapiv[:])
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			r := ret[i<<3 : (i+1)<<3]
+			copy(b[8:], r)
+			c.Encrypt(b[:], b[:])
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(b[:8])^uint64(n*j+i))
+			copy(r, b[8:])
+		}
+	}
+	copy(ret[:8], b[:8])
+	return ret, nil
+}
+
+// RFC 3394 AES key unwrap, integrity of the unwrapped key is checked
+func KeyUnwrap(kek []byte, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("wrapped key has to be multiple of 8 bytes, at least 24 bytes long")
+	}
+	c, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := (len(wrapped) >> 3) - 1
+	ret := make([]byte, len(wrapped)-8)
+	copy(ret, wrapped[8:])
+	var b [AES_BLOCK_SIZE]byte
+	copy(b[:8], wrapped[:8])
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			r := ret[(i-1)<<3 : i<<3]
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(b[:8])^uint64(n*j+i))
+			copy(b[8:], r)
+			c.Decrypt(b[:], b[:])
+			copy(r, b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(b[:8], keywrapiv[:]) != 1 {
+		return nil, fmt.Errorf("key unwrap integrity check failed")
+	}
+	return ret, nil
+}
@@ -0,0 +1,65 @@
+package gcm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKeyWrap(t *testing.T) {
+	// RFC 3394 section 4
+	tests := []struct {
+		name    string
+		kek     string
+		key     string
+		wrapped string
+	}{
+		{"128 bit key with 128 bit kek", "000102030405060708090A0B0C0D0E0F", "00112233445566778899AABBCCDDEEFF", "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5"},
+		{"128 bit key with 192 bit kek", "000102030405060708090A0B0C0D0E0F1011121314151617", "00112233445566778899AABBCCDDEEFF", "96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D"},
+		{"128 bit key with 256 bit kek", "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF", "64E8C3F9CE0F5BA263E9777905818A2A93C8191E7D6E8AE7"},
+		{"192 bit key with 192 bit kek", "000102030405060708090A0B0C0D0E0F1011121314151617", "00112233445566778899AABBCCDDEEFF0001020304050607", "031D33264E15D33268F24EC260743EDCE1C6C7DDEE725A936BA814915C6762D2"},
+		{"192 bit key with 256 bit kek", "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF0001020304050607", "A8F9BC1612C68B3FF6E6F4FBE30E71E4769C8B80A32CB8958CD5D17D6B254DA1"},
+		{"256 bit key with 256 bit kek", "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F", "28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kek, _ := hex.DecodeString(tt.kek)
+			key, _ := hex.DecodeString(tt.key)
+			exp, _ := hex.DecodeString(tt.wrapped)
+			w, err := KeyWrap(kek, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w, exp) {
+				t.Fatalf("wrapped %x, expected %x", w, exp)
+			}
+			u, err := KeyUnwrap(kek, w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(u, key) {
+				t.Errorf("unwrapped %x, expected %x", u, key)
+			}
+			w[len(w)-1] ^= 1
+			if _, err = KeyUnwrap(kek, w); err == nil {
+				t.Errorf("damaged wrapped key unwrapped")
+			}
+		})
+	}
+}
+
+func TestKeyWrapInvalidLength(t *testing.T) {
+	kek := make([]byte, 16)
+	if _, err := KeyWrap(kek, make([]byte, 8)); err == nil {
+		t.Errorf("too short key wrapped")
+	}
+	if _, err := KeyWrap(kek, make([]byte, 20)); err == nil {
+		t.Errorf("key of wrong length wrapped")
+	}
+	if _, err := KeyWrap(make([]byte, 15), make([]byte, 16)); err == nil {
+		t.Errorf("key wrapped by invalid kek")
+	}
+	if _, err := KeyUnwrap(kek, make([]byte, 16)); err == nil {
+		t.Errorf("too short wrapped key unwrapped")
+	}
+}
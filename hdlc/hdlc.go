@@ -119,24 +119,9 @@ func (w *maclayer) Close() error {
 		if err != nil {
 			return err
 		}
-		cnt := w.settings.Retransmits
-		for {
-			err = w.processRRresp()
-			if err == nil {
-				break
-			}
-			if errors.Is(err, base.ErrCommunicationTimeout) {
-				if cnt <= 0 {
-					return err
-				}
-				cnt--
-			} else {
-				return err
-			}
-			err = w.retransmit()
-			if err != nil {
-				return err
-			}
+		err = w.waitRR()
+		if err != nil {
+			return err
 		}
 	}
 
@@ -166,7 +151,7 @@ func (w *maclayer) Open() error {
 		return err
 	}
 
-	w.addrlen = w.getaddresslength()
+	w.addrlen = getaddresslength(&w.settings)
 	// snrm here, always negotiate for now
 	p := w.recvbuffer[:0]
 	if w.settings.DontNegotiate {
@@ -450,12 +435,51 @@ func (w *maclayer) writeout() error {
 	}
 	err := w.writepacket(macpacket{control: w.nextcontrol(), segmented: false}, true)
 	if err != nil {
-		return nil
+		return err
 	}
 	w.toreadout = true
 	return nil
 }
 
+// waits for RR of the last sent frame, the frame is retransmitted in case of timeout
+func (w *maclayer) waitRR() error {
+	cnt := w.settings.Retransmits
+	for {
+		err := w.processRRresp()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, base.ErrCommunicationTimeout) {
+			if cnt <= 0 {
+				return err
+			}
+			cnt--
+		} else {
+			return err
+		}
+		err = w.retransmit()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sends written data as the last frame of the message and waits only for its RR, not for any answer,
+// so the next message (e.g. after unconfirmed write or within general block transfer window) can be written right away
+func (w *maclayer) Flush() error {
+	if !w.isopen {
+		return base.ErrNotOpened
+	}
+	if w.writeoffset == 0 {
+		return nil
+	}
+	err := w.writepacket(macpacket{control: w.nextcontrol(), segmented: false}, true)
+	if err != nil {
+		return err
+	}
+	return w.waitRR()
+}
+
 func (w *maclayer) Write(src []byte) error {
 	if !w.isopen {
 		return base.ErrNotOpened
@@ -472,7 +496,7 @@ func (w *maclayer) Write(src []byte) error {
 	for len(src) > 0 {
 		l := len(src)
 		s := false
-		if l > int(w.settings.MaxSnd)+w.writeoffset {
+		if l+w.writeoffset > int(w.settings.MaxSnd) {
 			l = int(w.settings.MaxSnd) - w.writeoffset
 			s = true
 		}
@@ -483,25 +507,10 @@ func (w *maclayer) Write(src []byte) error {
 			if err != nil {
 				return err
 			}
-			cnt := w.settings.Retransmits
-			for {
-				// expecting RR after final bit but during segmented transfer
-				err = w.processRRresp()
-				if err == nil {
-					break
-				}
-				if errors.Is(err, base.ErrCommunicationTimeout) {
-					if cnt <= 0 {
-						return err
-					}
-					cnt--
-				} else {
-					return err
-				}
-				err = w.retransmit()
-				if err != nil {
-					return err
-				}
+			// expecting RR after final bit but during segmented transfer
+			err = w.waitRR()
+			if err != nil {
+				return err
 			}
 		}
 		src = src[l:]
@@ -804,12 +813,12 @@ func (w *maclayer) parsepacket(ori []byte) (pck macpacket, err error) {
 	return pck, nil
 }
 
-func (w *maclayer) getaddresslength() int {
-	if w.settings.Logical <= 0x7f {
-		if w.settings.Physical == 0 {
+func getaddresslength(settings *Settings) int {
+	if settings.Logical <= 0x7f {
+		if settings.Physical == 0 {
 			return 1
 		} else {
-			if w.settings.Physical <= 0x7f {
+			if settings.Physical <= 0x7f {
 				return 2
 			}
 		}
@@ -0,0 +1,104 @@
+package hdlc
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"github.com/cybroslabs/libdlms-go/llc"
+	"github.com/cybroslabs/libdlms-go/tcp"
+)
+
+// records everything written to the underlying stream
+type capture struct {
+	base.Stream
+	written bytes.Buffer
+}
+
+func (c *capture) Write(src []byte) error {
+	c.written.Write(src)
+	return c.Stream.Write(src)
+}
+
+// information field lengths of the captured I frames
+func infolengths(t *testing.T, b []byte, addrlen int) []int {
+	t.Helper()
+	var ret []int
+	for len(b) > 0 {
+		if b[0] == 0x7e {
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || b[0]&0xf0 != 0xa0 {
+			t.Fatalf("invalid frame format: %x", b)
+		}
+		l := (int(b[0]&7) << 8) | int(b[1])
+		if l > len(b) {
+			t.Fatalf("truncated frame")
+		}
+		if l > 2+addrlen+1+1+2 && b[2+addrlen+1]&1 == 0 { // I frame with information field
+			ret = append(ret, l-2-addrlen-1-1-2-2)
+		}
+		b = b[l:]
+	}
+	return ret
+}
+
+func TestWriteSegmentsBySendSize(t *testing.T) {
+	settings := Settings{Logical: 1, Physical: 0x10, Client: 0x10, MaxRcv: 128, MaxSnd: 128}
+	cc, sc := net.Pipe()
+	go func() { // echo server
+		h, err := NewServer(tcp.NewFromConn(sc, 5*time.Second), &settings)
+		if err != nil {
+			return
+		}
+		s := llc.NewServer(h)
+		defer s.Disconnect()
+		for {
+			b, err := io.ReadAll(s)
+			if err != nil || len(b) == 0 {
+				return
+			}
+			if s.Write(b) != nil {
+				return
+			}
+		}
+	}()
+
+	c := &capture{Stream: tcp.NewFromConn(cc, 5*time.Second)}
+	h, err := New(c, &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := llc.New(h)
+	if err = l.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Disconnect()
+
+	for _, n := range []int{120, 124, 125, 126, 127, 128, 129, 131, 140, 300} {
+		apdu := make([]byte, n)
+		for i := range apdu {
+			apdu[i] = byte(i + n)
+		}
+		c.written.Reset()
+		if err = l.Write(apdu); err != nil {
+			t.Fatal(err)
+		}
+		r, err := io.ReadAll(l)
+		if err != nil {
+			t.Fatalf("apdu of %d bytes: %v", n, err)
+		}
+		if !bytes.Equal(r, apdu) {
+			t.Fatalf("apdu of %d bytes echoed as %d bytes", n, len(r))
+		}
+		for _, il := range infolengths(t, c.written.Bytes(), 2) {
+			if il > int(settings.MaxSnd) {
+				t.Errorf("apdu of %d bytes sent in frame with %d bytes of information", n, il)
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package hdlc
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"go.uber.org/zap"
+)
+
+// receiving side of unsolicited UI frames (pushes) sent by the server to the client address, nothing is sent back
+type pushreceiver struct {
+	transport  base.Stream
+	logger     *zap.SugaredLogger
+	recvbuffer [maxLength]byte
+	flagged    bool
+	rx         []byte // reassembled information field of the current push
+	rxoffset   int
+	reading    bool
+
+	settings Settings
+}
+
+// settings.Client is the address the pushes are sent to, Logical and Physical are the accepted server
+// addresses, zero Logical means any server
+func NewPushReceiver(transport base.Stream, settings *Settings) (base.Stream, error) {
+	if settings.Logical > 0x3fff {
+		return nil, fmt.Errorf("invalid logical address")
+	}
+	if settings.Physical > 0x3fff {
+		return nil, fmt.Errorf("invalid physical address")
+	}
+	if settings.Client > 0x7f {
+		return nil, fmt.Errorf("invalid client address")
+	}
+	return &pushreceiver{
+		transport: transport,
+		settings:  *settings,
+	}, nil
+}
+
+func (r *pushreceiver) logf(format string, v ...any) {
+	if r.logger != nil {
+		r.logger.Infof(format, v...)
+	}
+}
+
+func (r *pushreceiver) Open() error {
+	return r.transport.Open()
+}
+
+func (r *pushreceiver) Close() error {
+	return r.transport.Close()
+}
+
+func (r *pushreceiver) Disconnect() error {
+	return r.transport.Disconnect()
+}
+
+// returns information field of the received push, io.EOF at its end
+func (r *pushreceiver) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, base.ErrNothingToRead
+	}
+	if !r.reading {
+		err = r.receive()
+		if err != nil {
+			return 0, err
+		}
+		r.reading = true
+	}
+	if r.rxoffset >= len(r.rx) {
+		r.reading = false
+		return 0, io.EOF
+	}
+	n = copy(p, r.rx[r.rxoffset:])
+	r.rxoffset += n
+	return n, nil
+}
+
+func (r *pushreceiver) Write(src []byte) error {
+	return fmt.Errorf("push receiver is not able to send anything")
+}
+
+// receives UI frames till the whole push is received, segmented pushes are reassembled
+func (r *pushreceiver) receive() error {
+	r.rx = r.rx[:0]
+	r.rxoffset = 0
+	for {
+		ori, err := readrawframe(r.transport, &r.recvbuffer, &r.flagged)
+		if err != nil {
+			return err
+		}
+		pck, ours, err := r.parseframe(ori)
+		if err != nil {
+			return err
+		}
+		if !ours {
+			continue
+		}
+		if pck.control&0xef != 3 {
+			r.logf("received frame %x, only UI expected, discarding", pck.control)
+			continue
+		}
+		if len(r.rx)+len(pck.info) > maxBody {
+			return fmt.Errorf("too long push received")
+		}
+		r.rx = append(r.rx, pck.info...)
+		if !pck.segmented && len(r.rx) > 0 {
+			return nil
+		}
+	}
+}
+
+// client address first, then variable length server address
+func (r *pushreceiver) parseframe(ori []byte) (pck macpacket, ours bool, err error) {
+	if len(ori) < 4 {
+		return pck, false, fmt.Errorf("too short packet")
+	}
+	if ori[2]&1 == 0 {
+		return pck, false, fmt.Errorf("invalid ending bit of client address")
+	}
+	client := ori[2] >> 1
+	offset := 3
+	var addr [4]byte
+	al := 0
+	for {
+		if offset >= len(ori) || al >= len(addr) {
+			return pck, false, fmt.Errorf("invalid address field")
+		}
+		addr[al] = ori[offset] >> 1
+		al++
+		offset++
+		if ori[offset-1]&1 != 0 {
+			break
+		}
+	}
+	var log, phy uint16
+	switch al {
+	case 1:
+		log = uint16(addr[0])
+	case 2:
+		log = uint16(addr[0])
+		phy = uint16(addr[1])
+	case 4:
+		log = uint16(addr[0])<<7 | uint16(addr[1])
+		phy = uint16(addr[2])<<7 | uint16(addr[3])
+	default:
+		return pck, false, fmt.Errorf("invalid address length")
+	}
+	if len(ori) < offset+3 {
+		return pck, false, fmt.Errorf("too short packet")
+	}
+
+	if client != r.settings.Client {
+		r.logf("skipping frame for client %d", client)
+		return pck, false, nil
+	}
+	if r.settings.Logical != 0 && (log != r.settings.Logical || phy != r.settings.Physical) {
+		r.logf("skipping frame from logical %d physical %d", log, phy)
+		return pck, false, nil
+	}
+
+	pck.segmented = ori[0]&8 != 0
+	pck.control = ori[offset]
+	rem := len(ori) - offset
+	switch {
+	case rem == 3:
+		fcs := mac_crc16(ori[:len(ori)-2])
+		if fcs != uint16(ori[len(ori)-2])|(uint16(ori[len(ori)-1])<<8) {
+			return pck, false, fmt.Errorf("fcs mismatch")
+		}
+	case rem <= 5:
+		return pck, false, fmt.Errorf("invalid packet length")
+	default:
+		hcs, fcs := mac_crc16_r(ori[:len(ori)-2], offset+1)
+		if hcs != uint16(ori[offset+1])|(uint16(ori[offset+2])<<8) {
+			return pck, false, fmt.Errorf("hcs mismatch")
+		}
+		if fcs != uint16(ori[len(ori)-2])|(uint16(ori[len(ori)-1])<<8) {
+			return pck, false, fmt.Errorf("fcs mismatch")
+		}
+		pck.info = ori[offset+3 : len(ori)-2]
+	}
+	return pck, true, nil
+}
+
+func (r *pushreceiver) SetMaxReceivedBytes(m int64) {
+	r.transport.SetMaxReceivedBytes(m)
+}
+
+func (r *pushreceiver) SetTimeout(t time.Duration) {
+	r.transport.SetTimeout(t)
+}
+
+func (r *pushreceiver) SetDeadline(t time.Time) {
+	r.transport.SetDeadline(t)
+}
+
+func (r *pushreceiver) SetLogger(logger *zap.SugaredLogger) {
+	r.logger = logger
+	r.transport.SetLogger(logger)
+}
+
+func (r *pushreceiver) GetRxTxBytes() (int64, int64) {
+	return r.transport.GetRxTxBytes()
+}
@@ -0,0 +1,124 @@
+package hdlc
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"github.com/cybroslabs/libdlms-go/tcp"
+)
+
+// UI frame sent by the server with 2 byte address to the client
+func uiframe(client byte, logical byte, physical byte, info []byte, segmented bool) []byte {
+	l := 2 + 1 + 2 + 1 + 2 + len(info) + 2
+	f := []byte{0xa0 | byte(l>>8), byte(l), client<<1 | 1, logical << 1, physical<<1 | 1, 0x13}
+	if segmented {
+		f[0] |= 8
+	}
+	hcs := mac_crc16(f)
+	f = append(f, byte(hcs), byte(hcs>>8))
+	f = append(f, info...)
+	fcs := mac_crc16(f)
+	f = append(f, byte(fcs), byte(fcs>>8))
+	return append(append([]byte{0x7e}, f...), 0x7e)
+}
+
+// push receiver reading frames written to the other end of the pipe, the pipe is closed after them
+func startpushreceiver(t *testing.T, settings *Settings, frames ...[]byte) base.Stream {
+	t.Helper()
+	cc, sc := net.Pipe()
+	go func() {
+		defer sc.Close()
+		for _, f := range frames {
+			if _, err := sc.Write(f); err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { cc.Close() })
+	r, err := NewPushReceiver(tcp.NewFromConn(cc, 5*time.Second), settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestPushReceiver(t *testing.T) {
+	settings := Settings{Logical: 1, Physical: 0x10, Client: 0x66}
+	first := []byte{0xe6, 0xe7, 0x00, 0x0f, 1, 2, 3, 4}
+	second := bytes.Repeat([]byte{0x5a}, 300)
+	r := startpushreceiver(t, &settings,
+		uiframe(0x66, 1, 0x10, first, false),
+		uiframe(0x10, 1, 0x10, []byte{1, 2, 3}, false), // push for another client
+		uiframe(0x66, 1, 0x10, second[:100], true),
+		uiframe(0x66, 2, 0x10, []byte{1, 2, 3}, false), // another server in the middle of the segmented push
+		uiframe(0x66, 1, 0x10, second[100:200], true),
+		uiframe(0x66, 1, 0x10, second[200:], false),
+	)
+	for _, exp := range [][]byte{first, second} {
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, exp) {
+			t.Errorf("unexpected push %x", got)
+		}
+	}
+	if got, err := io.ReadAll(r); err != nil || len(got) != 0 { // end of the stream, like push.Serve expects
+		t.Errorf("unexpected push after the last one %x, %v", got, err)
+	}
+}
+
+func TestPushReceiverAnyServer(t *testing.T) {
+	r := startpushreceiver(t, &Settings{Client: 0x66},
+		uiframe(0x66, 2, 0x11, []byte{1}, false),
+		uiframe(0x66, 3, 0x12, []byte{2}, false),
+	)
+	for _, exp := range []byte{1, 2} {
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, []byte{exp}) {
+			t.Errorf("unexpected push %x", got)
+		}
+	}
+}
+
+func TestPushReceiverInvalidFrames(t *testing.T) {
+	valid := uiframe(0x66, 1, 0x10, []byte{1, 2, 3}, false)
+	fcs := bytes.Clone(valid)
+	fcs[len(fcs)-2]++
+	hcs := bytes.Clone(valid)
+	hcs[8]++
+	tests := []struct {
+		name  string
+		frame []byte
+		err   string
+	}{
+		{"fcs", fcs, "fcs mismatch"},
+		{"hcs", hcs, "hcs mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := startpushreceiver(t, &Settings{Logical: 1, Physical: 0x10, Client: 0x66}, tt.frame)
+			_, err := io.ReadAll(r)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected %s, got %v", tt.err, err)
+			}
+		})
+	}
+
+	_, err := NewPushReceiver(nil, &Settings{Client: 0x80})
+	if err == nil {
+		t.Errorf("invalid client address accepted")
+	}
+	r := startpushreceiver(t, &Settings{Client: 0x66})
+	if err = r.Write([]byte{1}); err == nil {
+		t.Errorf("push receiver sent data")
+	}
+}
@@ -0,0 +1,507 @@
+package hdlc
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"go.uber.org/zap"
+)
+
+// secondary station, server side of the mac layer, window size is always 1
+type secondary struct {
+	transport  base.Stream
+	logger     *zap.SugaredLogger
+	recvbuffer [maxLength]byte
+	sendbuffer [maxLength + 16]byte
+	flagged    bool // closing flag of the last frame can be the opening one of the next frame
+	isopen     bool
+	controlS   byte
+	controlR   byte
+	client     byte // address of the connected client
+	addrlen    int
+	rx         []byte // reassembled information field of the current request
+	rxoffset   int
+	reading    bool
+	tx         []byte // pending response
+	unanswered bool   // last request got no response (unconfirmed service or gbt streaming), RR is sent before reading the next one
+	maxrcv     uint
+	maxsnd     uint
+
+	settings Settings
+}
+
+// settings.Client is the only accepted client address, 0 means any client,
+// MaxRcv and MaxSnd are upper limits for negotiation with the client
+func NewServer(transport base.Stream, settings *Settings) (base.Stream, error) {
+	if settings.Logical > 0x3fff {
+		return nil, fmt.Errorf("invalid logical address")
+	}
+	if settings.Physical > 0x3fff {
+		return nil, fmt.Errorf("invalid physical address")
+	}
+	if settings.Client > 0x7f {
+		return nil, fmt.Errorf("invalid client address")
+	}
+	s := &secondary{
+		transport: transport,
+		settings:  *settings,
+	}
+	if s.settings.MaxRcv > initpacketlength {
+		s.settings.MaxRcv = initpacketlength
+	} else if s.settings.MaxRcv < 128 {
+		s.settings.MaxRcv = 128
+	}
+	if s.settings.MaxSnd > initpacketlength {
+		s.settings.MaxSnd = initpacketlength
+	} else if s.settings.MaxSnd < 128 {
+		s.settings.MaxSnd = 128
+	}
+	s.addrlen = getaddresslength(&s.settings)
+	return s, nil
+}
+
+func (s *secondary) logf(format string, v ...any) {
+	if s.logger != nil {
+		s.logger.Infof(format, v...)
+	}
+}
+
+func (s *secondary) Open() error {
+	return s.transport.Open()
+}
+
+func (s *secondary) Close() error {
+	s.isopen = false
+	return s.transport.Close()
+}
+
+func (s *secondary) Disconnect() error {
+	s.isopen = false
+	return s.transport.Disconnect()
+}
+
+// returns information field of the received request, io.EOF at its end or in case of disconnect
+func (s *secondary) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, base.ErrNothingToRead
+	}
+	if len(s.tx) > 0 {
+		err = s.flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !s.reading {
+		if s.unanswered { // client waits at least for RR of its final frame
+			s.unanswered = false
+			err = s.writeframe((s.controlR<<5)|1, nil, false)
+			if err != nil {
+				return 0, err
+			}
+		}
+		err = s.receive()
+		if err != nil {
+			return 0, err
+		}
+		s.reading = true
+	}
+	if s.rxoffset >= len(s.rx) {
+		s.reading = false
+		return 0, io.EOF
+	}
+	n = copy(p, s.rx[s.rxoffset:])
+	s.rxoffset += n
+	return n, nil
+}
+
+// buffers the response, it is sent with the next read
+func (s *secondary) Write(src []byte) error {
+	if !s.isopen {
+		return base.ErrNotOpened
+	}
+	s.reading = false
+	s.tx = append(s.tx, src...)
+	return nil
+}
+
+func (s *secondary) nextcontrol() byte {
+	r := (s.controlR << 5) | (s.controlS << 1)
+	s.controlS = (s.controlS + 1) & 7
+	return r
+}
+
+// send pending response, segmented according to the negotiated size, waiting for RR after each segment
+func (s *secondary) flush() error {
+	data := s.tx
+	s.tx = s.tx[:0]
+	s.unanswered = false
+	for {
+		l := len(data)
+		seg := false
+		if l > int(s.maxsnd) {
+			l = int(s.maxsnd)
+			seg = true
+		}
+		err := s.writeframe(s.nextcontrol(), data[:l], seg)
+		if err != nil {
+			return err
+		}
+		data = data[l:]
+		if !seg {
+			return nil
+		}
+
+		for {
+			pck, err := s.readframe()
+			if err != nil {
+				return err
+			}
+			if pck.control&0xf == 1 { // RR asking for next segment
+				if pck.control>>5 != s.controlS {
+					return fmt.Errorf("invalid RRR numbering (repetition not yet supported)")
+				}
+				break
+			}
+			if pck.control == 3 {
+				s.logf("received UI, discarding")
+				continue
+			}
+			return fmt.Errorf("unexpected frame type %x during segmented response", pck.control)
+		}
+	}
+}
+
+// receive frames till the whole request is received, link management frames are answered here
+func (s *secondary) receive() error {
+	s.rx = s.rx[:0]
+	s.rxoffset = 0
+	for {
+		pck, err := s.readframe()
+		if err != nil {
+			return err
+		}
+		switch {
+		case pck.control == 0x83: // SNRM
+			err = s.snrm(pck.info)
+			if err != nil {
+				return err
+			}
+		case pck.control == 0x43: // DISC
+			if s.isopen {
+				err = s.writeframe(0x63, nil, false)
+			} else {
+				err = s.writeframe(0x0f, nil, false)
+			}
+			s.isopen = false
+			if err != nil {
+				return err
+			}
+			s.logf("disconnected by client %d", s.client)
+			return io.EOF
+		case !s.isopen:
+			s.logf("received frame %x in disconnected mode", pck.control)
+			err = s.writeframe(0x0f, nil, false) // DM
+			if err != nil {
+				return err
+			}
+		case pck.control&1 == 0: // I frame
+			if pck.control>>5 != s.controlS {
+				return fmt.Errorf("invalid unexpected packet numbering (RRR)")
+			}
+			if (pck.control>>1)&7 != s.controlR {
+				return fmt.Errorf("invalid unexpected packet numbering (SSS)")
+			}
+			s.controlR = (s.controlR + 1) & 7
+			if len(s.rx)+len(pck.info) > maxBody {
+				return fmt.Errorf("too long request received")
+			}
+			s.rx = append(s.rx, pck.info...)
+			if !pck.segmented {
+				s.unanswered = true
+				return nil
+			}
+			err = s.writeframe((s.controlR<<5)|1, nil, false)
+			if err != nil {
+				return err
+			}
+		case pck.control&0xf == 1: // RR, just answer that
+			err = s.writeframe((s.controlR<<5)|1, nil, false)
+			if err != nil {
+				return err
+			}
+		case pck.control == 3:
+			s.logf("received UI, discarding")
+		default:
+			return fmt.Errorf("unexpected frame type %x", pck.control)
+		}
+	}
+}
+
+func (s *secondary) snrm(info []byte) error {
+	s.maxrcv = 128
+	s.maxsnd = 128
+	if len(info) > 0 {
+		if len(info) < 3 || info[0] != 0x81 || info[1] != 0x80 {
+			return fmt.Errorf("invalid snrm header")
+		}
+		if int(info[2])+3 < len(info) {
+			info = info[:int(info[2])+3]
+		}
+		for i := 3; i < len(info); i++ {
+			con, t, err := readsnrmuatag(info[i+1:])
+			if err != nil {
+				return err
+			}
+			switch info[i] {
+			case 5: // client transmit
+				s.maxrcv = t
+			case 6: // client receive
+				s.maxsnd = t
+			case 7:
+			case 8:
+			default:
+				return fmt.Errorf("invalid snrm tag: %v", info[i])
+			}
+			i += con
+		}
+	}
+	if s.maxrcv > s.settings.MaxRcv {
+		s.maxrcv = s.settings.MaxRcv
+	}
+	if s.maxsnd > s.settings.MaxSnd {
+		s.maxsnd = s.settings.MaxSnd
+	}
+
+	s.controlS = 0
+	s.controlR = 0
+	s.isopen = true
+	s.reading = false
+	s.tx = s.tx[:0]
+	s.logf("snrm received from client %d, having maxsnd: %v, maxrcv: %v", s.client, s.maxsnd, s.maxrcv)
+
+	ua := make([]byte, 3, 32)
+	ua[0] = 0x81
+	ua[1] = 0x80
+	ua = appendsnrmuatag(ua, 5, s.maxsnd)
+	ua = appendsnrmuatag(ua, 6, s.maxrcv)
+	ua = append(ua, 0x07, 0x04, 0x00, 0x00, 0x00, 0x01, 0x08, 0x04, 0x00, 0x00, 0x00, 0x01)
+	ua[2] = byte(len(ua) - 3)
+	return s.writeframe(0x63, ua, false)
+}
+
+func appendsnrmuatag(dst []byte, tag byte, v uint) []byte {
+	if v > 0xff {
+		return append(dst, tag, 2, byte(v>>8), byte(v))
+	}
+	return append(dst, tag, 1, byte(v))
+}
+
+// reads single frame, final bit is cleared, frames not addressed to this station are skipped
+func (s *secondary) readframe() (pck macpacket, err error) {
+	for {
+		var ori []byte
+		ori, err = readrawframe(s.transport, &s.recvbuffer, &s.flagged)
+		if err != nil {
+			return
+		}
+		var ours bool
+		pck, ours, err = s.parseframe(ori)
+		if err != nil {
+			return
+		}
+		if ours {
+			pck.control &= 0xef
+			return
+		}
+	}
+}
+
+// reads frame between flags, returned slice is without flags, closing flag of the frame can be the opening one of the next frame
+func readrawframe(transport base.Stream, buffer *[maxLength]byte, flagged *bool) ([]byte, error) {
+	if !*flagged {
+		bcnt := 0
+		for {
+			_, err := io.ReadFull(transport, buffer[:1])
+			if err != nil {
+				return nil, err
+			}
+			if buffer[0] == 0x7e {
+				break
+			}
+			bcnt++
+			if bcnt > maxBytesBefore7e {
+				return nil, fmt.Errorf("too many bytes before any 0x7e found")
+			}
+		}
+	}
+	*flagged = false
+	for { // skip repeated flags
+		_, err := io.ReadFull(transport, buffer[1:2])
+		if err != nil {
+			return nil, err
+		}
+		if buffer[1] != 0x7e {
+			break
+		}
+	}
+	_, err := io.ReadFull(transport, buffer[2:3])
+	if err != nil {
+		return nil, err
+	}
+	if (buffer[1] & 0xf0) != 0xa0 {
+		return nil, fmt.Errorf("invalid starting packet: %X", buffer[1])
+	}
+	length := ((int(buffer[1]) & 7) << 8) | int(buffer[2])
+	if length < 7 {
+		return nil, fmt.Errorf("invalid packet length, too short")
+	}
+	_, err = io.ReadFull(transport, buffer[3:length+2])
+	if err != nil {
+		return nil, err
+	}
+	if buffer[length+1] != 0x7e {
+		return nil, fmt.Errorf("there is no closing tag found")
+	}
+	*flagged = true
+	return buffer[1 : length+1], nil
+}
+
+func (s *secondary) parseframe(ori []byte) (pck macpacket, ours bool, err error) {
+	// server address first, variable length
+	offset := 2
+	var addr [4]byte
+	al := 0
+	for {
+		if offset >= len(ori) || al >= len(addr) {
+			return pck, false, fmt.Errorf("invalid address field")
+		}
+		addr[al] = ori[offset] >> 1
+		al++
+		offset++
+		if ori[offset-1]&1 != 0 {
+			break
+		}
+	}
+	var log, phy uint16
+	switch al {
+	case 1:
+		log = uint16(addr[0])
+	case 2:
+		log = uint16(addr[0])
+		phy = uint16(addr[1])
+	case 4:
+		log = uint16(addr[0])<<7 | uint16(addr[1])
+		phy = uint16(addr[2])<<7 | uint16(addr[3])
+	default:
+		return pck, false, fmt.Errorf("invalid address length")
+	}
+	if len(ori) < offset+4 {
+		return pck, false, fmt.Errorf("too short packet")
+	}
+	if ori[offset]&1 == 0 {
+		return pck, false, fmt.Errorf("invalid ending bit of client address")
+	}
+	client := ori[offset] >> 1
+	offset++
+
+	if log != s.settings.Logical || phy != s.settings.Physical {
+		s.logf("skipping frame for logical %d physical %d", log, phy)
+		return pck, false, nil
+	}
+	if s.settings.Client != 0 && client != s.settings.Client {
+		s.logf("skipping frame from client %d", client)
+		return pck, false, nil
+	}
+	if s.isopen && client != s.client && ori[offset]&0xef != 0x83 {
+		s.logf("skipping frame from another client %d", client)
+		return pck, false, nil
+	}
+
+	pck.segmented = ori[0]&8 != 0
+	pck.control = ori[offset]
+	rem := len(ori) - offset
+	switch {
+	case rem == 3:
+		fcs := mac_crc16(ori[:len(ori)-2])
+		if fcs != uint16(ori[len(ori)-2])|(uint16(ori[len(ori)-1])<<8) {
+			return pck, false, fmt.Errorf("fcs mismatch")
+		}
+	case rem <= 5:
+		return pck, false, fmt.Errorf("invalid packet length")
+	default:
+		hcs, fcs := mac_crc16_r(ori[:len(ori)-2], offset+1)
+		if hcs != uint16(ori[offset+1])|(uint16(ori[offset+2])<<8) {
+			return pck, false, fmt.Errorf("hcs mismatch")
+		}
+		if fcs != uint16(ori[len(ori)-2])|(uint16(ori[len(ori)-1])<<8) {
+			return pck, false, fmt.Errorf("fcs mismatch")
+		}
+		pck.info = ori[offset+3 : len(ori)-2]
+	}
+	if pck.control&0xef == 0x83 {
+		s.client = client
+	}
+	return pck, true, nil
+}
+
+// always with final bit
+func (s *secondary) writeframe(control byte, info []byte, segmented bool) error {
+	pck := append(s.sendbuffer[:0], 0x7e, 0, 0, (s.client<<1)|1)
+	switch s.addrlen {
+	case 1:
+		pck = append(pck, byte(s.settings.Logical<<1)|1)
+	case 2:
+		pck = append(pck, byte(s.settings.Logical<<1), byte(s.settings.Physical<<1)|1)
+	case 4:
+		pck = append(pck, byte(s.settings.Logical>>7)<<1, byte(s.settings.Logical<<1), byte(s.settings.Physical>>7)<<1, byte(s.settings.Physical<<1)|1)
+	default:
+		return fmt.Errorf("invalid address length, programatic error")
+	}
+	pck = append(pck, control|0x10)
+	ih := len(pck) - 1
+	if len(info) > 0 {
+		pck = append(pck, 0, 0)
+		pck = append(pck, info...)
+	}
+	leni := len(pck) + 1 // without opening flag, with fcs
+	if leni > 0x7ff {
+		return fmt.Errorf("too long packet to encode")
+	}
+	pck[1] = 0xa0 | byte(leni>>8)
+	if segmented {
+		pck[1] |= 8
+	}
+	pck[2] = byte(leni)
+	var fcs uint16
+	if len(info) > 0 {
+		fcs = mac_crc16_w(pck[1:], ih)
+	} else {
+		fcs = mac_crc16(pck[1:])
+	}
+	pck = append(pck, byte(fcs), byte(fcs>>8), 0x7e)
+	return s.transport.Write(pck)
+}
+
+func (s *secondary) SetMaxReceivedBytes(m int64) {
+	s.transport.SetMaxReceivedBytes(m)
+}
+
+func (s *secondary) SetTimeout(t time.Duration) {
+	s.transport.SetTimeout(t)
+}
+
+func (s *secondary) SetDeadline(t time.Time) {
+	s.transport.SetDeadline(t)
+}
+
+func (s *secondary) SetLogger(logger *zap.SugaredLogger) {
+	s.logger = logger
+	s.transport.SetLogger(logger)
+}
+
+func (s *secondary) GetRxTxBytes() (int64, int64) {
+	return s.transport.GetRxTxBytes()
+}
@@ -1,6 +1,7 @@
 package llc
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -13,7 +14,9 @@ type llc struct {
 	transport base.Stream
 	logger    *zap.SugaredLogger
 	header    []byte
-	state     int // 0 - start, 1 - writting, 2 - reading
+	state     int  // 0 - start, 1 - writting, 2 - reading
+	rxheader  byte // second byte of the expected header, e7 for client, e6 for server
+	txheader  byte
 }
 
 // Close implements base.Stream.
@@ -34,14 +37,18 @@ func (l *llc) Open() error {
 // Receive implements base.Stream.
 func (l *llc) Read(p []byte) (n int, err error) {
 	if l.state == 2 {
-		return l.transport.Read(p)
+		n, err = l.transport.Read(p)
+		if errors.Is(err, io.EOF) { // next read is a new message (server side without answer in between)
+			l.state = 0
+		}
+		return
 	}
 	l.state = 2
 	_, err = io.ReadFull(l.transport, l.header)
 	if err != nil {
 		return
 	}
-	if l.header[0] != 0xe6 || l.header[1] != 0xe7 || l.header[2] != 0 {
+	if l.header[0] != 0xe6 || l.header[1] != l.rxheader || l.header[2] != 0 {
 		return 0, fmt.Errorf("invalid LLC received header")
 	}
 	return l.transport.Read(p)
@@ -54,7 +61,7 @@ func (l *llc) Write(src []byte) error { // always write everything
 	}
 	l.state = 1
 	l.header[0] = 0xe6
-	l.header[1] = 0xe6
+	l.header[1] = l.txheader
 	l.header[2] = 0x00
 	err := l.transport.Write(l.header)
 	if err != nil {
@@ -63,6 +70,26 @@ func (l *llc) Write(src []byte) error { // always write everything
 	return l.transport.Write(src)
 }
 
+// llc over transport able to flush, so it can flush too
+type flushllc struct {
+	*llc
+	flusher base.Flusher
+}
+
+// sends written message right away, the next write starts a new message with its own header
+func (l *flushllc) Flush() error {
+	l.state = 0
+	return l.flusher.Flush()
+}
+
+// base.Flusher is implemented only if the transport implements it
+func wrap(l *llc) base.Stream {
+	if f, ok := l.transport.(base.Flusher); ok {
+		return &flushllc{llc: l, flusher: f}
+	}
+	return l
+}
+
 func (l *llc) SetMaxReceivedBytes(m int64) {
 	l.transport.SetMaxReceivedBytes(m)
 }
@@ -86,10 +113,24 @@ func (l *llc) GetRxTxBytes() (int64, int64) {
 }
 
 func New(transport base.Stream) base.Stream {
-	return &llc{
+	return wrap(&llc{
 		transport: transport,
 		logger:    nil,
 		header:    make([]byte, 3), // buffer jak hovado
 		state:     0,
-	}
+		rxheader:  0xe7,
+		txheader:  0xe6,
+	})
+}
+
+// server side llc, request header is expected and response header is sent
+func NewServer(transport base.Stream) base.Stream {
+	return wrap(&llc{
+		transport: transport,
+		logger:    nil,
+		header:    make([]byte, 3),
+		state:     0,
+		rxheader:  0xe6,
+		txheader:  0xe7,
+	})
 }
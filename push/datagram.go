@@ -0,0 +1,65 @@
+package push
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"go.uber.org/zap"
+)
+
+// single received datagram as a raw byte stream, io.EOF at its end
+type datagram struct {
+	data []byte
+	rx   int64
+}
+
+func newdatagram(data []byte) base.Stream {
+	return &datagram{data: data}
+}
+
+func (d *datagram) Close() error {
+	return nil
+}
+
+func (d *datagram) Open() error {
+	return nil
+}
+
+func (d *datagram) Disconnect() error {
+	return nil
+}
+
+func (d *datagram) SetLogger(logger *zap.SugaredLogger) {
+}
+
+func (d *datagram) SetDeadline(t time.Time) {
+}
+
+func (d *datagram) SetTimeout(t time.Duration) {
+}
+
+func (d *datagram) SetMaxReceivedBytes(m int64) {
+}
+
+func (d *datagram) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, base.ErrNothingToRead
+	}
+	if len(d.data) == 0 {
+		return 0, io.EOF
+	}
+	n = copy(p, d.data)
+	d.data = d.data[n:]
+	d.rx += int64(n)
+	return n, nil
+}
+
+func (d *datagram) Write(src []byte) error {
+	return fmt.Errorf("datagram is read only")
+}
+
+func (d *datagram) GetRxTxBytes() (int64, int64) {
+	return d.rx, 0
+}
@@ -0,0 +1,258 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"github.com/cybroslabs/libdlms-go/dlmsal"
+	"github.com/cybroslabs/libdlms-go/hdlc"
+	"github.com/cybroslabs/libdlms-go/llc"
+	"github.com/cybroslabs/libdlms-go/tcp"
+	"github.com/cybroslabs/libdlms-go/wrapper"
+	"go.uber.org/zap"
+)
+
+// received data-notification together with the address of the sender
+type Notification struct {
+	dlmsal.DataNotification
+	Remote net.Addr // nil in case of Serve
+}
+
+// called for every received push, calls from different connections can run concurrently
+type Handler func(n *Notification)
+
+// wraps raw byte stream into apdu stream on the receiving side
+type Framing func(transport base.Stream) (base.Stream, error)
+
+// address is the wrapper port the pushes are sent to
+func WrapperFraming(address uint16) Framing {
+	return func(transport base.Stream) (base.Stream, error) {
+		return wrapper.NewServer(transport, address)
+	}
+}
+
+// pushes are expected in UI frames sent to settings.Client
+func HdlcFraming(settings *hdlc.Settings) Framing {
+	return func(transport base.Stream) (base.Stream, error) {
+		h, err := hdlc.NewPushReceiver(transport, settings)
+		if err != nil {
+			return nil, err
+		}
+		return llc.New(h), nil
+	}
+}
+
+// handler sending notifications into the channel, it blocks while the channel is full
+func ChannelHandler(ch chan<- *Notification) Handler {
+	return func(n *Notification) {
+		ch <- n
+	}
+}
+
+// receives pushes over tcp, udp or any apdu stream, invalid pushes are skipped and remembered as the last error
+type Receiver struct {
+	decoder *dlmsal.PushDecoder
+	handler Handler
+	logger  *zap.SugaredLogger
+	decmu   sync.Mutex // decoder and ciphering of the settings are not safe for concurrent use
+	mu      sync.Mutex
+	lasterr error
+	closers []io.Closer
+	conns   map[net.Conn]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// settings are used for decryption of ciphered pushes, can be nil if only not ciphered pushes are expected
+func New(settings *dlmsal.DlmsSettings, handler Handler) *Receiver {
+	return &Receiver{
+		decoder: dlmsal.NewPushDecoder(settings),
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+func (r *Receiver) SetLogger(logger *zap.SugaredLogger) {
+	r.logger = logger
+	r.decoder.SetLogger(logger)
+}
+
+func (r *Receiver) logf(format string, v ...any) {
+	if r.logger != nil {
+		r.logger.Infof(format, v...)
+	}
+}
+
+// Err returns the last error of pushes received in background
+func (r *Receiver) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lasterr
+}
+
+func (r *Receiver) seterr(err error) {
+	if err == nil {
+		return
+	}
+	r.logf("receiving failed: %v", err)
+	r.mu.Lock()
+	r.lasterr = err
+	r.mu.Unlock()
+}
+
+func (r *Receiver) handle(apdu []byte, remote net.Addr) {
+	r.decmu.Lock()
+	n, err := r.decoder.Decode(apdu)
+	r.decmu.Unlock()
+	if err != nil {
+		r.seterr(fmt.Errorf("invalid push from %v: %w", remote, err))
+		return
+	}
+	r.handler(&Notification{DataNotification: *n, Remote: remote})
+}
+
+func (r *Receiver) serve(transport base.Stream, remote net.Addr) error {
+	for {
+		apdu, err := io.ReadAll(transport)
+		if err != nil {
+			return err
+		}
+		if len(apdu) == 0 { // no more messages
+			return nil
+		}
+		r.handle(apdu, remote)
+	}
+}
+
+// receives pushes from the apdu stream till its end, invalid pushes are skipped
+func (r *Receiver) Serve(transport base.Stream) error {
+	return r.serve(transport, nil)
+}
+
+// listens on the tcp address (e.g. :4059), every accepted connection is served in its own goroutine
+func (r *Receiver) ListenTCP(address string, framing Framing) (net.Addr, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.addcloser(ln); err != nil {
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.accept(ln, framing)
+	return ln.Addr(), nil
+}
+
+func (r *Receiver) accept(ln net.Listener, framing Framing) {
+	defer r.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.conns[conn] = struct{}{}
+		r.mu.Unlock()
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.logf("receiving pushes from %s", conn.RemoteAddr())
+			err := r.serveconn(conn, framing)
+			r.mu.Lock()
+			delete(r.conns, conn)
+			closed := r.closed
+			r.mu.Unlock()
+			if !closed { // errors caused by closing the receiver are not interesting
+				r.seterr(err)
+			}
+		}()
+	}
+}
+
+func (r *Receiver) serveconn(conn net.Conn, framing Framing) error {
+	defer conn.Close()
+	t, err := framing(tcp.NewFromConn(conn, 0))
+	if err != nil {
+		return err
+	}
+	if r.logger != nil {
+		t.SetLogger(r.logger)
+	}
+	err = r.serve(t, conn.RemoteAddr())
+	if errors.Is(err, io.EOF) { // closed by the meter in the middle of the frame header
+		return nil
+	}
+	return err
+}
+
+// listens on the udp address, every datagram has to contain whole framed push
+func (r *Receiver) ListenUDP(address string, framing Framing) (net.Addr, error) {
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.addcloser(pc); err != nil {
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.readudp(pc, framing)
+	return pc.LocalAddr(), nil
+}
+
+func (r *Receiver) readudp(pc net.PacketConn, framing Framing) {
+	defer r.wg.Done()
+	buf := make([]byte, 65536)
+	for {
+		n, remote, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		t, err := framing(newdatagram(buf[:n]))
+		if err != nil {
+			r.seterr(err)
+			continue
+		}
+		apdu, err := io.ReadAll(t)
+		if err != nil {
+			r.seterr(fmt.Errorf("invalid datagram from %v: %w", remote, err))
+			continue
+		}
+		if len(apdu) > 0 {
+			r.handle(apdu, remote)
+		}
+	}
+}
+
+func (r *Receiver) addcloser(c io.Closer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		_ = c.Close()
+		return fmt.Errorf("receiver is closed")
+	}
+	r.closers = append(r.closers, c)
+	return nil
+}
+
+// stops all listeners, closes all connections and waits for them
+func (r *Receiver) Close() error {
+	var err error
+	r.mu.Lock()
+	r.closed = true
+	for _, c := range r.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	r.closers = nil
+	for c := range r.conns {
+		_ = c.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
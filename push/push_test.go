@@ -0,0 +1,163 @@
+package push
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"github.com/cybroslabs/libdlms-go/dlmsal"
+	"github.com/cybroslabs/libdlms-go/hdlc"
+	"github.com/cybroslabs/libdlms-go/tcp"
+	"github.com/cybroslabs/libdlms-go/wrapper"
+)
+
+// not ciphered data-notification without date-time, body is unsigned
+func notification(body byte) []byte {
+	return []byte{byte(dlmsal.TagDataNotification), 0x40, 0, 0, 7, 0, byte(dlmsal.TagUnsigned), body}
+}
+
+func wrapperframe(src uint16, dst uint16, apdu []byte) []byte {
+	return append([]byte{0, 1, byte(src >> 8), byte(src), byte(dst >> 8), byte(dst), byte(len(apdu) >> 8), byte(len(apdu))}, apdu...)
+}
+
+// crc-16/x-25 as used by hdlc
+func fcs16(b []byte) uint16 {
+	c := uint16(0xffff)
+	for _, v := range b {
+		c ^= uint16(v)
+		for i := 0; i < 8; i++ {
+			if c&1 != 0 {
+				c = c>>1 ^ 0x8408
+			} else {
+				c >>= 1
+			}
+		}
+	}
+	return c ^ 0xffff
+}
+
+// UI frame from server 1/0x10 to the client with llc header
+func uiframe(client byte, apdu []byte) []byte {
+	info := append([]byte{0xe6, 0xe7, 0}, apdu...)
+	l := 10 + len(info)
+	f := []byte{0xa0 | byte(l>>8), byte(l), client<<1 | 1, 1 << 1, 0x10<<1 | 1, 0x13}
+	hcs := fcs16(f)
+	f = append(f, byte(hcs), byte(hcs>>8))
+	f = append(f, info...)
+	fcs := fcs16(f)
+	f = append(f, byte(fcs), byte(fcs>>8))
+	return append(append([]byte{0x7e}, f...), 0x7e)
+}
+
+func receive(t *testing.T, ch <-chan *Notification, body byte) *Notification {
+	t.Helper()
+	select {
+	case n := <-ch:
+		if n.Body.Tag != dlmsal.TagUnsigned || n.Body.Value != body {
+			t.Errorf("unexpected push body %v", n.Body)
+		}
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatalf("push %d not received", body)
+	}
+	return nil
+}
+
+func TestListenTCP(t *testing.T) {
+	ch := make(chan *Notification, 4)
+	r := New(nil, ChannelHandler(ch))
+	defer r.Close()
+	addr, err := r.ListenTCP("127.0.0.1:0", WrapperFraming(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := wrapper.New(tcp.NewFromConn(conn, 5*time.Second), 0x10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := byte(1); i <= 2; i++ { // more pushes over the same connection
+		if err = w.Write(notification(i)); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.(base.Flusher).Flush(); err != nil {
+			t.Fatal(err)
+		}
+		n := receive(t, ch, i)
+		if n.Remote == nil || n.Remote.String() != conn.LocalAddr().String() {
+			t.Errorf("unexpected remote address %v", n.Remote)
+		}
+	}
+	_ = conn.Close()
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Err(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestListenUDP(t *testing.T) {
+	ch := make(chan *Notification, 4)
+	r := New(nil, ChannelHandler(ch))
+	defer r.Close()
+	addr, err := r.ListenUDP("127.0.0.1:0", WrapperFraming(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write(wrapperframe(0x10, 2, notification(1))); err != nil { // another wrapper port
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(wrapperframe(0x10, 1, notification(2))); err != nil {
+		t.Fatal(err)
+	}
+	n := receive(t, ch, 2)
+	if n.Remote == nil || n.Remote.String() != conn.LocalAddr().String() {
+		t.Errorf("unexpected remote address %v", n.Remote)
+	}
+	if r.Err() == nil {
+		t.Errorf("datagram for another port not reported")
+	}
+}
+
+func TestServeHdlc(t *testing.T) {
+	cc, sc := net.Pipe()
+	go func() {
+		defer sc.Close()
+		for _, f := range [][]byte{uiframe(0x66, notification(1)), uiframe(0x10, notification(2)), uiframe(0x66, []byte{1, 2, 3}), uiframe(0x66, notification(3))} {
+			if _, err := sc.Write(f); err != nil {
+				return
+			}
+		}
+	}()
+	ch := make(chan *Notification, 4)
+	r := New(nil, ChannelHandler(ch))
+	f, err := HdlcFraming(&hdlc.Settings{Logical: 1, Physical: 0x10, Client: 0x66})(tcp.NewFromConn(cc, 5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Serve(f); err != nil {
+		t.Fatal(err)
+	}
+	if n := receive(t, ch, 1); n.Remote != nil {
+		t.Errorf("unexpected remote address %v", n.Remote)
+	}
+	receive(t, ch, 3) // push for another client is skipped
+	if len(ch) != 0 {
+		t.Errorf("unexpected push received")
+	}
+	if r.Err() == nil { // invalid push is skipped, but remembered
+		t.Errorf("invalid push not reported")
+	}
+}
@@ -0,0 +1,265 @@
+package simulator
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/dlmsal"
+)
+
+// cosem object served by the meter, attribute 1 is always logical name,
+// selector is 0 in case of no selective access
+type Object interface {
+	ClassId() uint16
+	LogicalName() dlmsal.DlmsObis
+	Get(attribute int8, selector byte, params *dlmsal.DlmsData) dlmsal.DlmsData
+	Set(attribute int8, value *dlmsal.DlmsData) dlmsal.DlmsResultTag
+	Action(method int8, params *dlmsal.DlmsData) (*dlmsal.DlmsData, dlmsal.DlmsResultTag)
+}
+
+type object struct {
+	mu   sync.Mutex
+	obis dlmsal.DlmsObis
+}
+
+func (o *object) LogicalName() dlmsal.DlmsObis {
+	return o.obis
+}
+
+func (o *object) logicalname() dlmsal.DlmsData {
+	return dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: o.obis.Bytes()}
+}
+
+func errdata(res dlmsal.DlmsResultTag) dlmsal.DlmsData {
+	return dlmsal.NewDlmsDataError(res)
+}
+
+// zero value of the same type, used for resets
+func zerodata(d *dlmsal.DlmsData) dlmsal.DlmsData {
+	if d.Value == nil {
+		return *d
+	}
+	return dlmsal.DlmsData{Tag: d.Tag, Value: reflect.Zero(reflect.TypeOf(d.Value)).Interface()}
+}
+
+// class 1
+type Data struct {
+	object
+	value dlmsal.DlmsData
+}
+
+func NewData(obis dlmsal.DlmsObis, value dlmsal.DlmsData) *Data {
+	return &Data{object: object{obis: obis}, value: value}
+}
+
+func (d *Data) ClassId() uint16 {
+	return 1
+}
+
+func (d *Data) Value() dlmsal.DlmsData {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.value
+}
+
+func (d *Data) SetValue(value dlmsal.DlmsData) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.value = value
+}
+
+func (d *Data) Get(attribute int8, selector byte, params *dlmsal.DlmsData) dlmsal.DlmsData {
+	if selector != 0 {
+		return errdata(dlmsal.TagResultOtherReason)
+	}
+	switch attribute {
+	case 1:
+		return d.logicalname()
+	case 2:
+		return d.Value()
+	}
+	return errdata(dlmsal.TagResultObjectUndefined)
+}
+
+func (d *Data) Set(attribute int8, value *dlmsal.DlmsData) dlmsal.DlmsResultTag {
+	switch attribute {
+	case 1:
+		return dlmsal.TagResultReadWriteDenied
+	case 2:
+		d.SetValue(*value)
+		return dlmsal.TagResultSuccess
+	}
+	return dlmsal.TagResultObjectUndefined
+}
+
+func (d *Data) Action(method int8, params *dlmsal.DlmsData) (*dlmsal.DlmsData, dlmsal.DlmsResultTag) {
+	return nil, dlmsal.TagResultObjectUndefined
+}
+
+// class 3
+type Register struct {
+	object
+	value  dlmsal.DlmsData
+	scaler int8
+	unit   uint8
+}
+
+func NewRegister(obis dlmsal.DlmsObis, value dlmsal.DlmsData, scaler int8, unit uint8) *Register {
+	return &Register{object: object{obis: obis}, value: value, scaler: scaler, unit: unit}
+}
+
+func (r *Register) ClassId() uint16 {
+	return 3
+}
+
+func (r *Register) Value() dlmsal.DlmsData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.value
+}
+
+func (r *Register) SetValue(value dlmsal.DlmsData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.value = value
+}
+
+func (r *Register) Get(attribute int8, selector byte, params *dlmsal.DlmsData) dlmsal.DlmsData {
+	if selector != 0 {
+		return errdata(dlmsal.TagResultOtherReason)
+	}
+	switch attribute {
+	case 1:
+		return r.logicalname()
+	case 2:
+		return r.Value()
+	case 3:
+		return dlmsal.DlmsData{Tag: dlmsal.TagStructure, Value: []dlmsal.DlmsData{
+			{Tag: dlmsal.TagInteger, Value: r.scaler},
+			{Tag: dlmsal.TagEnum, Value: r.unit},
+		}}
+	}
+	return errdata(dlmsal.TagResultObjectUndefined)
+}
+
+func (r *Register) Set(attribute int8, value *dlmsal.DlmsData) dlmsal.DlmsResultTag {
+	switch attribute {
+	case 1, 3:
+		return dlmsal.TagResultReadWriteDenied
+	case 2:
+		r.SetValue(*value)
+		return dlmsal.TagResultSuccess
+	}
+	return dlmsal.TagResultObjectUndefined
+}
+
+func (r *Register) Action(method int8, params *dlmsal.DlmsData) (*dlmsal.DlmsData, dlmsal.DlmsResultTag) {
+	if method != 1 { // reset
+		return nil, dlmsal.TagResultObjectUndefined
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.value = zerodata(&r.value)
+	return nil, dlmsal.TagResultSuccess
+}
+
+// class 8, running from the given time, time zone is taken from the location of the time
+type Clock struct {
+	object
+	offset time.Duration
+	loc    *time.Location
+}
+
+func NewClock(obis dlmsal.DlmsObis, now time.Time) *Clock {
+	return &Clock{object: object{obis: obis}, offset: time.Until(now), loc: now.Location()}
+}
+
+func (c *Clock) ClassId() uint16 {
+	return 8
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Add(c.offset).In(c.loc)
+}
+
+func (c *Clock) SetTime(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = time.Until(t)
+	c.loc = t.Location()
+}
+
+func (c *Clock) Get(attribute int8, selector byte, params *dlmsal.DlmsData) dlmsal.DlmsData {
+	if selector != 0 {
+		return errdata(dlmsal.TagResultOtherReason)
+	}
+	switch attribute {
+	case 1:
+		return c.logicalname()
+	case 2:
+		return dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: dlmsal.NewDlmsDateTimeFromTime(c.Now())}
+	case 3:
+		_, off := c.Now().Zone()
+		return dlmsal.DlmsData{Tag: dlmsal.TagLong, Value: int16(off / 60)}
+	case 4:
+		return dlmsal.DlmsData{Tag: dlmsal.TagUnsigned, Value: uint8(0)}
+	case 5, 6: // no daylight savings
+		return dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x80, 0x00, 0xff}}
+	case 7:
+		return dlmsal.DlmsData{Tag: dlmsal.TagInteger, Value: int8(0)}
+	case 8:
+		return dlmsal.DlmsData{Tag: dlmsal.TagBoolean, Value: false}
+	case 9:
+		return dlmsal.DlmsData{Tag: dlmsal.TagEnum, Value: uint8(1)} // internal crystal
+	}
+	return errdata(dlmsal.TagResultObjectUndefined)
+}
+
+func (c *Clock) Set(attribute int8, value *dlmsal.DlmsData) dlmsal.DlmsResultTag {
+	switch attribute {
+	case 2:
+		var t time.Time
+		if err := dlmsal.Cast(&t, *value); err != nil {
+			return dlmsal.TagResultTypeUnmatched
+		}
+		c.SetTime(t)
+		return dlmsal.TagResultSuccess
+	case 3:
+		var dev int16
+		if err := dlmsal.Cast(&dev, *value); err != nil {
+			return dlmsal.TagResultTypeUnmatched
+		}
+		c.mu.Lock()
+		c.loc = time.FixedZone("", int(dev)*60)
+		c.mu.Unlock()
+		return dlmsal.TagResultSuccess
+	case 1, 4, 5, 6, 7, 8, 9:
+		return dlmsal.TagResultReadWriteDenied
+	}
+	return dlmsal.TagResultObjectUndefined
+}
+
+func (c *Clock) Action(method int8, params *dlmsal.DlmsData) (*dlmsal.DlmsData, dlmsal.DlmsResultTag) {
+	now := c.Now()
+	switch method {
+	case 1: // adjust to quarter
+		c.SetTime(now.Add(7*time.Minute + 30*time.Second).Truncate(15 * time.Minute))
+	case 3: // adjust to minute
+		c.SetTime(now.Add(30 * time.Second).Truncate(time.Minute))
+	case 6: // shift time
+		var sec int16
+		if params == nil || dlmsal.Cast(&sec, *params) != nil {
+			return nil, dlmsal.TagResultTypeUnmatched
+		}
+		if sec < -900 || sec > 900 {
+			return nil, dlmsal.TagResultOtherReason
+		}
+		c.SetTime(now.Add(time.Duration(sec) * time.Second))
+	default:
+		return nil, dlmsal.TagResultObjectUndefined
+	}
+	return nil, dlmsal.TagResultSuccess
+}
@@ -0,0 +1,185 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"go.uber.org/zap"
+)
+
+// one end of the in-memory apdu pipe, written data are sent as a single message with the next read,
+// read returns io.EOF at the end of each message, so it behaves like wrapper or hdlc on top of a transport
+type pipe struct {
+	in       chan []byte
+	out      chan []byte
+	done     chan struct{}
+	peerdone chan struct{}
+	once     *sync.Once
+	logger   *zap.SugaredLogger
+	wbuf     bytes.Buffer
+	rbuf     []byte
+	reading  bool
+	timeout  time.Duration
+	deadline time.Time
+	rx       int64
+	tx       int64
+	maxrx    int64
+	currx    int64
+}
+
+// creates connected pair of apdu streams, usually the first one for the client and the second one for the meter
+func NewPipe() (base.Stream, base.Stream) {
+	a := make(chan []byte, 1)
+	b := make(chan []byte, 1)
+	ad := make(chan struct{})
+	bd := make(chan struct{})
+	return &pipe{in: a, out: b, done: ad, peerdone: bd, once: &sync.Once{}},
+		&pipe{in: b, out: a, done: bd, peerdone: ad, once: &sync.Once{}}
+}
+
+func (p *pipe) Close() error {
+	return nil
+}
+
+func (p *pipe) Open() error {
+	select {
+	case <-p.done:
+		return base.ErrNotOpened
+	default:
+	}
+	return nil
+}
+
+func (p *pipe) Disconnect() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *pipe) SetLogger(logger *zap.SugaredLogger) {
+	p.logger = logger
+}
+
+func (p *pipe) SetDeadline(t time.Time) {
+	p.deadline = t
+}
+
+func (p *pipe) SetTimeout(t time.Duration) {
+	p.timeout = t
+}
+
+func (p *pipe) SetMaxReceivedBytes(m int64) {
+	p.currx = 0
+	p.maxrx = m
+}
+
+func (p *pipe) GetRxTxBytes() (int64, int64) {
+	return p.rx, p.tx
+}
+
+func (p *pipe) Write(src []byte) error {
+	select {
+	case <-p.done:
+		return base.ErrNotOpened
+	default:
+	}
+	p.reading = false
+	p.wbuf.Write(src)
+	return nil
+}
+
+// sends written data as a single message, so more messages can be sent in a row
+func (p *pipe) Flush() error {
+	tc, stop := p.timer()
+	defer stop()
+	return p.send(tc)
+}
+
+func (p *pipe) send(tc <-chan time.Time) error {
+	if p.wbuf.Len() == 0 {
+		return nil
+	}
+	msg := make([]byte, p.wbuf.Len())
+	copy(msg, p.wbuf.Bytes())
+	p.wbuf.Reset()
+	select {
+	case p.out <- msg:
+	case <-p.done:
+		return base.ErrNotOpened
+	case <-p.peerdone:
+		return io.EOF
+	case <-tc:
+		return base.ErrCommunicationTimeout
+	}
+	p.tx += int64(len(msg))
+	if p.logger != nil {
+		p.logger.Debugf(base.LogHex("TX", msg))
+	}
+	return nil
+}
+
+func (p *pipe) timer() (<-chan time.Time, func()) {
+	d := p.timeout
+	if !p.deadline.IsZero() {
+		dd := time.Until(p.deadline)
+		if d == 0 || dd < d {
+			d = dd
+		}
+		if d <= 0 {
+			d = 1
+		}
+	}
+	if d == 0 {
+		return nil, func() {}
+	}
+	t := time.NewTimer(d)
+	return t.C, func() { t.Stop() }
+}
+
+func (p *pipe) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, base.ErrNothingToRead
+	}
+	if !p.reading {
+		tc, stop := p.timer()
+		defer stop()
+		if err := p.send(tc); err != nil {
+			return 0, err
+		}
+
+		var msg []byte
+		select {
+		case msg = <-p.in:
+		case <-p.done:
+			return 0, base.ErrNotOpened
+		case <-p.peerdone:
+			select { // peer could send something before disconnecting
+			case msg = <-p.in:
+			default:
+				return 0, io.EOF
+			}
+		case <-tc:
+			return 0, base.ErrCommunicationTimeout
+		}
+		p.rx += int64(len(msg))
+		p.currx += int64(len(msg))
+		if p.logger != nil {
+			p.logger.Debugf(base.LogHex("RX", msg))
+		}
+		if p.maxrx > 0 && p.currx > p.maxrx {
+			return 0, fmt.Errorf("received more than allowed")
+		}
+		p.rbuf = msg
+		p.reading = true
+	}
+	if len(p.rbuf) == 0 {
+		p.reading = false
+		return 0, io.EOF
+	}
+	n := copy(b, p.rbuf)
+	p.rbuf = p.rbuf[n:]
+	return n, nil
+}
@@ -0,0 +1,292 @@
+package simulator
+
+import (
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/dlmsal"
+)
+
+type CaptureObject struct {
+	ClassId   uint16
+	Obis      dlmsal.DlmsObis
+	Attribute int8
+	DataIndex uint16
+}
+
+func (c *CaptureObject) encode() dlmsal.DlmsData {
+	return dlmsal.EncodeCaptureObject(c.ClassId, &c.Obis, c.Attribute, c.DataIndex)
+}
+
+// class 7, buffer is filled by AddRow or by the capture method which reads capture objects from the meter,
+// selective access by range (1) and by entry (2) is supported
+type ProfileGeneric struct {
+	object
+	captures []CaptureObject
+	period   uint32
+	entries  uint32
+	buffer   [][]dlmsal.DlmsData
+	meter    *Meter
+}
+
+// entries is maximum number of rows, 0 means unlimited
+func NewProfileGeneric(obis dlmsal.DlmsObis, captures []CaptureObject, period uint32, entries uint32) *ProfileGeneric {
+	return &ProfileGeneric{object: object{obis: obis}, captures: captures, period: period, entries: entries}
+}
+
+func (p *ProfileGeneric) ClassId() uint16 {
+	return 7
+}
+
+func (p *ProfileGeneric) setmeter(m *Meter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.meter = m
+}
+
+// row has to have the same number of columns as the capture objects
+func (p *ProfileGeneric) AddRow(row ...dlmsal.DlmsData) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addrow(row)
+}
+
+func (p *ProfileGeneric) addrow(row []dlmsal.DlmsData) {
+	p.buffer = append(p.buffer, row)
+	if p.entries > 0 && len(p.buffer) > int(p.entries) {
+		p.buffer = p.buffer[len(p.buffer)-int(p.entries):]
+	}
+}
+
+// takes current values of the capture objects and stores them as a new row
+func (p *ProfileGeneric) Capture() {
+	p.mu.Lock()
+	m := p.meter
+	p.mu.Unlock()
+
+	row := make([]dlmsal.DlmsData, len(p.captures))
+	for i, c := range p.captures {
+		row[i] = dlmsal.DlmsData{Tag: dlmsal.TagNull}
+		if m == nil {
+			continue
+		}
+		o := m.Object(c.Obis)
+		if o == nil || o.ClassId() != c.ClassId {
+			continue
+		}
+		v := o.Get(c.Attribute, 0, nil)
+		if v.Tag == dlmsal.TagError {
+			continue
+		}
+		if c.DataIndex > 0 {
+			vv, ok := v.Value.([]dlmsal.DlmsData)
+			if !ok || int(c.DataIndex) > len(vv) {
+				continue
+			}
+			v = vv[c.DataIndex-1]
+		}
+		row[i] = v
+	}
+	p.AddRow(row...)
+}
+
+func (p *ProfileGeneric) Get(attribute int8, selector byte, params *dlmsal.DlmsData) dlmsal.DlmsData {
+	if selector != 0 && attribute != 2 {
+		return errdata(dlmsal.TagResultOtherReason)
+	}
+	switch attribute {
+	case 1:
+		return p.logicalname()
+	case 2:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.getbuffer(selector, params)
+	case 3:
+		co := make([]dlmsal.DlmsData, len(p.captures))
+		for i := range p.captures {
+			co[i] = p.captures[i].encode()
+		}
+		return dlmsal.DlmsData{Tag: dlmsal.TagArray, Value: co}
+	case 4:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: p.period}
+	case 5:
+		return dlmsal.DlmsData{Tag: dlmsal.TagEnum, Value: uint8(1)} // fifo
+	case 6:
+		return (&CaptureObject{}).encode()
+	case 7:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: uint32(len(p.buffer))}
+	case 8:
+		return dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: p.entries}
+	}
+	return errdata(dlmsal.TagResultObjectUndefined)
+}
+
+func (p *ProfileGeneric) Set(attribute int8, value *dlmsal.DlmsData) dlmsal.DlmsResultTag {
+	switch attribute {
+	case 4:
+		var period uint32
+		if err := dlmsal.Cast(&period, *value); err != nil {
+			return dlmsal.TagResultTypeUnmatched
+		}
+		p.mu.Lock()
+		p.period = period
+		p.mu.Unlock()
+		return dlmsal.TagResultSuccess
+	case 1, 2, 3, 5, 6, 7, 8:
+		return dlmsal.TagResultReadWriteDenied
+	}
+	return dlmsal.TagResultObjectUndefined
+}
+
+func (p *ProfileGeneric) Action(method int8, params *dlmsal.DlmsData) (*dlmsal.DlmsData, dlmsal.DlmsResultTag) {
+	switch method {
+	case 1: // reset
+		p.mu.Lock()
+		p.buffer = nil
+		p.mu.Unlock()
+	case 2: // capture
+		p.Capture()
+	default:
+		return nil, dlmsal.TagResultObjectUndefined
+	}
+	return nil, dlmsal.TagResultSuccess
+}
+
+type rangeDescriptor struct {
+	Restricting CaptureObject
+	From        dlmsal.DlmsData
+	To          dlmsal.DlmsData
+	Selected    []CaptureObject
+}
+
+type entryDescriptor struct {
+	FromEntry uint32
+	ToEntry   uint32
+	FromValue uint16
+	ToValue   uint16
+}
+
+func (p *ProfileGeneric) getbuffer(selector byte, params *dlmsal.DlmsData) dlmsal.DlmsData {
+	rows := p.buffer
+	var columns []int
+	switch selector {
+	case 0:
+	case 1:
+		var rd rangeDescriptor
+		if params == nil || dlmsal.Cast(&rd, *params) != nil {
+			return errdata(dlmsal.TagResultTypeUnmatched)
+		}
+		col := p.column(&rd.Restricting)
+		if col < 0 {
+			return errdata(dlmsal.TagResultOtherReason)
+		}
+		rows = nil
+		for _, r := range p.buffer {
+			f, ok1 := compare(&r[col], &rd.From)
+			t, ok2 := compare(&r[col], &rd.To)
+			if ok1 && ok2 && f >= 0 && t <= 0 {
+				rows = append(rows, r)
+			}
+		}
+		for i := range rd.Selected {
+			c := p.column(&rd.Selected[i])
+			if c < 0 {
+				return errdata(dlmsal.TagResultOtherReason)
+			}
+			columns = append(columns, c)
+		}
+	case 2:
+		var ed entryDescriptor
+		if params == nil || dlmsal.Cast(&ed, *params) != nil {
+			return errdata(dlmsal.TagResultTypeUnmatched)
+		}
+		if ed.FromEntry == 0 {
+			ed.FromEntry = 1
+		}
+		if ed.ToEntry == 0 || ed.ToEntry > uint32(len(rows)) {
+			ed.ToEntry = uint32(len(rows))
+		}
+		if ed.FromEntry > ed.ToEntry {
+			rows = nil
+		} else {
+			rows = rows[ed.FromEntry-1 : ed.ToEntry]
+		}
+		if ed.FromValue == 0 {
+			ed.FromValue = 1
+		}
+		if ed.ToValue == 0 || ed.ToValue > uint16(len(p.captures)) {
+			ed.ToValue = uint16(len(p.captures))
+		}
+		if ed.FromValue > ed.ToValue {
+			return errdata(dlmsal.TagResultOtherReason)
+		}
+		for c := ed.FromValue - 1; c < ed.ToValue; c++ {
+			columns = append(columns, int(c))
+		}
+	default:
+		return errdata(dlmsal.TagResultOtherReason)
+	}
+
+	out := make([]dlmsal.DlmsData, len(rows))
+	for i, r := range rows {
+		if columns == nil {
+			out[i] = dlmsal.DlmsData{Tag: dlmsal.TagStructure, Value: r}
+			continue
+		}
+		rr := make([]dlmsal.DlmsData, len(columns))
+		for j, c := range columns {
+			rr[j] = r[c]
+		}
+		out[i] = dlmsal.DlmsData{Tag: dlmsal.TagStructure, Value: rr}
+	}
+	return dlmsal.DlmsData{Tag: dlmsal.TagArray, Value: out}
+}
+
+func (p *ProfileGeneric) column(c *CaptureObject) int {
+	for i := range p.captures {
+		cc := &p.captures[i]
+		if cc.ClassId == c.ClassId && cc.Obis == c.Obis && cc.Attribute == c.Attribute && cc.DataIndex == c.DataIndex {
+			return i
+		}
+	}
+	return -1
+}
+
+// compares dates or numbers, false in case of incomparable values
+func compare(a *dlmsal.DlmsData, b *dlmsal.DlmsData) (int, bool) {
+	var ta, tb time.Time
+	if dlmsal.Cast(&ta, *a) == nil && dlmsal.Cast(&tb, *b) == nil {
+		return ta.Compare(tb), true
+	}
+	var va, vb dlmsal.Value
+	if dlmsal.Cast(&va, *a) != nil || dlmsal.Cast(&vb, *b) != nil {
+		return 0, false
+	}
+	fa, ok1 := tofloat(&va)
+	fb, ok2 := tofloat(&vb)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch {
+	case fa < fb:
+		return -1, true
+	case fa > fb:
+		return 1, true
+	}
+	return 0, true
+}
+
+func tofloat(v *dlmsal.Value) (float64, bool) {
+	switch v.Type {
+	case dlmsal.SignedInt:
+		return float64(v.Value.(int64)), true
+	case dlmsal.UnsignedInt:
+		return float64(v.Value.(uint64)), true
+	case dlmsal.Real:
+		return v.Value.(float64), true
+	}
+	return 0, false
+}
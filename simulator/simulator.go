@@ -0,0 +1,305 @@
+package simulator
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"github.com/cybroslabs/libdlms-go/dlmsal"
+	"github.com/cybroslabs/libdlms-go/hdlc"
+	"github.com/cybroslabs/libdlms-go/llc"
+	"github.com/cybroslabs/libdlms-go/tcp"
+	"github.com/cybroslabs/libdlms-go/wrapper"
+	"go.uber.org/zap"
+)
+
+// in-process meter serving cosem objects through the dlmsal server side, every connection gets its own association
+// using the same settings, so passwords, system title and keys are the meter ones (see dlmsal.NewServer)
+type Meter struct {
+	settings *dlmsal.DlmsSettings
+	logger   *zap.SugaredLogger
+	mu       sync.RWMutex
+	ln       map[dlmsal.DlmsObis]Object
+	sn       map[int16]Object
+	lasterr  error
+}
+
+// wraps raw byte stream into apdu stream on the meter side
+type Framing func(transport base.Stream) (base.Stream, error)
+
+func New(settings *dlmsal.DlmsSettings) *Meter {
+	return &Meter{
+		settings: settings,
+		ln:       make(map[dlmsal.DlmsObis]Object),
+		sn:       make(map[int16]Object),
+	}
+}
+
+func (m *Meter) SetLogger(logger *zap.SugaredLogger) {
+	m.logger = logger
+}
+
+func (m *Meter) logf(format string, v ...any) {
+	if m.logger != nil {
+		m.logger.Infof(format, v...)
+	}
+}
+
+func (m *Meter) Add(obj Object) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ln := obj.LogicalName()
+	if _, ok := m.ln[ln]; ok {
+		return fmt.Errorf("object %s already exists", ln.String())
+	}
+	m.ln[ln] = obj
+	if p, ok := obj.(*ProfileGeneric); ok {
+		p.setmeter(m)
+	}
+	return nil
+}
+
+// adds object accessible also by short name, attribute n is at basename + 8 * (n - 1)
+func (m *Meter) AddSN(obj Object, basename int16) error {
+	if basename&7 != 0 {
+		return fmt.Errorf("base name has to be multiple of 8")
+	}
+	m.mu.Lock()
+	if _, ok := m.sn[basename]; ok {
+		m.mu.Unlock()
+		return fmt.Errorf("base name %04x already exists", uint16(basename))
+	}
+	m.sn[basename] = obj
+	m.mu.Unlock()
+	return m.Add(obj)
+}
+
+func (m *Meter) Object(obis dlmsal.DlmsObis) Object {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ln[obis]
+}
+
+// returns object and attribute for the short name address
+func (m *Meter) snobject(address int16) (Object, int8) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var best Object
+	var bestbase int
+	for b, o := range m.sn {
+		if int(b) <= int(address) && (best == nil || int(b) > bestbase) {
+			best = o
+			bestbase = int(b)
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+	off := int(address) - bestbase
+	if off&7 != 0 || off/8 >= 0x7f {
+		return nil, 0
+	}
+	return best, int8(off/8 + 1)
+}
+
+// Err returns the last error of connections served in background
+func (m *Meter) Err() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lasterr
+}
+
+func (m *Meter) seterr(err error) {
+	if err == nil {
+		return
+	}
+	m.logf("serving failed: %v", err)
+	m.mu.Lock()
+	m.lasterr = err
+	m.mu.Unlock()
+}
+
+func (m *Meter) lnobject(item *dlmsal.DlmsLNRequestItem) (Object, dlmsal.DlmsResultTag) {
+	o := m.Object(item.Obis)
+	if o == nil {
+		return nil, dlmsal.TagResultObjectUndefined
+	}
+	if o.ClassId() != item.ClassId {
+		return nil, dlmsal.TagResultObjectClassInconsistent
+	}
+	return o, dlmsal.TagResultSuccess
+}
+
+func selector(hasaccess bool, descriptor byte) byte {
+	if hasaccess {
+		return descriptor
+	}
+	return 0
+}
+
+func (m *Meter) Get(item *dlmsal.DlmsLNRequestItem) dlmsal.DlmsData {
+	o, res := m.lnobject(item)
+	if o == nil {
+		return errdata(res)
+	}
+	return o.Get(item.Attribute, selector(item.HasAccess, item.AccessDescriptor), item.AccessData)
+}
+
+func (m *Meter) Set(item *dlmsal.DlmsLNRequestItem) dlmsal.DlmsResultTag {
+	o, res := m.lnobject(item)
+	if o == nil {
+		return res
+	}
+	if item.SetData == nil {
+		return dlmsal.TagResultTypeUnmatched
+	}
+	return o.Set(item.Attribute, item.SetData)
+}
+
+func (m *Meter) Action(item *dlmsal.DlmsLNRequestItem) (*dlmsal.DlmsData, dlmsal.DlmsResultTag) {
+	o, res := m.lnobject(item)
+	if o == nil {
+		return nil, res
+	}
+	return o.Action(item.Attribute, item.SetData)
+}
+
+func (m *Meter) Read(item *dlmsal.DlmsSNRequestItem) dlmsal.DlmsData {
+	o, attr := m.snobject(item.Address)
+	if o == nil {
+		return errdata(dlmsal.TagResultObjectUndefined)
+	}
+	return o.Get(attr, selector(item.HasAccess, item.AccessDescriptor), item.AccessData)
+}
+
+func (m *Meter) Write(item *dlmsal.DlmsSNRequestItem) dlmsal.DlmsResultTag {
+	o, attr := m.snobject(item.Address)
+	if o == nil {
+		return dlmsal.TagResultObjectUndefined
+	}
+	if item.WriteData == nil {
+		return dlmsal.TagResultTypeUnmatched
+	}
+	return o.Set(attr, item.WriteData)
+}
+
+// serves single association over apdu stream till the client disconnects
+func (m *Meter) Serve(transport base.Stream) error {
+	srv := dlmsal.NewServer(transport, m.settings, m)
+	if m.logger != nil {
+		srv.SetLogger(m.logger)
+	}
+	return srv.Serve()
+}
+
+// in-memory apdu pipe, returned stream is the client end and can be used directly by dlmsal.New
+func (m *Meter) Pipe() base.Stream {
+	client, server := NewPipe()
+	go func() {
+		m.seterr(m.Serve(server))
+		_ = server.Disconnect()
+	}()
+	return client
+}
+
+func WrapperFraming(address uint16) Framing {
+	return func(transport base.Stream) (base.Stream, error) {
+		return wrapper.NewServer(transport, address)
+	}
+}
+
+func HdlcFraming(settings *hdlc.Settings) Framing {
+	return func(transport base.Stream) (base.Stream, error) {
+		h, err := hdlc.NewServer(transport, settings)
+		if err != nil {
+			return nil, err
+		}
+		return llc.NewServer(h), nil
+	}
+}
+
+// serves raw connection using given framing till the client disconnects, connection is closed at the end
+func (m *Meter) ServeConn(conn net.Conn, framing Framing) error {
+	defer conn.Close()
+	t, err := framing(tcp.NewFromConn(conn, 0))
+	if err != nil {
+		return err
+	}
+	return m.Serve(t)
+}
+
+// in-memory byte pipe, returned stream is the raw client end, so it has to be framed by the client the same way,
+// e.g. using wrapper.New or hdlc.New with llc.New
+func (m *Meter) PipeConn(framing Framing) base.Stream {
+	c, s := net.Pipe()
+	go func() {
+		m.seterr(m.ServeConn(s, framing))
+	}()
+	return tcp.NewFromConn(c, 0)
+}
+
+type Listener struct {
+	listener net.Listener
+	meter    *Meter
+	framing  Framing
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// listens on the tcp address (e.g. 127.0.0.1:0) and serves every accepted connection in its own goroutine
+func (m *Meter) Listen(address string, framing Framing) (*Listener, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{listener: ln, meter: m, framing: framing, conns: make(map[net.Conn]struct{})}
+	l.wg.Add(1)
+	go l.accept()
+	return l, nil
+}
+
+func (l *Listener) accept() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.meter.logf("serving connection from %s", conn.RemoteAddr())
+			err := l.meter.ServeConn(conn, l.framing)
+			l.mu.Lock()
+			delete(l.conns, conn)
+			closed := l.closed
+			l.mu.Unlock()
+			if !closed { // errors caused by closing the listener are not interesting
+				l.meter.seterr(err)
+			}
+		}()
+	}
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// stops listening, closes all served connections and waits for them
+func (l *Listener) Close() error {
+	err := l.listener.Close()
+	l.mu.Lock()
+	l.closed = true
+	for c := range l.conns {
+		_ = c.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	return err
+}
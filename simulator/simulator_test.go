@@ -0,0 +1,324 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/base"
+	"github.com/cybroslabs/libdlms-go/dlmsal"
+	"github.com/cybroslabs/libdlms-go/hdlc"
+	"github.com/cybroslabs/libdlms-go/llc"
+	"github.com/cybroslabs/libdlms-go/tcp"
+	"github.com/cybroslabs/libdlms-go/wrapper"
+)
+
+const testpassword = "12345678"
+
+var (
+	obisdata    = testobis("0-0:96.1.0.255")
+	obisenergy  = testobis("1-0:1.8.0.255")
+	obisclock   = testobis("0-0:1.0.0.255")
+	obisprofile = testobis("1-0:99.1.0.255")
+	starttime   = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func testobis(s string) dlmsal.DlmsObis {
+	o, err := dlmsal.NewDlmsObisFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return o
+}
+
+// meter with small pdu size, so longer values need block transfer
+func newtestmeter(t *testing.T, sn bool) *Meter {
+	t.Helper()
+	m := New(testsettings(t, sn))
+	big := make([]byte, 3000)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	pg := NewProfileGeneric(obisprofile, []CaptureObject{{ClassId: 8, Obis: obisclock, Attribute: 2}, {ClassId: 3, Obis: obisenergy, Attribute: 2}}, 900, 0)
+	for i := 0; i < 100; i++ {
+		pg.AddRow(dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: dlmsal.NewDlmsDateTimeFromTime(starttime.Add(time.Duration(i) * 15 * time.Minute))},
+			dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: uint32(i)})
+	}
+	for _, err := range []error{
+		m.Add(NewData(obisdata, dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: big})),
+		m.AddSN(NewRegister(obisenergy, dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: uint32(1234)}, -3, 30), 0x100),
+		m.Add(NewClock(obisclock, starttime)),
+		m.Add(pg),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func testsettings(t *testing.T, sn bool) *dlmsal.DlmsSettings {
+	t.Helper()
+	var s *dlmsal.DlmsSettings
+	var err error
+	if sn {
+		s, err = dlmsal.NewSettingsWithLowAuthenticationSN(testpassword)
+	} else {
+		s, err = dlmsal.NewSettingsWithLowAuthenticationLN(testpassword)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxPduRecvSize = 256
+	return s
+}
+
+func testclient(t *testing.T, tr base.Stream, sn bool) dlmsal.DlmsClient {
+	t.Helper()
+	c := dlmsal.New(tr, testsettings(t, sn))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func exerciseln(t *testing.T, c dlmsal.DlmsClient) {
+	t.Helper()
+	r, err := c.Get([]dlmsal.DlmsLNRequestItem{
+		{ClassId: 1, Obis: obisdata, Attribute: 2},
+		{ClassId: 3, Obis: obisenergy, Attribute: 3},
+		{ClassId: 8, Obis: obisclock, Attribute: 2},
+		{ClassId: 3, Obis: obisdata, Attribute: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := r[0].Value.([]byte); !ok || len(b) != 3000 || b[2999] != byte(2999&0xff) {
+		t.Errorf("unexpected long value %v", r[0].Tag)
+	}
+	if su, ok := r[1].Value.([]dlmsal.DlmsData); !ok || len(su) != 2 || su[0].Value != int8(-3) || su[1].Value != uint8(30) {
+		t.Errorf("unexpected scaler unit %v", r[1])
+	}
+	if r[2].Tag != dlmsal.TagOctetString {
+		t.Errorf("unexpected clock time %v", r[2])
+	}
+	if e, ok := r[3].Value.(*dlmsal.DlmsError); r[3].Tag != dlmsal.TagError || !ok || e.Result != dlmsal.TagResultObjectClassInconsistent {
+		t.Errorf("expected class inconsistent error, got %v", r[3])
+	}
+
+	from := dlmsal.NewDlmsDateTimeFromTime(starttime.Add(time.Hour))
+	to := dlmsal.NewDlmsDateTimeFromTime(starttime.Add(2 * time.Hour))
+	acc := dlmsal.EncodeSimpleRangeAccess(&from, &to)
+	r, err = c.Get([]dlmsal.DlmsLNRequestItem{{ClassId: 7, Obis: obisprofile, Attribute: 2, HasAccess: true, AccessDescriptor: 1, AccessData: &acc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, _ := r[0].Value.([]dlmsal.DlmsData)
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %v", r[0])
+	}
+	for i, row := range rows {
+		if cols := row.Value.([]dlmsal.DlmsData); cols[1].Value != uint32(4+i) {
+			t.Errorf("unexpected row %d: %v", i, row)
+		}
+	}
+
+	long := make([]byte, 1000)
+	for i := range long {
+		long[i] = byte(i * 7)
+	}
+	rs, err := c.Set([]dlmsal.DlmsLNRequestItem{{ClassId: 1, Obis: obisdata, Attribute: 2, SetData: &dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: long}}})
+	if err != nil || rs[0] != dlmsal.TagResultSuccess {
+		t.Fatal(rs, err)
+	}
+	rs, err = c.Set([]dlmsal.DlmsLNRequestItem{{ClassId: 3, Obis: obisenergy, Attribute: 2, SetData: &dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: uint32(5)}}})
+	if err != nil || rs[0] != dlmsal.TagResultSuccess {
+		t.Fatal(rs, err)
+	}
+	if _, err = c.Action(dlmsal.DlmsLNRequestItem{ClassId: 7, Obis: obisprofile, Attribute: 2, SetData: &dlmsal.DlmsData{Tag: dlmsal.TagInteger, Value: int8(0)}}); err != nil {
+		t.Fatal(err)
+	}
+	r, err = c.Get([]dlmsal.DlmsLNRequestItem{
+		{ClassId: 1, Obis: obisdata, Attribute: 2},
+		{ClassId: 7, Obis: obisprofile, Attribute: 7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := r[0].Value.([]byte); !ok || !bytes.Equal(b, long) {
+		t.Errorf("value written by blocks wasnt stored")
+	}
+	if r[1].Value != uint32(101) {
+		t.Errorf("expected 101 entries after capture, got %v", r[1])
+	}
+}
+
+func TestMeterTransports(t *testing.T) {
+	hdlcmeter := &hdlc.Settings{Logical: 1, Physical: 17, MaxRcv: 128, MaxSnd: 128}
+	hdlcclient := &hdlc.Settings{Logical: 1, Physical: 17, Client: 16, MaxRcv: 200, MaxSnd: 200}
+	wrapped := func(raw base.Stream) (base.Stream, error) { return wrapper.New(raw, 16, 1) }
+	framed := func(raw base.Stream) (base.Stream, error) {
+		h, err := hdlc.New(raw, hdlcclient)
+		if err != nil {
+			return nil, err
+		}
+		return llc.New(h), nil
+	}
+	listen := func(t *testing.T, m *Meter, framing Framing) base.Stream {
+		l, err := m.Listen("127.0.0.1:0", framing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = l.Close() })
+		return tcp.New("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 5*time.Second)
+	}
+
+	tests := []struct {
+		name    string
+		connect func(t *testing.T, m *Meter) (base.Stream, error)
+	}{
+		{"pipe", func(t *testing.T, m *Meter) (base.Stream, error) { return m.Pipe(), nil }},
+		{"wrapper pipe", func(t *testing.T, m *Meter) (base.Stream, error) { return wrapped(m.PipeConn(WrapperFraming(1))) }},
+		{"hdlc pipe", func(t *testing.T, m *Meter) (base.Stream, error) { return framed(m.PipeConn(HdlcFraming(hdlcmeter))) }},
+		{"wrapper tcp", func(t *testing.T, m *Meter) (base.Stream, error) { return wrapped(listen(t, m, WrapperFraming(1))) }},
+		{"hdlc tcp", func(t *testing.T, m *Meter) (base.Stream, error) { return framed(listen(t, m, HdlcFraming(hdlcmeter))) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newtestmeter(t, false)
+			tr, err := tt.connect(t, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.SetTimeout(5 * time.Second)
+			c := testclient(t, tr, false)
+			exerciseln(t, c)
+			if err = c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			_ = tr.Disconnect()
+			if err = m.Err(); err != nil {
+				t.Errorf("meter failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestMeterShortNames(t *testing.T) {
+	m := newtestmeter(t, true)
+	tr := m.Pipe()
+	c := testclient(t, tr, true)
+	defer tr.Disconnect()
+
+	r, err := c.Read([]dlmsal.DlmsSNRequestItem{{Address: 0x108}, {Address: 0x110}, {Address: 0x200}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0].Value != uint32(1234) {
+		t.Errorf("unexpected register value %v", r[0])
+	}
+	if fmt.Sprint(r[1].Value) != fmt.Sprint([]dlmsal.DlmsData{{Tag: dlmsal.TagInteger, Value: int8(-3)}, {Tag: dlmsal.TagEnum, Value: uint8(30)}}) {
+		t.Errorf("unexpected scaler unit %v", r[1])
+	}
+	if r[2].Tag != dlmsal.TagError {
+		t.Errorf("expected error for unknown address, got %v", r[2])
+	}
+
+	rs, err := c.Write([]dlmsal.DlmsSNRequestItem{
+		{Address: 0x108, WriteData: &dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: uint32(99)}},
+		{Address: 0x110, WriteData: &dlmsal.DlmsData{Tag: dlmsal.TagNull}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs[0] != dlmsal.TagResultSuccess || rs[1] != dlmsal.TagResultReadWriteDenied {
+		t.Errorf("unexpected write results %v", rs)
+	}
+	if v := m.Object(obisenergy).(*Register).Value(); v.Value != uint32(99) {
+		t.Errorf("written value wasnt stored: %v", v)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMeterUnconfirmedWriteHdlc(t *testing.T) {
+	m := newtestmeter(t, true)
+	h, err := hdlc.New(m.PipeConn(HdlcFraming(&hdlc.Settings{Logical: 1, Physical: 17})), &hdlc.Settings{Logical: 1, Physical: 17, Client: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := llc.New(h)
+	tr.SetTimeout(5 * time.Second)
+	c := testclient(t, tr, true)
+	defer tr.Disconnect()
+
+	// more unconfirmed writes in a row, every one is a separate frame with its own llc header
+	for _, v := range []uint32{77, 78} {
+		if err = c.UnconfirmedWrite([]dlmsal.DlmsSNRequestItem{{Address: 0x108, WriteData: &dlmsal.DlmsData{Tag: dlmsal.TagDoubleLongUnsigned, Value: v}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := c.Read([]dlmsal.DlmsSNRequestItem{{Address: 0x108}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[0].Value != uint32(78) {
+		t.Errorf("unexpected value after unconfirmed write %v", r[0])
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Err(); err != nil {
+		t.Errorf("meter failed: %v", err)
+	}
+}
+
+func TestMeterGbtHdlc(t *testing.T) {
+	ms := testsettings(t, false)
+	ms.ConformanceBlock |= dlmsal.ConformanceBlockGeneralBlockTransfer
+	ms.GbtWindowSize = 3
+	m := New(ms)
+	if err := m.Add(NewData(obisdata, dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: []byte{}})); err != nil {
+		t.Fatal(err)
+	}
+	h, err := hdlc.New(m.PipeConn(HdlcFraming(&hdlc.Settings{Logical: 1, Physical: 17})), &hdlc.Settings{Logical: 1, Physical: 17, Client: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := llc.New(h)
+	tr.SetTimeout(5 * time.Second)
+	defer tr.Disconnect()
+	cs := testsettings(t, false)
+	cs.ConformanceBlock |= dlmsal.ConformanceBlockGeneralBlockTransfer
+	cs.GbtWindowSize = 3
+	c := dlmsal.New(tr, cs)
+	if err = c.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// blocks of the window are streamed, every frame is acknowledged by RR only
+	long := make([]byte, 2000)
+	for i := range long {
+		long[i] = byte(i * 7)
+	}
+	rs, err := c.Set([]dlmsal.DlmsLNRequestItem{{ClassId: 1, Obis: obisdata, Attribute: 2, SetData: &dlmsal.DlmsData{Tag: dlmsal.TagOctetString, Value: long}}})
+	if err != nil || rs[0] != dlmsal.TagResultSuccess {
+		t.Fatal(rs, err)
+	}
+	r, err := c.Get([]dlmsal.DlmsLNRequestItem{{ClassId: 1, Obis: obisdata, Attribute: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := r[0].Value.([]byte); !ok || !bytes.Equal(b, long) {
+		t.Errorf("long value damaged by general block transfer: %v", r[0].Tag)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Err(); err != nil {
+		t.Errorf("meter failed: %v", err)
+	}
+}
@@ -50,6 +50,18 @@ func New(hostname string, port int, timeout time.Duration) base.Stream {
 	}
 }
 
+// wraps already connected connection, e.g. accepted by a listener, hostname is used only for logging
+func NewFromConn(conn net.Conn, timeout time.Duration) base.Stream {
+	return &tcp{
+		hostname:  conn.RemoteAddr().String(),
+		logger:    nil,
+		connected: true,
+		timeout:   timeout,
+		conn:      conn,
+		buffer:    make([]byte, 2048),
+	}
+}
+
 func (w *tcp) logf(format string, v ...any) {
 	if w.logger != nil {
 		w.logger.Infof(format, v...)
@@ -117,6 +129,7 @@ func (t *tcp) setcommdeadline() { // yes, this is shit
 	if t.deadline.IsZero() {
 		if t.timeout == 0 {
 			_ = t.conn.SetDeadline(zero) // i dont have to call every time, but this simulates timeout
+			return
 		}
 		_ = t.conn.SetDeadline(time.Now().Add(t.timeout))
 	} else {
@@ -0,0 +1,46 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// zero timeout means no timeout, so an answer coming later is still received
+func TestZeroTimeout(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	go func() {
+		var buf [4]byte
+		if _, err := io.ReadFull(b, buf[:]); err != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		_, _ = b.Write(buf[:])
+	}()
+
+	s := NewFromConn(a, 0)
+	if err := s.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	var buf [4]byte
+	if _, err := io.ReadFull(s, buf[:]); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:]) != "ping" {
+		t.Errorf("unexpected answer %q", buf[:])
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	s := NewFromConn(a, 20*time.Millisecond)
+	var buf [1]byte
+	if _, err := s.Read(buf[:]); err == nil {
+		t.Errorf("read without answer didnt time out")
+	}
+}
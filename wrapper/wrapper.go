@@ -16,8 +16,9 @@ type wrapper struct {
 	destination uint16
 	buffer      []byte // send buffer and header buffer
 	remaining   int
-	expresp     bool
 	towrite     int
+	server      bool // server side, accepts any client and answers to it
+	inmessage   bool // header of the current message was already received
 }
 
 func (w *wrapper) logf(format string, v ...any) {
@@ -34,11 +35,24 @@ func New(transport base.Stream, source uint16, destination uint16) (base.Stream,
 		destination: destination,
 		buffer:      make([]byte, 2048),
 		remaining:   0,
-		expresp:     false,
 		towrite:     0,
 	}, nil
 }
 
+// server side of the wrapper, incoming message is read without writing anything before, destination is taken from the last received header
+func NewServer(transport base.Stream, source uint16) (base.Stream, error) {
+	return &wrapper{
+		transport:   transport,
+		logger:      nil,
+		source:      source,
+		destination: 0,
+		buffer:      make([]byte, 2048),
+		remaining:   0,
+		towrite:     0,
+		server:      true,
+	}, nil
+}
+
 func (w *wrapper) Close() error {
 	return w.transport.Close()
 }
@@ -87,6 +101,7 @@ func (w *wrapper) Write(src []byte) error {
 			return fmt.Errorf("no data read")
 		}
 	}
+	w.inmessage = false
 
 	if w.towrite == 0 {
 		w.buffer[0] = 0
@@ -106,7 +121,6 @@ func (w *wrapper) Write(src []byte) error {
 
 	copy(w.buffer[w.towrite:], src)
 	w.towrite += len(src)
-	w.expresp = true
 	return nil
 }
 
@@ -126,13 +140,23 @@ func (w *wrapper) flush() error {
 	return nil
 }
 
+// sends written data as a single message, so more messages can be sent in a row
+func (w *wrapper) Flush() error {
+	if w.towrite == 0 {
+		return nil
+	}
+	return w.flush()
+}
+
 func (w *wrapper) Read(p []byte) (n int, err error) {
-	if w.expresp {
+	if w.towrite > 0 {
 		err = w.flush()
 		if err != nil {
 			return
 		}
+	}
 
+	if !w.inmessage { // next message, also without write in between (general block transfer windows, notifications)
 		_, err = io.ReadFull(w.transport, w.buffer[:8])
 		if err != nil {
 			return
@@ -144,12 +168,15 @@ func (w *wrapper) Read(p []byte) (n int, err error) {
 		}
 		rsrc := uint16(w.buffer[2])<<8 | uint16(w.buffer[3])
 		rdest := uint16(w.buffer[4])<<8 | uint16(w.buffer[5])
+		if w.server && rdest == w.source {
+			w.destination = rsrc
+		}
 		if rsrc != w.destination || rdest != w.source {
 			return 0, fmt.Errorf("invalid source or destination")
 		}
 
 		w.remaining = int(uint16(w.buffer[6])<<8 | uint16(w.buffer[7]))
-		w.expresp = false
+		w.inmessage = true
 	}
 
 	n = len(p)
@@ -157,6 +184,7 @@ func (w *wrapper) Read(p []byte) (n int, err error) {
 		return 0, base.ErrNothingToRead
 	}
 	if w.remaining == 0 {
+		w.inmessage = false
 		return 0, io.EOF
 	}
 	if n > w.remaining {
@@ -0,0 +1,53 @@
+package wrapper
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybroslabs/libdlms-go/tcp"
+)
+
+func message(src uint16, dst uint16, payload []byte) []byte {
+	return append([]byte{0, 1, byte(src >> 8), byte(src), byte(dst >> 8), byte(dst), byte(len(payload) >> 8), byte(len(payload))}, payload...)
+}
+
+// every message ends by io.EOF and the next read waits for the next message, e.g. more general block transfer
+// blocks or a notification sent without any request in between
+func TestReadMessagesInRow(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	go func() {
+		req := make([]byte, 9)
+		if _, err := io.ReadFull(b, req); err != nil {
+			return
+		}
+		_, _ = b.Write(append(message(1, 16, []byte("first")), message(1, 16, []byte("second"))...))
+		_, _ = b.Write(message(2, 16, []byte("other")))
+	}()
+
+	w, err := New(tcp.NewFromConn(a, time.Second), 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"first", "second"} {
+		data, err := io.ReadAll(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte(exp)) {
+			t.Errorf("received %q, expected %q", data, exp)
+		}
+	}
+	var buf [8]byte
+	if _, err = w.Read(buf[:]); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("message from other address accepted: %v", err)
+	}
+}